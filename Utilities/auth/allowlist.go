@@ -0,0 +1,61 @@
+// auth. Allowlist of the organisations each user can query
+// Written by Jason Vicinanza
+
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// allowlist maps the users to their organisations. "*" allows every organisation
+type allowlist map[string][]string
+
+// loadAllowlist reads the allowlist. One "user: organisation, organisation" per line, empty lines & comments (#) are ignored
+// The users not listed cannot query any organisation
+func loadAllowlist(fileName string) (allowlist, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the allowlist: %w", err)
+	}
+	defer file.Close()
+
+	list := make(allowlist)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, organisations, found := strings.Cut(line, ":")
+		user = strings.TrimSpace(user)
+		if !found || user == "" {
+			return nil, fmt.Errorf("allowlist line %d: the format is user: organisation, organisation", lineNo)
+		}
+		for _, organisation := range strings.Split(organisations, ",") {
+			if organisation = strings.TrimSpace(organisation); organisation != "" {
+				list[user] = append(list[user], organisation)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read the allowlist: %w", err)
+	}
+
+	return list, nil
+}
+
+// allowed reports whether the user can query the organisation. The organisation names are not case sensitive
+func (list allowlist) allowed(user string, organisation string) bool {
+	for _, allowed := range list[user] {
+		if allowed == "*" || strings.EqualFold(allowed, organisation) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAllowlist(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		users   int
+		wantErr string
+	}{
+		{"users", "alice@example.com: org1, org2\nbob@example.com: *\n", 2, ""},
+		{"comments & empty lines", "# user: organisations\n\nalice@example.com: org1\n", 1, ""},
+		{"no organisations", "alice@example.com:\n", 0, ""},
+		{"no separator", "alice@example.com org1\n", 0, "the format is user: organisation, organisation"},
+		{"no user", ": org1\n", 0, "the format is user: organisation, organisation"},
+	}
+
+	for _, test := range tests {
+		list, err := loadAllowlist(writeFile(t, "allowlist", test.content))
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s. loadAllowlist() = %v, want no error", test.name, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s. loadAllowlist() = %v, want an error containing %q", test.name, err, test.wantErr)
+		case test.wantErr == "" && len(list) != test.users:
+			t.Errorf("%s. loadAllowlist() = %d users, want %d", test.name, len(list), test.users)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+
+	allowlistFile := writeFile(t, "allowlist", "alice: org1, Org2\nbob: *\ncarol:\n")
+	htpasswdFile := writeFile(t, "htpasswd", testHtpasswd)
+
+	withAllowlist, err := New(Config{Mode: ModeHtpasswd, HtpasswdFile: htpasswdFile, AllowlistFile: allowlistFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutAllowlist, err := New(Config{Mode: ModeHtpasswd, HtpasswdFile: htpasswdFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		user          string
+		organisation  string
+		allowed       bool
+		listed        bool
+	}{
+		{"listed organisation", withAllowlist, "alice", "org1", true, true},
+		{"case insensitive", withAllowlist, "alice", "ORG2", true, true},
+		{"partial name", withAllowlist, "alice", "org", false, false},
+		{"other organisation", withAllowlist, "alice", "org3", false, false},
+		{"every organisation", withAllowlist, "bob", "org3", true, true},
+		{"no organisations", withAllowlist, "carol", "org1", false, false},
+		{"user not listed", withAllowlist, "dave", "org1", false, false},
+		{"no allowlist", withoutAllowlist, "dave", "org1", true, false},
+		{"no authentication", &Authenticator{}, "", "org1", true, false},
+	}
+
+	for _, test := range tests {
+		if got := test.authenticator.Allowed(test.user, test.organisation); got != test.allowed {
+			t.Errorf("%s. Allowed(%q, %q) = %v, want %v", test.name, test.user, test.organisation, got, test.allowed)
+		}
+		if got := test.authenticator.Listed(test.user, test.organisation); got != test.listed {
+			t.Errorf("%s. Listed(%q, %q) = %v, want %v", test.name, test.user, test.organisation, got, test.listed)
+		}
+	}
+}
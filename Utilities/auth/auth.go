@@ -0,0 +1,347 @@
+// Package auth authenticates the users of the web UIs (htpasswd file or OpenID Connect)
+// The allowlist maps the users to the organisations they can query. The share keys give access to the results of a session
+// Written by Jason Vicinanza
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authentication modes
+const (
+	ModeNone     = "none"     // No authentication, every visitor can use the tool & view every session
+	ModeHtpasswd = "htpasswd" // HTTP basic authentication. The users & passwords are listed in an htpasswd file
+	ModeOIDC     = "oidc"     // OpenID Connect login (authorization code flow)
+)
+
+// Default lifetime of the OIDC login
+const DefaultSessionLifetime = 12 * time.Hour
+
+// Default lifetime of the share links
+const DefaultShareLifetime = 30 * 24 * time.Hour
+
+// The signed value has been modified, or has expired
+var errInvalidSignature = errors.New("invalid signature")
+
+// Config defines how the users are authenticated
+type Config struct {
+	Mode            string
+	Realm           string // Displayed by the browser in htpasswd mode
+	HtpasswdFile    string // htpasswd mode
+	AllowlistFile   string // Organisations each user can query. All organisations when not set
+	Secret          []byte // Signs the login cookie & the share keys. Random when not set, the logins & share links are then lost when the server restarts
+	CookieName      string // Name of the login cookie
+	SessionLifetime time.Duration
+	ShareLifetime   time.Duration
+	OIDC            OIDCConfig
+}
+
+// OIDCConfig is the OpenID Connect provider & client
+type OIDCConfig struct {
+	Issuer       string // e.g. https://accounts.google.com. The endpoints are read from /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // e.g. http://localhost:8081/auth/callback
+	UserClaim    string // Claim of the ID token used as the user name. email by default, sub when the claim is empty
+}
+
+// ConfigFromEnv reads the configuration from the environment variables starting with prefix (e.g. envSegmentifyLiteAuthMode)
+// AuthMode, AuthSecret, Htpasswd, Allowlist, OIDCIssuer, OIDCClientID, OIDCClientSecret, OIDCRedirectURL & OIDCUserClaim
+func ConfigFromEnv(prefix string) Config {
+	return Config{
+		Mode:          os.Getenv(prefix + "AuthMode"),
+		HtpasswdFile:  os.Getenv(prefix + "Htpasswd"),
+		AllowlistFile: os.Getenv(prefix + "Allowlist"),
+		Secret:        []byte(os.Getenv(prefix + "AuthSecret")),
+		OIDC: OIDCConfig{
+			Issuer:       os.Getenv(prefix + "OIDCIssuer"),
+			ClientID:     os.Getenv(prefix + "OIDCClientID"),
+			ClientSecret: os.Getenv(prefix + "OIDCClientSecret"),
+			RedirectURL:  os.Getenv(prefix + "OIDCRedirectURL"),
+			UserClaim:    os.Getenv(prefix + "OIDCUserClaim"),
+		},
+	}
+}
+
+// Authenticator authenticates the requests. The zero value does not authenticate the users
+type Authenticator struct {
+	config    Config
+	users     map[string]string // htpasswd mode. Password hash by user
+	allowlist allowlist
+	oidc      *oidcProvider
+}
+
+// User of the request, set by Require
+type contextKey struct{}
+
+// New validates the configuration and loads the htpasswd & allowlist files
+func New(config Config) (*Authenticator, error) {
+
+	config.Mode = strings.ToLower(strings.TrimSpace(config.Mode))
+	if config.Mode == "" {
+		config.Mode = ModeNone
+	}
+	if config.CookieName == "" {
+		config.CookieName = "go_seo_login"
+	}
+	if config.SessionLifetime <= 0 {
+		config.SessionLifetime = DefaultSessionLifetime
+	}
+	if config.ShareLifetime <= 0 {
+		config.ShareLifetime = DefaultShareLifetime
+	}
+
+	authenticator := &Authenticator{config: config}
+
+	switch config.Mode {
+	case ModeNone:
+		return authenticator, nil
+	case ModeHtpasswd:
+		if config.HtpasswdFile == "" {
+			return nil, errors.New("the htpasswd file is required in htpasswd mode")
+		}
+		users, err := loadHtpasswd(config.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.users = users
+	case ModeOIDC:
+		if config.OIDC.Issuer == "" || config.OIDC.ClientID == "" || config.OIDC.RedirectURL == "" {
+			return nil, errors.New("the OIDC issuer, client ID and redirect URL are required in oidc mode")
+		}
+		if config.OIDC.UserClaim == "" {
+			config.OIDC.UserClaim = "email"
+		}
+		authenticator.oidc = newOIDCProvider(config.OIDC)
+	default:
+		return nil, fmt.Errorf("invalid authentication mode %q, use none, htpasswd or oidc", config.Mode)
+	}
+
+	if len(config.Secret) == 0 {
+		slog.Warn("No authentication secret set. The logins and share links are lost when the server restarts")
+		config.Secret = make([]byte, 32)
+		if _, err := rand.Read(config.Secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.AllowlistFile != "" {
+		list, err := loadAllowlist(config.AllowlistFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.allowlist = list
+	}
+
+	authenticator.config = config
+	return authenticator, nil
+}
+
+// Enabled reports whether the users are authenticated
+func (a *Authenticator) Enabled() bool {
+	return a.config.Mode != "" && a.config.Mode != ModeNone
+}
+
+// Mode returns the authentication mode
+func (a *Authenticator) Mode() string {
+	if !a.Enabled() {
+		return ModeNone
+	}
+	return a.config.Mode
+}
+
+// Require only calls next when the user is authenticated. The user is available with User
+func (a *Authenticator) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := a.Identify(r)
+		if !ok {
+			a.Challenge(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, user)))
+	})
+}
+
+// RequireFunc is Require for a handler function
+func (a *Authenticator) RequireFunc(next http.HandlerFunc) http.HandlerFunc {
+	return a.Require(next).ServeHTTP
+}
+
+// User returns the user of a request served by Require, or the user identified by the request. Empty when not authenticated
+func (a *Authenticator) User(r *http.Request) string {
+	if user, ok := r.Context().Value(contextKey{}).(string); ok {
+		return user
+	}
+	user, _ := a.Identify(r)
+	return user
+}
+
+// Identify returns the user authenticated by the request: the basic authentication (htpasswd) or the login cookie (OIDC)
+func (a *Authenticator) Identify(r *http.Request) (string, bool) {
+
+	switch a.config.Mode {
+	case ModeHtpasswd:
+		user, password, ok := r.BasicAuth()
+		if !ok || !a.checkPassword(user, password) {
+			return "", false
+		}
+		return user, true
+	case ModeOIDC:
+		cookie, err := r.Cookie(a.config.CookieName)
+		if err != nil {
+			return "", false
+		}
+		value, err := a.verify(cookie.Value)
+		if err != nil {
+			return "", false
+		}
+		user, expiry, found := strings.Cut(value, "|")
+		if !found || user == "" || !notExpired(expiry) {
+			return "", false
+		}
+		return user, true
+	}
+
+	return "", false
+}
+
+// Challenge asks the user to log in. The browser displays the login dialog (htpasswd), or is redirected to the provider (OIDC)
+// The API requests & the requests other than GET are answered with 401
+func (a *Authenticator) Challenge(w http.ResponseWriter, r *http.Request) {
+
+	if a.config.Mode == ModeHtpasswd {
+		realm := a.config.Realm
+		if realm == "" {
+			realm = "Go_Seo"
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	http.Error(w, "Authentication required", http.StatusUnauthorized)
+}
+
+// RegisterHandlers registers the login, callback & logout endpoints (/auth/...) used in OIDC mode
+func (a *Authenticator) RegisterHandlers(mux *http.ServeMux) {
+	if a.config.Mode != ModeOIDC {
+		return
+	}
+	mux.HandleFunc("GET /auth/login", a.loginHandler)
+	mux.HandleFunc("GET /auth/callback", a.callbackHandler)
+	mux.HandleFunc("GET /auth/logout", a.logoutHandler)
+}
+
+// Allowed reports whether a user can query an organisation. Every organisation is allowed when no allowlist is set
+func (a *Authenticator) Allowed(user string, organisation string) bool {
+	if !a.Enabled() || a.allowlist == nil {
+		return true
+	}
+	return a.allowlist.allowed(user, organisation)
+}
+
+// Listed reports whether the allowlist grants an organisation to a user. Unlike Allowed, false when no allowlist is set
+func (a *Authenticator) Listed(user string, organisation string) bool {
+	return a.Enabled() && a.allowlist != nil && a.allowlist.allowed(user, organisation)
+}
+
+// ShareKey returns the key giving access to the results of a session to anyone holding the link
+// The key is the expiry time (Unix seconds) and its signature with the session ID, separated by "."
+func (a *Authenticator) ShareKey(sessionID string) string {
+	expiry := strconv.FormatInt(time.Now().Add(a.config.ShareLifetime).Unix(), 10)
+	return expiry + "." + a.shareSignature(sessionID, expiry)
+}
+
+// ValidShareKey checks the share key of a session. Expired keys are refused
+func (a *Authenticator) ValidShareKey(sessionID string, key string) bool {
+	if !a.Enabled() || key == "" {
+		return false
+	}
+	expiry, signature, found := strings.Cut(key, ".")
+	if !found || !notExpired(expiry) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(a.shareSignature(sessionID, expiry)))
+}
+
+// CanView reports whether the user can view the results of a session created by owner
+// Sessions created without authentication have no owner, they can be viewed by every user
+func (a *Authenticator) CanView(user string, owner string) bool {
+	if !a.Enabled() || owner == "" {
+		return true
+	}
+	return user != "" && user == owner
+}
+
+// sign returns the value and its HMAC-SHA256 signature, base64url encoded, separated by "."
+func (a *Authenticator) sign(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + base64.RawURLEncoding.EncodeToString(a.mac(value))
+}
+
+// verify returns the value signed with sign
+func (a *Authenticator) verify(signed string) (string, error) {
+	encodedValue, encodedSignature, found := strings.Cut(signed, ".")
+	if !found {
+		return "", errInvalidSignature
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", errInvalidSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, a.mac(string(value))) {
+		return "", errInvalidSignature
+	}
+	return string(value), nil
+}
+
+// shareSignature signs the session ID & expiry time of a share key
+func (a *Authenticator) shareSignature(sessionID string, expiry string) string {
+	return base64.RawURLEncoding.EncodeToString(a.mac("share|" + sessionID + "|" + expiry))
+}
+
+func (a *Authenticator) mac(value string) []byte {
+	mac := hmac.New(sha256.New, a.config.Secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// notExpired checks an expiry time (Unix seconds)
+func notExpired(expiry string) bool {
+	var seconds int64
+	if _, err := fmt.Sscan(expiry, &seconds); err != nil {
+		return false
+	}
+	return time.Now().Unix() < seconds
+}
+
+// randomString returns a random base64url string, used for the OIDC state & nonce
+func randomString() (string, error) {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
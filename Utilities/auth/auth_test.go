@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAuthenticator returns an htpasswd authenticator with a known secret
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	authenticator, err := New(Config{Mode: ModeHtpasswd, HtpasswdFile: writeFile(t, "htpasswd", testHtpasswd), Secret: []byte("test-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator
+}
+
+func TestShareKey(t *testing.T) {
+
+	authenticator := newTestAuthenticator(t)
+	other, err := New(Config{Mode: ModeHtpasswd, HtpasswdFile: writeFile(t, "htpasswd", testHtpasswd), Secret: []byte("other-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := authenticator.ShareKey("session1")
+	expiry, signature, _ := strings.Cut(key, ".")
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		key       string
+		want      bool
+	}{
+		{"valid", "session1", key, true},
+		{"other session", "session2", key, false},
+		{"other secret", "session1", other.ShareKey("session1"), false},
+		{"empty", "session1", "", false},
+		{"no signature", "session1", expiry, false},
+		{"tampered signature", "session1", expiry + "." + strings.ToUpper(signature), false},
+		{"tampered expiry", "session1", future + "." + signature, false},
+		{"invalid expiry", "session1", "never." + signature, false},
+		{"expired", "session1", past + "." + authenticator.shareSignature("session1", past), false},
+		{"not expired", "session1", future + "." + authenticator.shareSignature("session1", future), true},
+	}
+
+	for _, test := range tests {
+		if got := authenticator.ValidShareKey(test.sessionID, test.key); got != test.want {
+			t.Errorf("%s. ValidShareKey(%q, %q) = %v, want %v", test.name, test.sessionID, test.key, got, test.want)
+		}
+	}
+
+	if (&Authenticator{}).ValidShareKey("session1", key) {
+		t.Error("ValidShareKey() without authentication = true, want false")
+	}
+}
+
+func TestSign(t *testing.T) {
+
+	authenticator := newTestAuthenticator(t)
+	signed := authenticator.sign("alice|123")
+	value, signature, _ := strings.Cut(signed, ".")
+
+	tests := []struct {
+		name   string
+		signed string
+		want   string
+	}{
+		{"valid", signed, "alice|123"},
+		{"no signature", value, ""},
+		{"tampered value", base64.RawURLEncoding.EncodeToString([]byte("bob|123")) + "." + signature, ""},
+		{"tampered signature", value + "." + signature[1:], ""},
+		{"invalid encoding", "!!!." + signature, ""},
+	}
+
+	for _, test := range tests {
+		got, err := authenticator.verify(test.signed)
+		if test.want == "" && err == nil {
+			t.Errorf("%s. verify(%q) = %q, want an error", test.name, test.signed, got)
+		}
+		if test.want != "" && (err != nil || got != test.want) {
+			t.Errorf("%s. verify(%q) = %q, %v, want %q", test.name, test.signed, got, err, test.want)
+		}
+	}
+}
+
+func TestLoginCookie(t *testing.T) {
+
+	authenticator, err := New(Config{Mode: ModeOIDC, CookieName: "login", Secret: []byte("test-secret"), OIDC: OIDCConfig{
+		Issuer:      "http://idp.example.com",
+		ClientID:    "client",
+		RedirectURL: "http://localhost/auth/callback",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	valid := authenticator.sign("alice|" + future)
+	_, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"valid", valid, "alice"},
+		{"expired", authenticator.sign("alice|" + past), ""},
+		{"no expiry", authenticator.sign("alice"), ""},
+		{"no user", authenticator.sign("|" + future), ""},
+		{"tampered user", base64.RawURLEncoding.EncodeToString([]byte("bob|"+future)) + "." + signature, ""},
+		{"not signed", "alice", ""},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.AddCookie(&http.Cookie{Name: "login", Value: test.cookie})
+		if user, ok := authenticator.Identify(request); user != test.want || ok != (test.want != "") {
+			t.Errorf("%s. Identify() = %q, %v, want %q", test.name, user, ok, test.want)
+		}
+	}
+}
+
+func TestCanView(t *testing.T) {
+
+	authenticator := newTestAuthenticator(t)
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		user          string
+		owner         string
+		want          bool
+	}{
+		{"owner", authenticator, "alice", "alice", true},
+		{"other user", authenticator, "bob", "alice", false},
+		{"not logged in", authenticator, "", "alice", false},
+		{"no owner", authenticator, "bob", "", true},
+		{"no authentication", &Authenticator{}, "", "alice", true},
+	}
+
+	for _, test := range tests {
+		if got := test.authenticator.CanView(test.user, test.owner); got != test.want {
+			t.Errorf("%s. CanView(%q, %q) = %v, want %v", test.name, test.user, test.owner, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// auth. htpasswd file. The MD5 (htpasswd -m, the default) and SHA-1 (htpasswd -s) hashes are supported
+// Written by Jason Vicinanza
+
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Alphabet used by the MD5 crypt encoding
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// loadHtpasswd reads the users & password hashes. One "user:hash" per line, empty lines & comments (#) are ignored
+func loadHtpasswd(fileName string) (map[string]string, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the htpasswd file: %w", err)
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" || hash == "" {
+			return nil, fmt.Errorf("htpasswd line %d: the format is user:hash", lineNo)
+		}
+		if !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("htpasswd line %d: unsupported hash for %s, use htpasswd -m (MD5) or -s (SHA-1)", lineNo, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read the htpasswd file: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users found in the htpasswd file %s", fileName)
+	}
+
+	return users, nil
+}
+
+// checkPassword compares a password with the hash of the user
+func (a *Authenticator) checkPassword(user string, password string) bool {
+
+	hash, found := a.users[user]
+	if !found {
+		return false
+	}
+
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1(password, salt)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1 returns the Apache MD5 crypt hash of a password
+func apr1(password string, salt string) string {
+
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alternate := md5.New()
+	alternate.Write(pw)
+	alternate.Write([]byte(salt))
+	alternate.Write(pw)
+	alternateSum := alternate.Sum(nil)
+
+	digest := md5.New()
+	digest.Write(pw)
+	digest.Write([]byte(magic))
+	digest.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		digest.Write(alternateSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write(pw[:1])
+		}
+	}
+	final := digest.Sum(nil)
+
+	// 1000 rounds to slow down brute force attacks
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 == 1 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	var encoded strings.Builder
+	to64 := func(value uint32, length int) {
+		for ; length > 0; length-- {
+			encoded.WriteByte(cryptAlphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+
+	return magic + salt + "$" + encoded.String()
+}
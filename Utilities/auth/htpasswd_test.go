@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The password of both users is "secret"
+const testHtpasswd = "alice:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"
+
+// writeFile writes content to a file of a temporary folder and returns its name
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		users   int
+		wantErr string
+	}{
+		{"MD5 & SHA-1", testHtpasswd, 2, ""},
+		{"comments & empty lines", "# users\n\n" + testHtpasswd, 2, ""},
+		{"bcrypt", "carol:$2y$05$c4WoMPo3SXsafkva.HHa6uXQZWr7oboPiC2bT/r7q1BB8I2s0BRqC\n", 0, "unsupported hash"},
+		{"plain text", "carol:secret\n", 0, "unsupported hash"},
+		{"crypt", "carol:rqXexS6ZhobKA\n", 0, "unsupported hash"},
+		{"no hash", "carol:\n", 0, "the format is user:hash"},
+		{"no separator", "carol\n", 0, "the format is user:hash"},
+		{"no users", "# no users\n", 0, "no users found"},
+	}
+
+	for _, test := range tests {
+		users, err := loadHtpasswd(writeFile(t, "htpasswd", test.content))
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s. loadHtpasswd() = %v, want no error", test.name, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s. loadHtpasswd() = %v, want an error containing %q", test.name, err, test.wantErr)
+		case len(users) != test.users:
+			t.Errorf("%s. loadHtpasswd() = %d users, want %d", test.name, len(users), test.users)
+		}
+	}
+
+	if _, err := loadHtpasswd(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("loadHtpasswd() of a missing file = no error, want an error")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+
+	authenticator, err := New(Config{Mode: ModeHtpasswd, HtpasswdFile: writeFile(t, "htpasswd", testHtpasswd)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user     string
+		password string
+		want     bool
+	}{
+		{"alice", "secret", true},
+		{"alice", "Secret", false},
+		{"alice", "", false},
+		{"bob", "secret", true},
+		{"bob", "secret ", false},
+		{"carol", "secret", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		if got := authenticator.checkPassword(test.user, test.password); got != test.want {
+			t.Errorf("checkPassword(%q, %q) = %v, want %v", test.user, test.password, got, test.want)
+		}
+	}
+}
+
+func TestAPR1(t *testing.T) {
+
+	// Generated with htpasswd -m (salts longer than 8 characters are truncated)
+	tests := []struct {
+		password string
+		salt     string
+		want     string
+	}{
+		{"secret", "abcdefgh", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/"},
+		{"secret", "abcdefghij", "$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/"},
+	}
+
+	for _, test := range tests {
+		if got := apr1(test.password, test.salt); got != test.want {
+			t.Errorf("apr1(%q, %q) = %q, want %q", test.password, test.salt, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package mockidp is a local OpenID Connect provider used to test the OIDC login. Any user name is accepted, do not use it in production
+// The user is entered in a form, or sent with the login_hint parameter (the login is then automatic)
+// Written by Jason Vicinanza
+
+package mockidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ID of the signing key
+const keyID = "mockidp"
+
+// Lifetime of the ID tokens
+const tokenLifetime = time.Hour
+
+// IdP is the mock provider. Issuer must be the URL the provider is served from
+type IdP struct {
+	Issuer string
+
+	key   *rsa.PrivateKey
+	mux   *http.ServeMux
+	mutex sync.Mutex
+	codes map[string]grant
+}
+
+// grant is a login waiting for the code to be exchanged
+type grant struct {
+	user        string
+	clientID    string
+	redirectURI string
+	nonce       string
+}
+
+// New returns a provider with a new signing key
+func New(issuer string) (*IdP, error) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	idp := &IdP{Issuer: issuer, key: key, mux: http.NewServeMux(), codes: make(map[string]grant)}
+	idp.mux.HandleFunc("GET /.well-known/openid-configuration", idp.discoveryHandler)
+	idp.mux.HandleFunc("GET /jwks", idp.jwksHandler)
+	idp.mux.HandleFunc("GET /authorize", idp.authorizeHandler)
+	idp.mux.HandleFunc("POST /authorize", idp.authorizeHandler)
+	idp.mux.HandleFunc("POST /token", idp.tokenHandler)
+
+	return idp, nil
+}
+
+func (idp *IdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idp.mux.ServeHTTP(w, r)
+}
+
+func (idp *IdP) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                idp.Issuer,
+		"authorization_endpoint":                idp.Issuer + "/authorize",
+		"token_endpoint":                        idp.Issuer + "/token",
+		"jwks_uri":                              idp.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *IdP) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorizeHandler displays the login form, or redirects to the client with a code when the user is known
+func (idp *IdP) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := r.Form.Get("redirect_uri")
+	if r.Form.Get("response_type") != "code" || r.Form.Get("client_id") == "" || redirectURI == "" {
+		http.Error(w, "response_type=code, client_id and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+
+	user := r.Form.Get("user")
+	if user == "" {
+		user = r.Form.Get("login_hint")
+	}
+	if user == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fields := ""
+		for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce"} {
+			fields += fmt.Sprintf("<input type='hidden' name='%s' value='%s'>\n", name, html.EscapeString(r.Form.Get(name)))
+		}
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>Mock IdP</title></head>
+<body style="font-family: Arial, sans-serif; text-align: center; margin-top: 100px;">
+<h3>Mock IdP. Log in as</h3>
+<form method="post" action="/authorize">
+%s<input type="text" name="user" placeholder="user@example.com" autofocus>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>`, fields)
+		return
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, "Cannot generate the code", http.StatusInternalServerError)
+		return
+	}
+	idp.mutex.Lock()
+	idp.codes[code] = grant{user: user, clientID: r.Form.Get("client_id"), redirectURI: redirectURI, nonce: r.Form.Get("nonce")}
+	idp.mutex.Unlock()
+	slog.Info("Mock IdP login", "user", user, "clientID", r.Form.Get("client_id"))
+
+	callback, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := callback.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	callback.RawQuery = query.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// tokenHandler exchanges a code for a signed ID token. Codes can only be used once
+func (idp *IdP) tokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	code := r.Form.Get("code")
+	idp.mutex.Lock()
+	login, found := idp.codes[code]
+	delete(idp.codes, code)
+	idp.mutex.Unlock()
+
+	clientID := r.Form.Get("client_id")
+	if basicClientID, _, ok := r.BasicAuth(); ok {
+		clientID = basicClientID
+	}
+	if !found || login.clientID != clientID || login.redirectURI != r.Form.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := idp.sign(map[string]any{
+		"iss":   idp.Issuer,
+		"sub":   login.user,
+		"email": login.user,
+		"name":  login.user,
+		"aud":   login.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+		"nonce": login.nonce,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := randomString()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// sign returns a JWT signed with RS256
+func (idp *IdP) sign(claims map[string]any) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("mockidp. Cannot write response", "error", err)
+	}
+}
+
+func randomString() (string, error) {
+	value := make([]byte, 16)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
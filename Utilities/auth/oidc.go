@@ -0,0 +1,369 @@
+// auth. OpenID Connect login. Authorization code flow, the ID token is verified with the keys of the provider (RS256)
+// Written by Jason Vicinanza
+
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lifetime of the state cookie set during the login
+const stateLifetime = 10 * time.Minute
+
+// oidcProvider reads the provider endpoints & keys when they are first needed
+type oidcProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mutex     sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// oidcDiscovery is the content of /.well-known/openid-configuration
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// jwks is the content of the jwks_uri
+type jwks struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+func newOIDCProvider(config OIDCConfig) *oidcProvider {
+	return &oidcProvider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// loginHandler handles GET /auth/login. Redirects to the provider, the page requested is kept in the state cookie
+func (a *Authenticator) loginHandler(w http.ResponseWriter, r *http.Request) {
+
+	discovery, err := a.oidc.discover()
+	if err != nil {
+		slog.Error("loginHandler. Cannot read the OIDC provider configuration", "error", err)
+		http.Error(w, "The login provider cannot be reached", http.StatusBadGateway)
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		slog.Error("loginHandler. Cannot generate the state", "error", err)
+		http.Error(w, "Cannot log in", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		slog.Error("loginHandler. Cannot generate the nonce", "error", err)
+		http.Error(w, "Cannot log in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.config.CookieName + "_state",
+		Value:    a.sign(state + "|" + nonce + "|" + localPath(r.URL.Query().Get("next"))),
+		Path:     "/auth/",
+		MaxAge:   int(stateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   a.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", a.config.OIDC.ClientID)
+	query.Set("redirect_uri", a.config.OIDC.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	http.Redirect(w, r, discovery.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// callbackHandler handles GET /auth/callback. The code is exchanged for the ID token, the login cookie is then set
+func (a *Authenticator) callbackHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Set by loginHandler
+	stateCookie, err := r.Cookie(a.config.CookieName + "_state")
+	if err != nil {
+		http.Error(w, "The login has expired, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: a.config.CookieName + "_state", Path: "/auth/", MaxAge: -1})
+
+	value, err := a.verify(stateCookie.Value)
+	parts := strings.SplitN(value, "|", 3)
+	if err != nil || len(parts) != 3 || parts[0] != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid login state, please try again", http.StatusBadRequest)
+		return
+	}
+	nonce, next := parts[1], parts[2]
+
+	if providerError := r.URL.Query().Get("error"); providerError != "" {
+		slog.Warn("callbackHandler. Login refused by the provider", "error", providerError)
+		http.Error(w, "Login refused: "+providerError, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := a.oidc.exchange(r.URL.Query().Get("code"), nonce)
+	if err != nil {
+		slog.Error("callbackHandler. Login failed", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	expiry := time.Now().Add(a.config.SessionLifetime)
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.config.CookieName,
+		Value:    a.sign(user + "|" + strconv.FormatInt(expiry.Unix(), 10)),
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   a.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	slog.Info("User logged in", "user", user)
+
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// logoutHandler handles GET /auth/logout
+func (a *Authenticator) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: a.config.CookieName, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// secureCookies is true when the tool is served over HTTPS
+func (a *Authenticator) secureCookies() bool {
+	return strings.HasPrefix(a.config.OIDC.RedirectURL, "https://")
+}
+
+// localPath only keeps the paths of the server, to prevent redirections to other sites after the login
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// discover reads the provider endpoints
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("the provider issuer %q does not match %q", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("the provider configuration is incomplete")
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// exchange sends the code to the token endpoint and returns the user of the ID token
+func (p *oidcProvider) exchange(code string, nonce string) (string, error) {
+
+	if code == "" {
+		return "", errors.New("no code")
+	}
+	discovery, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("client_secret", p.config.ClientSecret)
+
+	res, err := p.client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return "", fmt.Errorf("cannot reach the token endpoint: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint status %d", res.StatusCode)
+	}
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+
+	claims, err := p.verifyIDToken(tokenResponse.IDToken, discovery)
+	if err != nil {
+		return "", err
+	}
+	if claims["nonce"] != nonce {
+		return "", errors.New("invalid nonce")
+	}
+
+	user, _ := claims[p.config.UserClaim].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if user == "" {
+		return "", errors.New("no user in the ID token")
+	}
+	return user, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience & expiry of the ID token and returns its claims
+func (p *oidcProvider) verifyIDToken(idToken string, discovery *oidcDiscovery) (map[string]any, error) {
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the ID token is not a JWT")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm %s", header.Algorithm)
+	}
+
+	key, err := p.key(header.KeyID, discovery)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(discovery.Issuer, "/") {
+		return nil, errors.New("invalid ID token issuer")
+	}
+	if !audienceIncludes(claims["aud"], p.config.ClientID) {
+		return nil, errors.New("invalid ID token audience")
+	}
+	if expiry, _ := claims["exp"].(float64); time.Now().Unix() >= int64(expiry) {
+		return nil, errors.New("the ID token has expired")
+	}
+
+	return claims, nil
+}
+
+// key returns a key of the provider. The keys are read again when the key is unknown (key rotation)
+func (p *oidcProvider) key(keyID string, discovery *oidcDiscovery) (*rsa.PublicKey, error) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key, found := p.keys[keyID]; found {
+		return key, nil
+	}
+
+	var keySet jwks
+	if err := p.getJSON(discovery.JWKSURI, &keySet); err != nil {
+		return nil, err
+	}
+
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		p.keys[jwk.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+	}
+
+	if key, found := p.keys[keyID]; found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown ID token key %q", keyID)
+}
+
+func (p *oidcProvider) getJSON(url string, target any) error {
+	res, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(target)
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string, target any) error {
+	content, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("invalid ID token encoding")
+	}
+	if err := json.Unmarshal(content, target); err != nil {
+		return errors.New("invalid ID token content")
+	}
+	return nil
+}
+
+// audienceIncludes checks the aud claim, a string or a list
+func audienceIncludes(audience any, clientID string) bool {
+	switch audience := audience.(type) {
+	case string:
+		return audience == clientID
+	case []any:
+		for _, value := range audience {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"goquery/auth/mockidp"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newTestIdP starts a mock OIDC provider
+func newTestIdP(t *testing.T) (*mockidp.IdP, *httptest.Server) {
+	t.Helper()
+	idp, err := mockidp.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(idp)
+	t.Cleanup(server.Close)
+	idp.Issuer = server.URL
+	return idp, server
+}
+
+// newOIDCAuthenticator returns an authenticator using the provider & its login endpoints
+func newOIDCAuthenticator(t *testing.T, issuer string) (*Authenticator, *http.ServeMux) {
+	t.Helper()
+	authenticator, err := New(Config{Mode: ModeOIDC, CookieName: "login", Secret: []byte("test-secret"), OIDC: OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     "client",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/auth/callback",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	authenticator.RegisterHandlers(mux)
+	return authenticator, mux
+}
+
+// noRedirect returns the redirections instead of following them
+var noRedirect = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}}
+
+func TestOIDCCallback(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		state       string // Replaces the state returned by the provider
+		nonce       string // Replaces the nonce sent to the provider
+		code        string // Replaces the code returned by the provider
+		tokenIssuer string // Issuer of the ID token, replaces the provider issuer once the endpoints are read
+		noCookie    bool   // The state cookie is not sent
+		want        int
+	}{
+		{name: "valid", want: http.StatusFound},
+		{name: "state mismatch", state: "other-state", want: http.StatusBadRequest},
+		{name: "no state", state: " ", want: http.StatusBadRequest},
+		{name: "no state cookie", noCookie: true, want: http.StatusBadRequest},
+		{name: "nonce mismatch", nonce: "other-nonce", want: http.StatusUnauthorized},
+		{name: "issuer mismatch", tokenIssuer: "http://other-idp.example.com", want: http.StatusUnauthorized},
+		{name: "invalid code", code: "other-code", want: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			idp, idpServer := newTestIdP(t)
+			authenticator, mux := newOIDCAuthenticator(t, idpServer.URL)
+
+			// Login. Redirects to the provider with the state & nonce
+			login := httptest.NewRecorder()
+			mux.ServeHTTP(login, httptest.NewRequest("GET", "/auth/login?next=/results", nil))
+			if login.Code != http.StatusFound {
+				t.Fatalf("GET /auth/login = %d, want %d", login.Code, http.StatusFound)
+			}
+			authorize, err := url.Parse(login.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := authorize.Query()
+			query.Set("login_hint", "alice@example.com")
+			if test.nonce != "" {
+				query.Set("nonce", test.nonce)
+			}
+			authorize.RawQuery = query.Encode()
+
+			// The provider redirects to the callback with the code & state
+			res, err := noRedirect.Get(authorize.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			callback, err := url.Parse(res.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query = callback.Query()
+			if test.state != "" {
+				query.Set("state", test.state)
+			}
+			if test.code != "" {
+				query.Set("code", test.code)
+			}
+			callback.RawQuery = query.Encode()
+			if test.tokenIssuer != "" {
+				idp.Issuer = test.tokenIssuer
+			}
+
+			request := httptest.NewRequest("GET", callback.RequestURI(), nil)
+			if !test.noCookie {
+				for _, cookie := range login.Result().Cookies() {
+					request.AddCookie(cookie)
+				}
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+			if recorder.Code != test.want {
+				t.Fatalf("GET /auth/callback = %d, want %d. %s", recorder.Code, test.want, recorder.Body.String())
+			}
+
+			// The login cookie is only set when the login succeeds
+			identified := httptest.NewRequest("GET", "/", nil)
+			for _, cookie := range recorder.Result().Cookies() {
+				identified.AddCookie(cookie)
+			}
+			user, ok := authenticator.Identify(identified)
+			if ok != (test.want == http.StatusFound) {
+				t.Errorf("Identify() after the callback = %q, %v, want logged in %v", user, ok, test.want == http.StatusFound)
+			}
+			if ok && (user != "alice@example.com" || recorder.Header().Get("Location") != "/results") {
+				t.Errorf("callback = user %q, redirected to %q, want alice@example.com & /results", user, recorder.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+
+	// The provider configuration must be served by the issuer
+	idp, idpServer := newTestIdP(t)
+	idp.Issuer = "http://other-idp.example.com"
+	_, mux := newOIDCAuthenticator(t, idpServer.URL)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/auth/login", nil))
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("GET /auth/login with an issuer mismatch = %d, want %d", recorder.Code, http.StatusBadGateway)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"/results?id=1", "/results?id=1"},
+		{"", "/"},
+		{"https://example.com/", "/"},
+		{"//example.com/", "/"},
+		{"/\\example.com/", "/"},
+	}
+
+	for _, test := range tests {
+		if got := localPath(test.next); got != test.want {
+			t.Errorf("localPath(%q) = %q, want %q", test.next, got, test.want)
+		}
+	}
+}
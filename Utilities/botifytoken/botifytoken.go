@@ -0,0 +1,147 @@
+// Package botifytoken selects the Botify API token used for a request
+// The token of the server can be used for every visitor, or each user provides their own token (form, header or signed cookie set by a proxy)
+// Written by Jason Vicinanza
+
+package botifytoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Token modes
+const (
+	ModeServer = "server" // The token of the server (envBotifyAPIToken) is used for every visitor
+	ModeUser   = "user"   // The users enter their own token in the form, or send it in the Authorization header (JSON API)
+	ModeProxy  = "proxy"  // The token is set by a fronting proxy, in a header or in a signed cookie
+)
+
+// Default names of the form field, header & cookie containing the token
+const (
+	DefaultFormField = "botifyToken"
+	DefaultHeader    = "X-Botify-Token"
+	DefaultCookie    = "botify_token"
+)
+
+// The request does not include a token
+var ErrNoToken = errors.New("a Botify token is required")
+
+// The signed cookie has been modified, or was not signed with the secret of the server
+var ErrInvalidCookie = errors.New("the Botify token cookie is invalid")
+
+// Config defines where the token of a request comes from
+type Config struct {
+	Mode         string
+	ServerToken  string // Server mode
+	FormField    string // User mode
+	Header       string // Proxy mode
+	Cookie       string // Proxy mode
+	CookieSecret []byte // Proxy mode. The cookie is ignored when no secret is set
+}
+
+// NewConfig returns the configuration of a mode using the default field, header & cookie names
+func NewConfig(mode, serverToken string, cookieSecret []byte) Config {
+	return Config{
+		Mode:         mode,
+		ServerToken:  serverToken,
+		FormField:    DefaultFormField,
+		Header:       DefaultHeader,
+		Cookie:       DefaultCookie,
+		CookieSecret: cookieSecret,
+	}
+}
+
+// ParseMode validates a token mode. An empty mode is the server mode
+func ParseMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", ModeServer:
+		return ModeServer, nil
+	case ModeUser:
+		return ModeUser, nil
+	case ModeProxy:
+		return ModeProxy, nil
+	}
+	return ModeServer, fmt.Errorf("invalid token mode %q, use server, user or proxy", mode)
+}
+
+// PerUser reports whether the token comes from the request rather than from the server
+func (c Config) PerUser() bool {
+	return c.Mode == ModeUser || c.Mode == ModeProxy
+}
+
+// FromRequest returns the token to use for a request. The form must have been parsed in user mode
+func (c Config) FromRequest(r *http.Request) (string, error) {
+
+	var token string
+	switch c.Mode {
+	case ModeUser:
+		token = authorizationToken(r)
+		if token == "" && r.Form != nil {
+			token = r.Form.Get(c.FormField)
+		}
+	case ModeProxy:
+		token = r.Header.Get(c.Header)
+		if token == "" && len(c.CookieSecret) > 0 {
+			if cookie, err := r.Cookie(c.Cookie); err == nil {
+				verified, err := VerifyCookie(cookie.Value, c.CookieSecret)
+				if err != nil {
+					return "", err
+				}
+				token = verified
+			}
+		}
+	default:
+		token = c.ServerToken
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// authorizationToken returns the token of an "Authorization: token ..." (Botify format) or "Authorization: Bearer ..." header
+func authorizationToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !(strings.EqualFold(scheme, "token") || strings.EqualFold(scheme, "bearer")) {
+		return ""
+	}
+	return token
+}
+
+// SignCookie returns the value of the cookie set by the proxy: the token & its HMAC-SHA256 signature, base64url encoded, separated by "."
+func SignCookie(token string, secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(token)) + "." + base64.RawURLEncoding.EncodeToString(signature(token, secret))
+}
+
+// VerifyCookie returns the token of a cookie signed with SignCookie
+func VerifyCookie(value string, secret []byte) (string, error) {
+	encodedToken, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return "", ErrInvalidCookie
+	}
+	token, err := base64.RawURLEncoding.DecodeString(encodedToken)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	cookieSignature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	if !hmac.Equal(cookieSignature, signature(string(token), secret)) {
+		return "", ErrInvalidCookie
+	}
+	return string(token), nil
+}
+
+func signature(token string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,142 @@
+package botifytoken
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{"", ModeServer, false},
+		{"server", ModeServer, false},
+		{" User ", ModeUser, false},
+		{"PROXY", ModeProxy, false},
+		{"cookie", ModeServer, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMode(test.mode)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q, error %t", test.mode, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestPerUser(t *testing.T) {
+
+	modes := map[string]bool{ModeServer: false, ModeUser: true, ModeProxy: true, "": false}
+	for mode, want := range modes {
+		if got := NewConfig(mode, "server-token", nil).PerUser(); got != want {
+			t.Errorf("PerUser() in mode %q = %t, want %t", mode, got, want)
+		}
+	}
+}
+
+// tokenRequest returns a request including a token in the form, the Authorization header, the proxy header & the cookie (empty values are not set)
+func tokenRequest(t *testing.T, form string, authorization string, header string, cookie string) *http.Request {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader(url.Values{DefaultFormField: {form}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	if header != "" {
+		request.Header.Set(DefaultHeader, header)
+	}
+	if cookie != "" {
+		request.AddCookie(&http.Cookie{Name: DefaultCookie, Value: cookie})
+	}
+	if err := request.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestFromRequest(t *testing.T) {
+
+	secret := []byte("test-cookie-secret")
+	signedCookie := SignCookie("cookie-token", secret)
+
+	tests := []struct {
+		name    string
+		mode    string
+		secret  []byte
+		request *http.Request
+		want    string
+		wantErr error
+	}{
+		// Server mode. The token of the server, whatever the request
+		{"server", ModeServer, nil, tokenRequest(t, "", "", "", ""), "server-token", nil},
+		{"server ignores the request", ModeServer, secret, tokenRequest(t, "form-token", "token header-token", "proxy-token", signedCookie), "server-token", nil},
+
+		// User mode. The Authorization header (JSON API), then the form
+		{"user form", ModeUser, nil, tokenRequest(t, "form-token", "", "", ""), "form-token", nil},
+		{"user form trimmed", ModeUser, nil, tokenRequest(t, " form-token\n", "", "", ""), "form-token", nil},
+		{"user Authorization token", ModeUser, nil, tokenRequest(t, "", "token header-token", "", ""), "header-token", nil},
+		{"user Authorization bearer", ModeUser, nil, tokenRequest(t, "", "Bearer header-token", "", ""), "header-token", nil},
+		{"user Authorization before the form", ModeUser, nil, tokenRequest(t, "form-token", "token header-token", "", ""), "header-token", nil},
+		{"user Authorization scheme ignored", ModeUser, nil, tokenRequest(t, "form-token", "Basic YWxpY2U6c2VjcmV0", "", ""), "form-token", nil},
+		{"user ignores the proxy", ModeUser, secret, tokenRequest(t, "", "", "proxy-token", signedCookie), "", ErrNoToken},
+		{"user without token", ModeUser, nil, tokenRequest(t, "  ", "", "", ""), "", ErrNoToken},
+
+		// Proxy mode. The header, then the signed cookie
+		{"proxy header", ModeProxy, secret, tokenRequest(t, "", "", "proxy-token", ""), "proxy-token", nil},
+		{"proxy cookie", ModeProxy, secret, tokenRequest(t, "", "", "", signedCookie), "cookie-token", nil},
+		{"proxy header before the cookie", ModeProxy, secret, tokenRequest(t, "", "", "proxy-token", signedCookie), "proxy-token", nil},
+		{"proxy cookie without secret", ModeProxy, nil, tokenRequest(t, "", "", "", signedCookie), "", ErrNoToken},
+		{"proxy cookie of another secret", ModeProxy, secret, tokenRequest(t, "", "", "", SignCookie("cookie-token", []byte("another-secret"))), "", ErrInvalidCookie},
+		{"proxy ignores the form", ModeProxy, secret, tokenRequest(t, "form-token", "token header-token", "", ""), "", ErrNoToken},
+	}
+
+	for _, test := range tests {
+		got, err := NewConfig(test.mode, "server-token", test.secret).FromRequest(test.request)
+		if got != test.want || !errors.Is(err, test.wantErr) {
+			t.Errorf("%s. FromRequest() = %q, %v, want %q, %v", test.name, got, err, test.want, test.wantErr)
+		}
+	}
+
+	// Server mode without a server token
+	if _, err := NewConfig(ModeServer, "", nil).FromRequest(tokenRequest(t, "form-token", "", "", "")); !errors.Is(err, ErrNoToken) {
+		t.Errorf("FromRequest() without server token = %v, want %v", err, ErrNoToken)
+	}
+}
+
+func TestVerifyCookie(t *testing.T) {
+
+	secret := []byte("test-cookie-secret")
+	signedCookie := SignCookie("token.with.dots", secret)
+	encodedToken, encodedSignature, _ := strings.Cut(signedCookie, ".")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"signed", signedCookie, "token.with.dots", nil},
+		{"other secret", SignCookie("token.with.dots", []byte("another-secret")), "", ErrInvalidCookie},
+		{"modified token", base64.RawURLEncoding.EncodeToString([]byte("another-token")) + "." + encodedSignature, "", ErrInvalidCookie},
+		{"no signature", encodedToken, "", ErrInvalidCookie},
+		{"empty signature", encodedToken + ".", "", ErrInvalidCookie},
+		{"not base64", "token!." + encodedSignature, "", ErrInvalidCookie},
+		{"empty", "", "", ErrInvalidCookie},
+	}
+
+	for _, test := range tests {
+		got, err := VerifyCookie(test.value, secret)
+		if got != test.want || !errors.Is(err, test.wantErr) {
+			t.Errorf("%s. VerifyCookie(%q) = %q, %v, want %q, %v", test.name, test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// logging. Colour output used when running locally. One line per record: time, level, session ID, message & attributes
+// Written by Jason Vicinanza
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Colours & text formatting
+const (
+	purple = "\033[0;35m"
+	red    = "\033[0;31m"
+	green  = "\033[0;32m"
+	yellow = "\033[0;33m"
+	grey   = "\033[0;90m"
+	reset  = "\033[0m"
+)
+
+// colourHandler writes the records for a terminal
+type colourHandler struct {
+	out    io.Writer
+	mutex  *sync.Mutex
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // Group of the attributes added, e.g. "request."
+}
+
+func newColourHandler(out io.Writer, level slog.Leveler) *colourHandler {
+	return &colourHandler{out: out, mutex: &sync.Mutex{}, level: level}
+}
+
+func (h *colourHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *colourHandler) Handle(_ context.Context, record slog.Record) error {
+
+	var builder strings.Builder
+	builder.WriteString(grey + record.Time.Format("15:04:05") + reset + " ")
+	builder.WriteString(levelColour(record.Level) + fmt.Sprintf("%-5s", record.Level.String()) + reset + " ")
+
+	// The session ID is displayed before the message, as in the console output of the previous versions
+	attrs := append([]slog.Attr{}, h.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attr.Key = h.prefix + attr.Key
+		attrs = append(attrs, attr)
+		return true
+	})
+	for _, attr := range attrs {
+		if attr.Key == "sessionID" {
+			builder.WriteString(yellow + attr.Value.String() + reset + " ")
+		}
+	}
+
+	builder.WriteString(record.Message)
+	for _, attr := range attrs {
+		if attr.Key != "sessionID" {
+			writeAttr(&builder, "", attr)
+		}
+	}
+	builder.WriteString("\n")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := io.WriteString(h.out, builder.String())
+	return err
+}
+
+func (h *colourHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		handler.attrs = append(handler.attrs, attr)
+	}
+	return &handler
+}
+
+func (h *colourHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handler := *h
+	handler.prefix = h.prefix + name + "."
+	return &handler
+}
+
+// writeAttr writes key=value, the groups are flattened
+func writeAttr(builder *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, groupAttr := range attr.Value.Group() {
+			writeAttr(builder, prefix+attr.Key+".", groupAttr)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	builder.WriteString(" " + purple + prefix + attr.Key + "=" + reset + value)
+}
+
+func levelColour(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return red
+	case level >= slog.LevelWarn:
+		return yellow
+	case level >= slog.LevelInfo:
+		return green
+	}
+	return grey
+}
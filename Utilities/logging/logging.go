@@ -0,0 +1,55 @@
+// Package logging configures the structured logs (log/slog) of the go_seo servers
+// JSON output when hosted in a container, colour output when running locally. The secrets (e.g. the API token) are redacted
+// Written by Jason Vicinanza
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup installs the default logger. hostingMode is "local" (colour output) or "docker" (JSON output)
+// level is debug, info, warn or error. Returns an error if the level is invalid, info is then used
+func Setup(hostingMode, level string) error {
+	return SetupWriter(os.Stdout, hostingMode, level)
+}
+
+// SetupWriter installs the default logger writing to out
+func SetupWriter(out io.Writer, hostingMode, level string) error {
+
+	logLevel, err := ParseLevel(level)
+
+	var handler slog.Handler
+	if hostingMode == "local" {
+		handler = newColourHandler(out, logLevel)
+	} else {
+		handler = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
+	}
+	slog.SetDefault(slog.New(&redactHandler{handler}))
+
+	return err
+}
+
+// ParseLevel returns the log level named. An empty name is info
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+}
+
+// Session returns a logger adding the session ID, organisation & project to every line
+func Session(sessionID, organisation, project string) *slog.Logger {
+	return slog.Default().With("sessionID", sessionID, "organisation", organisation, "project", project)
+}
@@ -0,0 +1,122 @@
+// logging. Redaction of the secrets. The values registered with Redact never appear in the logs
+// Written by Jason Vicinanza
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Replaces the secrets in the logs
+const redacted = "[REDACTED]"
+
+// The secrets registered
+var (
+	secretsMutex sync.RWMutex
+	secrets      []string
+)
+
+// Redact registers a secret (e.g. an API token). It is replaced in the messages & the attribute values
+func Redact(secret string) {
+	if secret == "" {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, known := range secrets {
+		if known == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// Forget removes a secret registered with Redact, e.g. the token of a user when the session ends
+func Forget(secret string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for i, known := range secrets {
+		if known == secret {
+			secrets = append(secrets[:i], secrets[i+1:]...)
+			return
+		}
+	}
+}
+
+// RedactString replaces the secrets in a string
+func RedactString(text string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+// sensitiveKey reports the attributes whose value is always redacted, whatever the value
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "token") || strings.Contains(key, "authorization") || strings.Contains(key, "password") || strings.Contains(key, "secret")
+}
+
+// redactHandler removes the secrets before the records are written by the handler it wraps
+type redactHandler struct {
+	next slog.Handler
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redactedRecord := slog.NewRecord(record.Time, record.Level, RedactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redactedRecord.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redactedAttrs[i] = redactAttr(attr)
+	}
+	return &redactHandler{h.next.WithAttrs(redactedAttrs)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h.next.WithGroup(name)}
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+
+	if sensitiveKey(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		redactedGroup := make([]any, len(group))
+		for i, groupAttr := range group {
+			redactedGroup[i] = redactAttr(groupAttr)
+		}
+		return slog.Group(attr.Key, redactedGroup...)
+	case slog.KindAny:
+		// Errors & other values are written as text when they include a secret
+		text := fmt.Sprint(attr.Value.Any())
+		if redactedText := RedactString(text); redactedText != text {
+			return slog.String(attr.Key, redactedText)
+		}
+	}
+
+	return attr
+}
@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+
+	Redact("server-token")
+	Redact("user-token")
+	Redact("user-token")
+	Redact("")
+	t.Cleanup(func() {
+		Forget("server-token")
+		Forget("user-token")
+	})
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no secret", "no secret"},
+		{"token server-token used", "token [REDACTED] used"},
+		{"user-token, user-token & server-token", "[REDACTED], [REDACTED] & [REDACTED]"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := RedactString(test.text); got != test.want {
+			t.Errorf("RedactString(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+
+	// The token of a user is no longer redacted when the session ends. The other secrets still are
+	Forget("user-token")
+	Forget("unknown-token")
+	if got := RedactString("user-token & server-token"); got != "user-token & [REDACTED]" {
+		t.Errorf("RedactString() after Forget = %q, want the user token only", got)
+	}
+}
+
+func TestRedactHandler(t *testing.T) {
+
+	Redact("secret-value")
+	t.Cleanup(func() { Forget("secret-value") })
+
+	var output bytes.Buffer
+	previousLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previousLogger) })
+	if err := SetupWriter(&output, "docker", "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.Default().With("session", "with secret-value")
+	logger.Info("message with secret-value",
+		"url", "https://api.botify.com/?key=secret-value",
+		"error", errors.New("call failed with secret-value"),
+		"Authorization", "not registered",
+		slog.Group("request", "apiToken", "not registered", "count", 3),
+	)
+
+	logged := output.String()
+	if strings.Contains(logged, "secret-value") || strings.Contains(logged, "not registered") {
+		t.Errorf("the secrets are written to the logs: %s", logged)
+	}
+	for _, want := range []string{`"msg":"message with [REDACTED]"`, `"session":"with [REDACTED]"`, `"error":"call failed with [REDACTED]"`,
+		`"Authorization":"[REDACTED]"`, `"request":{"apiToken":"[REDACTED]","count":3}`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("logs = %s, want %s", logged, want)
+		}
+	}
+}
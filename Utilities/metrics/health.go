@@ -0,0 +1,60 @@
+// metrics. Health endpoints. /healthz reports that the server is running, /readyz that it can process requests
+// Written by Jason Vicinanza
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Check is a readiness check. A nil error means ready
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// Healthz responds OK as long as the server is running. Used as the liveness probe
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// Readyz runs the readiness checks. Responds 503 listing the failed checks when one of them fails
+func Readyz(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var builder strings.Builder
+		status := http.StatusOK
+		for _, check := range checks {
+			if err := check.Check(); err != nil {
+				status = http.StatusServiceUnavailable
+				builder.WriteString(fmt.Sprintf("%s: %v\n", check.Name, err))
+				continue
+			}
+			builder.WriteString(check.Name + ": ok\n")
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(builder.String()))
+	}
+}
+
+// FolderWritable checks that a file can be created in an existing folder. The folder is not created, the health checks do not change the state of the server
+func FolderWritable(folder string) error {
+	info, err := os.Stat(folder)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", folder)
+	}
+	file, err := os.CreateTemp(folder, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFolderWritable(t *testing.T) {
+
+	folder := t.TempDir()
+	file := filepath.Join(folder, "file")
+	if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		folder  string
+		wantErr bool
+	}{
+		{"existing folder", folder, false},
+		{"missing folder", filepath.Join(folder, "missing"), true},
+		{"missing parent folder", filepath.Join(folder, "missing", "cache"), true},
+		{"file", file, true},
+	}
+
+	for _, test := range tests {
+		if err := FolderWritable(test.folder); (err != nil) != test.wantErr {
+			t.Errorf("%s. FolderWritable() = %v, want error %t", test.name, err, test.wantErr)
+		}
+	}
+
+	// The check does not create the missing folders & leaves no file behind
+	if _, err := os.Stat(filepath.Join(folder, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("FolderWritable() created the missing folder: %v", err)
+	}
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("FolderWritable() left %d files in the folder, want 1", len(entries))
+	}
+}
+
+func TestReadyz(t *testing.T) {
+
+	ok := Check{Name: "cache folder", Check: func() error { return nil }}
+	failed := Check{Name: "token", Check: func() error { return errors.New("not set") }}
+
+	tests := []struct {
+		name   string
+		checks []Check
+		status int
+		body   string
+	}{
+		{"no checks", nil, http.StatusOK, ""},
+		{"ready", []Check{ok}, http.StatusOK, "cache folder: ok\n"},
+		{"check failed", []Check{ok, failed}, http.StatusServiceUnavailable, "cache folder: ok\ntoken: not set\n"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		Readyz(test.checks...)(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Errorf("%s. Readyz() = %d %q, want %d %q", test.name, recorder.Code, recorder.Body.String(), test.status, test.body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	Healthz(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != "ok" {
+		t.Errorf("Healthz() = %d %q, want %d ok", recorder.Code, recorder.Body.String(), http.StatusOK)
+	}
+}
@@ -0,0 +1,89 @@
+// metrics. HTTP instrumentation. The requests served & the API calls made by the servers
+// Written by Jason Vicinanza
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Instrument counts the requests served by a mux, by route pattern & status code
+// The route pattern (e.g. "GET /sessions/{sessionID}/{file}") is used rather than the path to keep the number of series small
+func Instrument(mux *http.ServeMux, requests *Counter, duration *Histogram) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		started := time.Now()
+		mux.ServeHTTP(recorder, r)
+
+		requests.Inc(route, strconv.Itoa(recorder.status))
+		duration.Observe(time.Since(started).Seconds(), route)
+	})
+}
+
+// statusRecorder keeps the status code sent by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush is used by the handlers streaming their response
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Transport records the calls made to an API: count by endpoint & status code, latency & errors by endpoint
+// Transport errors are counted with the status code "error". Responses with a status code of 400 and above are errors
+type Transport struct {
+	Base     http.RoundTripper // http.DefaultTransport when nil
+	Endpoint func(*http.Request) string
+	Requests *Counter
+	Duration *Histogram
+	Errors   *Counter
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	endpoint := t.Endpoint(req)
+
+	started := time.Now()
+	res, err := base.RoundTrip(req)
+	t.Duration.Observe(time.Since(started).Seconds(), endpoint)
+
+	if err != nil {
+		t.Requests.Inc(endpoint, "error")
+		t.Errors.Inc(endpoint)
+		return res, err
+	}
+
+	t.Requests.Inc(endpoint, strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= 400 {
+		t.Errors.Inc(endpoint)
+	}
+	return res, nil
+}
@@ -0,0 +1,254 @@
+// Package metrics exposes the metrics of the go_seo servers in the Prometheus text format
+// Counters, histograms & gauges are registered in a single registry served by Handler
+// Written by Jason Vicinanza
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default histogram buckets, in seconds
+var (
+	RequestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	APIBuckets     = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	SessionBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200}
+)
+
+// The metrics in registration order
+var (
+	registryMutex sync.Mutex
+	registry      []collector
+)
+
+// collector writes a metric in the Prometheus text format
+type collector interface {
+	write(builder *strings.Builder)
+}
+
+// series is the value of a metric for a set of label values
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 // Histograms only, not cumulative
+	sum         float64  // Histograms only
+}
+
+// vector holds the series of a metric, one per set of label values
+type vector struct {
+	name       string
+	help       string
+	labelNames []string
+	mutex      sync.Mutex
+	series     map[string]*series
+}
+
+func newVector(name, help string, labelNames []string) vector {
+	return vector{name: name, help: help, labelNames: labelNames, series: make(map[string]*series)}
+}
+
+// get returns the series of the label values. The caller holds the vector mutex
+func (v *vector) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, %d values provided", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, found := v.series[key]
+	if !found {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values, for a stable output. The caller holds the vector mutex
+func (v *vector) sorted() []*series {
+	var keys []string
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = v.series[key]
+	}
+	return sorted
+}
+
+// Counter is a value that only goes up, e.g. the number of requests
+type Counter struct {
+	vector
+}
+
+// NewCounter registers a counter. The label values are provided in the order of the label names when the counter is incremented
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{newVector(name, help, labelNames)}
+	register(counter)
+	return counter
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a positive value to the counter
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.get(labelValues).value += value
+}
+
+func (c *Counter) write(builder *strings.Builder) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	writeHeader(builder, c.name, c.help, "counter")
+	for _, s := range c.sorted() {
+		writeSample(builder, c.name, c.labelNames, s.labelValues, "", "", s.value)
+	}
+}
+
+// Histogram counts the observations (e.g. durations) in buckets
+type Histogram struct {
+	vector
+	upperBounds []float64
+}
+
+// NewHistogram registers a histogram using the bucket upper bounds provided, in increasing order
+func NewHistogram(name, help string, upperBounds []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{newVector(name, help, labelNames), upperBounds}
+	register(histogram)
+	return histogram
+}
+
+// Observe adds an observation to the histogram
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.upperBounds))
+	}
+	for i, upperBound := range h.upperBounds {
+		if value <= upperBound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.value++
+	s.sum += value
+}
+
+func (h *Histogram) write(builder *strings.Builder) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	writeHeader(builder, h.name, h.help, "histogram")
+	for _, s := range h.sorted() {
+		cumulative := uint64(0)
+		for i, upperBound := range h.upperBounds {
+			cumulative += s.buckets[i]
+			writeSample(builder, h.name+"_bucket", h.labelNames, s.labelValues, "le", formatValue(upperBound), float64(cumulative))
+		}
+		writeSample(builder, h.name+"_bucket", h.labelNames, s.labelValues, "le", "+Inf", s.value)
+		writeSample(builder, h.name+"_sum", h.labelNames, s.labelValues, "", "", s.sum)
+		writeSample(builder, h.name+"_count", h.labelNames, s.labelValues, "", "", s.value)
+	}
+}
+
+// Gauge is a value that goes up & down, e.g. the size of a folder. The value is set by the caller, not computed when the metrics are collected
+type Gauge struct {
+	vector
+}
+
+// NewGauge registers a gauge. The label values are provided in the order of the label names when the gauge is set
+// A gauge without labels is 0 until it is set
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{newVector(name, help, labelNames)}
+	if len(labelNames) == 0 {
+		gauge.get(nil)
+	}
+	register(gauge)
+	return gauge
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.get(labelValues).value = value
+}
+
+func (g *Gauge) write(builder *strings.Builder) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	writeHeader(builder, g.name, g.help, "gauge")
+	for _, s := range g.sorted() {
+		writeSample(builder, g.name, g.labelNames, s.labelValues, "", "", s.value)
+	}
+}
+
+func register(metric collector) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, metric)
+}
+
+// Handler serves the registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMutex.Lock()
+		metrics := append([]collector{}, registry...)
+		registryMutex.Unlock()
+
+		var builder strings.Builder
+		for _, metric := range metrics {
+			metric.write(&builder)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(builder.String()))
+	})
+}
+
+func writeHeader(builder *strings.Builder, name, help, metricType string) {
+	builder.WriteString("# HELP " + name + " " + strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help) + "\n")
+	builder.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+// writeSample writes a line of the exposition format. The extra label is used for the histogram buckets
+func writeSample(builder *strings.Builder, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+	builder.WriteString(name)
+
+	var labels []string
+	for i, labelName := range labelNames {
+		labels = append(labels, labelName+`="`+escapeLabelValue(labelValues[i])+`"`)
+	}
+	if extraName != "" {
+		labels = append(labels, extraName+`="`+extraValue+`"`)
+	}
+	if len(labels) > 0 {
+		builder.WriteString("{" + strings.Join(labels, ",") + "}")
+	}
+
+	builder.WriteString(" " + formatValue(value) + "\n")
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
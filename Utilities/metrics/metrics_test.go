@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exposition returns the metric in the Prometheus text format
+func exposition(metric collector) string {
+	var builder strings.Builder
+	metric.write(&builder)
+	return builder.String()
+}
+
+func TestCounter(t *testing.T) {
+
+	counter := NewCounter("test_requests_total", "Requests served.", "route", "code")
+	counter.Inc("GET /b", "200")
+	counter.Inc("GET /a", "404")
+	counter.Add(2.5, "GET /a", "404")
+	counter.Inc("GET /a", "200")
+
+	// The series are sorted by label values
+	want := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{route="GET /a",code="200"} 1
+test_requests_total{route="GET /a",code="404"} 3.5
+test_requests_total{route="GET /b",code="200"} 1
+`
+	if got := exposition(counter); got != want {
+		t.Errorf("exposition = %s, want %s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+
+	counter := NewCounter("test_escaping_total", "Help with a \\ backslash\nand a new line. \"Quotes\" are not escaped.", "path")
+	counter.Inc(`C:\cache "quoted"` + "\nnext line")
+
+	want := `# HELP test_escaping_total Help with a \\ backslash\nand a new line. "Quotes" are not escaped.
+# TYPE test_escaping_total counter
+test_escaping_total{path="C:\\cache \"quoted\"\nnext line"} 1
+`
+	if got := exposition(counter); got != want {
+		t.Errorf("exposition = %s, want %s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+
+	histogram := NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 1, 10}, "status")
+	for _, value := range []float64{0.05, 0.1, 0.5, 1, 3, 60} {
+		histogram.Observe(value, "success")
+	}
+	histogram.Observe(0.2, "error")
+
+	// The buckets are cumulative, an observation equal to an upper bound is in the bucket. +Inf is the count
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{status="error",le="0.1"} 0
+test_duration_seconds_bucket{status="error",le="1"} 1
+test_duration_seconds_bucket{status="error",le="10"} 1
+test_duration_seconds_bucket{status="error",le="+Inf"} 1
+test_duration_seconds_sum{status="error"} 0.2
+test_duration_seconds_count{status="error"} 1
+test_duration_seconds_bucket{status="success",le="0.1"} 2
+test_duration_seconds_bucket{status="success",le="1"} 4
+test_duration_seconds_bucket{status="success",le="10"} 5
+test_duration_seconds_bucket{status="success",le="+Inf"} 6
+test_duration_seconds_sum{status="success"} 64.65
+test_duration_seconds_count{status="success"} 6
+`
+	if got := exposition(histogram); got != want {
+		t.Errorf("exposition = %s, want %s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+
+	histogram := NewHistogram("test_unlabelled_seconds", "Duration.", []float64{1})
+	if got := exposition(histogram); got != "# HELP test_unlabelled_seconds Duration.\n# TYPE test_unlabelled_seconds histogram\n" {
+		t.Errorf("exposition before the first observation = %s, want no series", got)
+	}
+
+	histogram.Observe(2)
+	want := `# HELP test_unlabelled_seconds Duration.
+# TYPE test_unlabelled_seconds histogram
+test_unlabelled_seconds_bucket{le="1"} 0
+test_unlabelled_seconds_bucket{le="+Inf"} 1
+test_unlabelled_seconds_sum 2
+test_unlabelled_seconds_count 1
+`
+	if got := exposition(histogram); got != want {
+		t.Errorf("exposition = %s, want %s", got, want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+
+	gauge := NewGauge("test_cache_size_bytes", "Size of the cache.")
+	want := "# HELP test_cache_size_bytes Size of the cache.\n# TYPE test_cache_size_bytes gauge\ntest_cache_size_bytes 0\n"
+	if got := exposition(gauge); got != want {
+		t.Errorf("exposition before the gauge is set = %s, want %s", got, want)
+	}
+
+	gauge.Set(2048)
+	gauge.Set(1024)
+	if got := exposition(gauge); !strings.HasSuffix(got, "\ntest_cache_size_bytes 1024\n") {
+		t.Errorf("exposition = %s, want the last value set", got)
+	}
+
+	labelled := NewGauge("test_folder_size_bytes", "Size of the folders.", "folder")
+	labelled.Set(1, "b")
+	labelled.Set(1e9, "a")
+	want = "# HELP test_folder_size_bytes Size of the folders.\n# TYPE test_folder_size_bytes gauge\n" +
+		"test_folder_size_bytes{folder=\"a\"} 1e+09\ntest_folder_size_bytes{folder=\"b\"} 1\n"
+	if got := exposition(labelled); got != want {
+		t.Errorf("exposition = %s, want %s", got, want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+
+	counter := NewCounter("test_label_count_total", "Labels.", "route", "code")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Inc() with a missing label value does not panic")
+		}
+	}()
+	counter.Inc("GET /")
+}
+
+func TestFormatValue(t *testing.T) {
+
+	values := map[float64]string{0: "0", 1: "1", 0.25: "0.25", 1e21: "1e+21", math.Inf(1): "+Inf", math.Inf(-1): "-Inf", math.NaN(): "NaN"}
+	for value, want := range values {
+		if got := formatValue(value); got != want {
+			t.Errorf("formatValue(%v) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+
+	NewCounter("test_handler_total", "Handler.").Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s, want the Prometheus text format", contentType)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "# TYPE test_handler_total counter\ntest_handler_total 1\n") {
+		t.Errorf("Handler() = %s, want the registered metrics", body)
+	}
+}
@@ -0,0 +1,36 @@
+// mockIdP. Local OpenID Connect provider used to test the OIDC login of segmentifyLite & seoBusinessInsights
+// Any user name is accepted. Do not use it in production
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"flag"
+	"goquery/auth/mockidp"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+func main() {
+
+	address := flag.String("address", "localhost:8089", "host:port the provider listens on")
+	issuer := flag.String("issuer", "", "issuer URL. http://<address> by default")
+	flag.Parse()
+
+	if *issuer == "" {
+		*issuer = "http://" + *address
+	}
+
+	idp, err := mockidp.New(*issuer)
+	if err != nil {
+		slog.Error("Cannot create the mock IdP", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Mock IdP is ON", "issuer", *issuer)
+	if err := http.ListenAndServe(*address, idp); err != nil {
+		slog.Error("Cannot start the mock IdP", "error", err)
+		os.Exit(1)
+	}
+}
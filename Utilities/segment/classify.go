@@ -0,0 +1,266 @@
+// segment. Classify URLs using compiled segments
+// Written by Jason Vicinanza
+
+package segment
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Classifier assigns a label per segment to URLs. It is safe for concurrent use
+type Classifier struct {
+	segments []Segment
+	compiled []compiledSegment
+}
+
+type compiledSegment struct {
+	name   string
+	labels []compiledLabel
+}
+
+type compiledLabel struct {
+	name  string
+	rules []matcher
+}
+
+// matcher evaluates a compiled rule against the parts of a URL
+type matcher interface {
+	match(parts urlParts) bool
+}
+
+// urlParts holds the fields a rule can be evaluated against
+type urlParts struct {
+	url   string
+	path  string
+	query string
+}
+
+// fieldMatcher evaluates a wildcard pattern or a regex against a single field
+type fieldMatcher struct {
+	field    string
+	wildcard []string
+	regex    *regexp.Regexp
+}
+
+// orMatcher matches when at least one of its rules matches
+type orMatcher []matcher
+
+// Compile reads and compiles a segment file
+func Compile(segmentFile string) (*Classifier, error) {
+
+	file, err := os.Open(segmentFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return CompileReader(file)
+}
+
+// CompileReader reads and compiles segments written in the Botify segment syntax
+func CompileReader(reader io.Reader) (*Classifier, error) {
+
+	segments, err := Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return CompileSegments(segments)
+}
+
+// CompileSegments compiles segments from the rule model
+func CompileSegments(segments []Segment) (*Classifier, error) {
+
+	classifier := &Classifier{segments: segments}
+
+	for _, seg := range segments {
+		compiled := compiledSegment{name: seg.Name}
+		for _, label := range seg.Labels {
+			rules, err := compileRules(label.Rules)
+			if err != nil {
+				return nil, fmt.Errorf("segment %s, label %s: %w", seg.Name, label.Name, err)
+			}
+			compiled.labels = append(compiled.labels, compiledLabel{name: label.Name, rules: rules})
+		}
+		classifier.compiled = append(classifier.compiled, compiled)
+	}
+
+	return classifier, nil
+}
+
+// compileRules compiles a list of rules into matchers
+func compileRules(rules []Rule) ([]matcher, error) {
+
+	var matchers []matcher
+	for _, rule := range rules {
+		if rule.IsGroup() {
+			group, err := compileRules(rule.Or)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, orMatcher(group))
+			continue
+		}
+
+		switch rule.Field {
+		case FieldURL, FieldPath, FieldQuery:
+		default:
+			return nil, fmt.Errorf("unsupported rule field %q", rule.Field)
+		}
+
+		fm := fieldMatcher{field: rule.Field}
+		if rule.IsRegex() {
+			regex, err := regexp.Compile(rule.Regexp())
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %w", rule.Pattern, err)
+			}
+			fm.regex = regex
+		} else {
+			fm.wildcard = strings.Split(rule.Pattern, "*")
+		}
+		matchers = append(matchers, fm)
+	}
+
+	return matchers, nil
+}
+
+// Segments returns the segments used by the classifier
+func (c *Classifier) Segments() []Segment {
+	return c.segments
+}
+
+// Classify returns the label of each segment matching the URL, keyed by segment name
+// Segments without a matching label are not included
+func (c *Classifier) Classify(url string) map[string]string {
+
+	labels := make(map[string]string, len(c.compiled))
+	parts := splitURL(url)
+
+	for i := range c.compiled {
+		if label, found := c.compiled[i].classify(parts); found {
+			labels[c.compiled[i].name] = label
+		}
+	}
+
+	return labels
+}
+
+// ClassifySegment returns the label of a single segment, identified by its position in Segments()
+// found is false when no label matches, or when there is no segment at this position
+func (c *Classifier) ClassifySegment(url string, segmentIndex int) (label string, found bool) {
+	if segmentIndex < 0 || segmentIndex >= len(c.compiled) {
+		return "", false
+	}
+	return c.compiled[segmentIndex].classify(splitURL(url))
+}
+
+// classify returns the first matching label
+func (s *compiledSegment) classify(parts urlParts) (string, bool) {
+	for _, label := range s.labels {
+		if matchAll(label.rules, parts) {
+			return label.name, true
+		}
+	}
+	return "", false
+}
+
+// matchAll reports whether all the rules match
+func matchAll(rules []matcher, parts urlParts) bool {
+	for _, rule := range rules {
+		if !rule.match(parts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m orMatcher) match(parts urlParts) bool {
+	for _, rule := range m {
+		if rule.match(parts) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m fieldMatcher) match(parts urlParts) bool {
+
+	value := parts.url
+	switch m.field {
+	case FieldPath:
+		value = parts.path
+	case FieldQuery:
+		value = parts.query
+	}
+
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+
+	return matchWildcard(m.wildcard, value)
+}
+
+// matchWildcard matches a value against the literal parts of a wildcard pattern (the text between the * characters)
+func matchWildcard(pieces []string, value string) bool {
+
+	// No wildcard, exact match
+	if len(pieces) == 1 {
+		return value == pieces[0]
+	}
+
+	// The first and last pieces are anchored to the start and end of the value
+	first, last := pieces[0], pieces[len(pieces)-1]
+	if len(value) < len(first)+len(last) || !strings.HasPrefix(value, first) || !strings.HasSuffix(value, last) {
+		return false
+	}
+
+	// The pieces in between must appear in order. Taking the leftmost match each time is always safe
+	value = value[len(first) : len(value)-len(last)]
+	for _, piece := range pieces[1 : len(pieces)-1] {
+		index := strings.Index(value, piece)
+		if index == -1 {
+			return false
+		}
+		value = value[index+len(piece):]
+	}
+
+	return true
+}
+
+// splitURL extracts the path and query string from a URL without allocating
+func splitURL(url string) urlParts {
+
+	parts := urlParts{url: url}
+
+	// Skip the protocol and host name
+	rest := url
+	if index := strings.Index(rest, "://"); index != -1 {
+		rest = rest[index+3:]
+		if end := strings.IndexAny(rest, "/?#"); end != -1 {
+			rest = rest[end:]
+		} else {
+			rest = ""
+		}
+	}
+
+	// Remove the fragment
+	if index := strings.IndexByte(rest, '#'); index != -1 {
+		rest = rest[:index]
+	}
+
+	parts.path = rest
+	if index := strings.IndexByte(rest, '?'); index != -1 {
+		parts.path = rest[:index]
+		parts.query = rest[index+1:]
+	}
+
+	if parts.path == "" {
+		parts.path = "/"
+	}
+
+	return parts
+}
@@ -0,0 +1,223 @@
+package segment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Segments in the format generated by segmentifyLite
+const testSegments = `# Generated by segmentifyLite
+[segment:sl_level1_folders]
+@Products
+path /products/*
+
+@Blog
+or (
+path /blog/*
+path /news/*
+)
+
+@Search
+path /search*
+query *q=*
+
+@~Other
+path /*
+# ----End of sl_level1_folders----
+
+[segment:sl_parameters]
+@Sort
+query rx:(^|&)sort=
+
+@Page
+query rx:(^|&)page=[0-9]+
+
+@Tracking
+url rx:[?&]utm_[a-z]+=
+# ----End of sl_parameters----
+
+[segment:sl_products]
+@Product
+path rx:/[a-z0-9-]+-[0-9]+\.html$
+
+@Product_uppercase
+path */P*.html
+
+@Product_any
+path /products/*
+# ----End of sl_products----
+`
+
+func TestCompile(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		segments string
+		labels   []int // No. of labels in each segment
+		wantErr  string
+	}{
+		{"segmentifyLite segments", testSegments, []int{4, 3, 3}, ""},
+		{"comments before the first segment", "# comment\npath /ignored\n[segment:s]\n@A\npath /a\n", []int{1}, ""},
+		{"or group without space", "[segment:s]\n@A\nor(\npath /a\npath /b\n)\n", []int{1}, ""},
+		{"no segments", "# nothing\n", nil, ""},
+		{"invalid regex", "[segment:s]\n@A\npath rx:(unclosed\n", nil, "invalid regex"},
+		{"unsupported field", "[segment:s]\n@A\nhost example.com\n", nil, "unsupported rule field"},
+		{"rule before label", "[segment:s]\npath /a\n", nil, "rule found before the first label"},
+		{"rule without pattern", "[segment:s]\n@A\npath\n", nil, "invalid rule"},
+		{"or group not closed", "[segment:s]\n@A\nor (\npath /a\n", nil, "or group not closed"},
+		{"nested or groups", "[segment:s]\n@A\nor (\nor (\n", nil, "nested or groups"},
+		{"unexpected bracket", "[segment:s]\n@A\n)\n", nil, "unexpected closing bracket"},
+		{"label inside or group", "[segment:s]\n@A\nor (\npath /a\n@B\n", nil, "label started before the or group was closed"},
+	}
+
+	for _, test := range tests {
+		classifier, err := CompileReader(strings.NewReader(test.segments))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s. CompileReader() = %v, want an error containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s. CompileReader() = %v, want no error", test.name, err)
+			continue
+		}
+		var labels []int
+		for _, seg := range classifier.Segments() {
+			labels = append(labels, len(seg.Labels))
+		}
+		if fmt.Sprint(labels) != fmt.Sprint(test.labels) {
+			t.Errorf("%s. CompileReader() = %v labels, want %v", test.name, labels, test.labels)
+		}
+	}
+
+	// Segment file
+	segmentFile := filepath.Join(t.TempDir(), "segment.txt")
+	if err := os.WriteFile(segmentFile, []byte(testSegments), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if classifier, err := Compile(segmentFile); err != nil || len(classifier.Segments()) != 3 {
+		t.Errorf("Compile(%s) = %v, want 3 segments", segmentFile, err)
+	}
+	if _, err := Compile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Compile() of a missing file = no error, want an error")
+	}
+
+	// Rule model
+	if _, err := CompileSegments([]Segment{{Name: "s", Labels: []Label{{Name: "A", Rules: []Rule{{Field: "host", Pattern: "*"}}}}}}); err == nil {
+		t.Error("CompileSegments() with an unsupported field = no error, want an error")
+	}
+}
+
+func TestClassify(t *testing.T) {
+
+	classifier, err := CompileReader(strings.NewReader(testSegments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want map[string]string
+	}{
+		{"wildcard", "https://www.example.com/products/shoes",
+			map[string]string{"sl_level1_folders": "Products", "sl_products": "Product_any"}},
+		{"first match wins", "https://www.example.com/products/red-shoes-123.html",
+			map[string]string{"sl_level1_folders": "Products", "sl_products": "Product"}},
+		{"or group, first rule", "https://www.example.com/blog/post",
+			map[string]string{"sl_level1_folders": "Blog"}},
+		{"or group, second rule", "https://www.example.com/news/today",
+			map[string]string{"sl_level1_folders": "Blog"}},
+		{"all rules must match", "https://www.example.com/search?q=shoes",
+			map[string]string{"sl_level1_folders": "Search"}},
+		{"all rules must match, one missing", "https://www.example.com/search?page=2",
+			map[string]string{"sl_level1_folders": "~Other", "sl_parameters": "Page"}},
+		{"catch-all", "https://www.example.com/about-us",
+			map[string]string{"sl_level1_folders": "~Other"}},
+		{"catch-all, home page", "https://www.example.com",
+			map[string]string{"sl_level1_folders": "~Other"}},
+		{"regex anywhere in the field", "https://www.example.com/list?color=red&sort=price",
+			map[string]string{"sl_level1_folders": "~Other", "sl_parameters": "Sort"}},
+		{"regex on the URL", "https://www.example.com/landing?utm_source=mail",
+			map[string]string{"sl_level1_folders": "~Other", "sl_parameters": "Tracking"}},
+		{"wildcard in the middle", "https://www.example.com/shop/Product.html",
+			map[string]string{"sl_level1_folders": "~Other", "sl_products": "Product_uppercase"}},
+		{"wildcard is case sensitive", "https://www.example.com/shop/product.html",
+			map[string]string{"sl_level1_folders": "~Other"}},
+		{"fragment ignored", "https://www.example.com/blog/post#comments",
+			map[string]string{"sl_level1_folders": "Blog"}},
+		{"path without host", "/products/shoes?sort=asc",
+			map[string]string{"sl_level1_folders": "Products", "sl_parameters": "Sort", "sl_products": "Product_any"}},
+	}
+
+	for _, test := range tests {
+		got := classifier.Classify(test.url)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s. Classify(%q) = %v, want %v", test.name, test.url, got, test.want)
+		}
+		for i, seg := range classifier.Segments() {
+			label, found := classifier.ClassifySegment(test.url, i)
+			if want, wantFound := test.want[seg.Name]; label != want || found != wantFound {
+				t.Errorf("%s. ClassifySegment(%q, %d) = %q, %v, want %q, %v", test.name, test.url, i, label, found, want, wantFound)
+			}
+		}
+	}
+
+	// Segment positions out of range
+	for _, segmentIndex := range []int{-1, len(classifier.Segments()), 100} {
+		if label, found := classifier.ClassifySegment("https://www.example.com/products/shoes", segmentIndex); found || label != "" {
+			t.Errorf("ClassifySegment(%d) = %q, %v, want no label", segmentIndex, label, found)
+		}
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"/products", "/products", true},
+		{"/products", "/products/", false},
+		{"/products/*", "/products/", true},
+		{"/products/*", "/product", false},
+		{"*", "", true},
+		{"*.html", "/a.html", true},
+		{"/a*b*c", "/abc", true},
+		{"/a*b*c", "/acb", false},
+		{"/ab*ba", "/aba", false},
+		{"*/p/*/p/*", "/x/p/y/p/z", true},
+		{"*/p/*/p/*", "/x/p/y", false},
+	}
+
+	for _, test := range tests {
+		if got := matchWildcard(strings.Split(test.pattern, "*"), test.value); got != test.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", test.pattern, test.value, got, test.want)
+		}
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+
+	classifier, err := CompileReader(strings.NewReader(testSegments))
+	if err != nil {
+		b.Fatal(err)
+	}
+	urls := []string{
+		"https://www.example.com/products/red-shoes-123.html?sort=price&page=2",
+		"https://www.example.com/blog/post?utm_source=mail",
+		"https://www.example.com/search?q=shoes",
+		"https://www.example.com/about-us",
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		classifier.Classify(urls[i%len(urls)])
+	}
+}
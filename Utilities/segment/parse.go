@@ -0,0 +1,139 @@
+// segment. Parse the Botify segment syntax into the rule model
+// Written by Jason Vicinanza
+
+package segment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Matches the segment header, e.g. [segment:sl_level1_folders]
+var segmentHeader = regexp.MustCompile(`^\[segment:([^\]]+)\]$`)
+
+// Matches the start of an "or" group, e.g. "or (" or "or("
+var orGroupStart = regexp.MustCompile(`(?i)^or\s*\($`)
+
+// Parse reads segments written in the Botify segment syntax
+// Comments and anything before the first segment header are ignored
+func Parse(reader io.Reader) ([]Segment, error) {
+
+	var segments []Segment
+	var currentSegment *Segment
+	var currentLabel *Label
+
+	// Rules inside an "or" group are collected here until the group is closed
+	var groupRules []Rule
+	inGroup := false
+
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// New segment
+		if match := segmentHeader.FindStringSubmatch(line); match != nil {
+			if inGroup {
+				return nil, fmt.Errorf("line %d: segment started before the or group was closed", lineNo)
+			}
+			segments = append(segments, Segment{Name: strings.TrimSpace(match[1])})
+			currentSegment = &segments[len(segments)-1]
+			currentLabel = nil
+			continue
+		}
+
+		// Ignore anything before the first segment
+		if currentSegment == nil {
+			continue
+		}
+
+		// New label
+		if strings.HasPrefix(line, "@") {
+			if inGroup {
+				return nil, fmt.Errorf("line %d: label started before the or group was closed", lineNo)
+			}
+			currentSegment.Labels = append(currentSegment.Labels, Label{Name: strings.TrimSpace(line[1:])})
+			currentLabel = &currentSegment.Labels[len(currentSegment.Labels)-1]
+			continue
+		}
+
+		if currentLabel == nil {
+			return nil, fmt.Errorf("line %d: rule found before the first label of segment %s", lineNo, currentSegment.Name)
+		}
+
+		// Start and end of an "or" group
+		if orGroupStart.MatchString(line) {
+			if inGroup {
+				return nil, fmt.Errorf("line %d: nested or groups are not supported", lineNo)
+			}
+			inGroup = true
+			groupRules = nil
+			continue
+		}
+		if line == ")" {
+			if !inGroup {
+				return nil, fmt.Errorf("line %d: unexpected closing bracket", lineNo)
+			}
+			currentLabel.Rules = append(currentLabel.Rules, Rule{Or: groupRules})
+			inGroup = false
+			continue
+		}
+
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if inGroup {
+			groupRules = append(groupRules, rule)
+		} else {
+			currentLabel.Rules = append(currentLabel.Rules, rule)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if inGroup {
+		return nil, fmt.Errorf("or group not closed at the end of the segments")
+	}
+
+	return segments, nil
+}
+
+// parseRule parses a single rule line, e.g. "path */products/*"
+func parseRule(line string) (Rule, error) {
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return Rule{}, fmt.Errorf("invalid rule %q", line)
+	}
+
+	field := strings.ToLower(fields[0])
+	switch field {
+	case FieldURL, FieldPath, FieldQuery:
+	default:
+		return Rule{}, fmt.Errorf("unsupported rule field %q", fields[0])
+	}
+
+	// The pattern is everything after the field name, spaces included
+	pattern := strings.TrimSpace(line[len(fields[0]):])
+
+	rule := Rule{Field: field, Pattern: pattern}
+	if rule.IsRegex() {
+		if _, err := regexp.Compile(rule.Regexp()); err != nil {
+			return Rule{}, fmt.Errorf("invalid regex in rule %q: %w", line, err)
+		}
+	}
+
+	return rule, nil
+}
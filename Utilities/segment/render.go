@@ -0,0 +1,46 @@
+// segment. Write the rule model using the Botify segment syntax
+// Written by Jason Vicinanza
+
+package segment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Render writes the segments using the Botify segment syntax
+func Render(writer io.Writer, segments []Segment) error {
+
+	bufferedWriter := bufio.NewWriter(writer)
+
+	for i, seg := range segments {
+		if i > 0 {
+			fmt.Fprint(bufferedWriter, "\n\n")
+		}
+		fmt.Fprintf(bufferedWriter, "[segment:%s]\n", seg.Name)
+
+		for _, label := range seg.Labels {
+			fmt.Fprintf(bufferedWriter, "@%s\n", label.Name)
+			renderRules(bufferedWriter, label.Rules)
+			fmt.Fprint(bufferedWriter, "\n")
+		}
+
+		fmt.Fprintf(bufferedWriter, "# ----End of %s----\n", seg.Name)
+	}
+
+	return bufferedWriter.Flush()
+}
+
+// renderRules writes one rule per line. "or" groups are written between brackets
+func renderRules(writer io.Writer, rules []Rule) {
+	for _, rule := range rules {
+		if rule.IsGroup() {
+			fmt.Fprint(writer, "or (\n")
+			renderRules(writer, rule.Or)
+			fmt.Fprint(writer, ")\n")
+			continue
+		}
+		fmt.Fprintf(writer, "%s %s\n", rule.Field, rule.Pattern)
+	}
+}
@@ -0,0 +1,67 @@
+// Package segment holds the rule model behind the segments generated by segmentifyLite
+// Segment files can be compiled into a Classifier used to label URLs, e.g. in log processing jobs
+// Written by Jason Vicinanza
+
+package segment
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Fields a rule can be evaluated against
+const (
+	FieldURL   = "url"
+	FieldPath  = "path"
+	FieldQuery = "query"
+)
+
+// Prefix used in Botify to signal a regular expression rather than a wildcard pattern
+const regexPrefix = "rx:"
+
+// Segment is a named list of labels. The labels are evaluated in order and the first matching label wins
+type Segment struct {
+	Name   string  `json:"name"`
+	Labels []Label `json:"labels"`
+}
+
+// Label is a segment value. A URL gets the label when all of its rules match
+type Label struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is either a single pattern evaluated against a field, or a group of rules of which at least one must match
+type Rule struct {
+	Field   string `json:"field,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Or      []Rule `json:"or,omitempty"`
+}
+
+// IsGroup reports whether the rule is an "or" group
+func (rule Rule) IsGroup() bool {
+	return rule.Field == ""
+}
+
+// IsRegex reports whether the pattern is a regular expression (rx:) rather than a wildcard pattern
+func (rule Rule) IsRegex() bool {
+	return strings.HasPrefix(rule.Pattern, regexPrefix)
+}
+
+// Regexp returns the RE2 regular expression equivalent of the rule pattern
+// Wildcard patterns must match the whole field, regular expressions can match anywhere in the field
+func (rule Rule) Regexp() string {
+	if rule.IsRegex() {
+		return strings.TrimPrefix(rule.Pattern, regexPrefix)
+	}
+	return wildcardToRegexp(rule.Pattern)
+}
+
+// wildcardToRegexp converts a Botify wildcard pattern (where * matches any number of characters) to an anchored regex
+func wildcardToRegexp(pattern string) string {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return "^" + strings.Join(parts, ".*") + "$"
+}
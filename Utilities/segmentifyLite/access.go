@@ -0,0 +1,90 @@
+// segmentifyLite. Authentication & access control. The users log in with an htpasswd file or OIDC (see goquery/auth)
+// The sessions can only be viewed by the user who created them, or by anyone holding the share link
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"goquery/auth"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Authenticates the users. Set with envSegmentifyLiteAuthMode (none, htpasswd or oidc). No authentication by default
+var authenticator = &auth.Authenticator{}
+
+// User of the current session. Saved in the session marker as the owner of the session
+var sessionOwner string
+
+// Cookie set when a share link is opened. Limited to the files & API of the shared session
+var shareCookie = "segmentifylite_share"
+
+// getAuthConfig reads the authentication configuration from the environment (envSegmentifyLiteAuthMode, envSegmentifyLiteHtpasswd ...)
+func getAuthConfig() {
+
+	config := auth.ConfigFromEnv("envSegmentifyLite")
+	config.Realm = "segmentifyLite"
+	config.CookieName = "segmentifylite_login"
+
+	var err error
+	authenticator, err = auth.New(config)
+	if err != nil {
+		slog.Error("getAuthConfig. Invalid authentication configuration. Cannot start segmentifyLite server", "error", err)
+		os.Exit(0)
+	}
+	slog.Info("Authentication mode", "mode", authenticator.Mode())
+}
+
+// authorizeSession checks that the user can view a session. The owner of the session, or anyone holding the share link
+// Opening a share link sets the share cookie, the pages linked from the results & the segment editor API are then accessible
+func authorizeSession(w http.ResponseWriter, r *http.Request, sessionID string, folder string) bool {
+
+	if !authenticator.Enabled() {
+		return true
+	}
+
+	shareKey := r.URL.Query().Get("share")
+	if shareKey == "" {
+		if cookie, err := r.Cookie(shareCookie); err == nil {
+			shareKey = cookie.Value
+		}
+	}
+	if authenticator.ValidShareKey(sessionID, shareKey) {
+		if r.URL.Query().Get("share") != "" {
+			for _, path := range []string{sessionURL(sessionID, ""), "/api/segments/" + sessionID} {
+				http.SetCookie(w, &http.Cookie{Name: shareCookie, Value: shareKey, Path: path, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode})
+			}
+		}
+		return true
+	}
+
+	user := authenticator.User(r)
+	if user == "" {
+		authenticator.Challenge(w, r)
+		return false
+	}
+
+	// The owner is unknown when the marker is missing. Access is refused
+	marker, err := readSessionMarker(folder)
+	if err != nil || !authenticator.CanView(user, marker.Owner) {
+		slog.Warn("authorizeSession. Access refused", "sessionID", sessionID, "user", user, "error", err)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "the session was created by another user"})
+		} else {
+			http.Error(w, "The session was created by another user", http.StatusForbidden)
+		}
+		return false
+	}
+
+	return true
+}
+
+// shareLink returns the link giving access to a file of the session to anyone holding it. Empty when the users are not authenticated
+func shareLink(sessionID string, fileName string) string {
+	if !authenticator.Enabled() {
+		return ""
+	}
+	return fileName + "?share=" + authenticator.ShareKey(sessionID)
+}
@@ -0,0 +1,467 @@
+// segmentifyLite. JSON API used to generate the segments programmatically
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goquery/segment"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Name of the file used to store the API response in the session cache folder
+var apiResultFile = "segments.json"
+
+// Format of the session ID (see generateSessionID)
+var validSessionID = regexp.MustCompile(`^[0-9]+-[A-Za-z0-9_=-]+$`)
+
+// apiSegmentsRequest is the JSON body accepted by POST /api/segments
+// Either the organisation and project, or a list of URLs must be specified
+type apiSegmentsRequest struct {
+	Organization    string   `json:"organization"`
+	Project         string   `json:"project"`
+	LabelRules      string   `json:"labelRules"`
+	CrawlFields     []string `json:"crawlFields"`
+	Hreflang        bool     `json:"hreflang"`
+	PDPExamples     []string `json:"pdpExamples"`
+	PLPExamples     []string `json:"plpExamples"`
+	RobotsTxt       string   `json:"robotsTxt"`
+	RobotsUserAgent string   `json:"robotsUserAgent"`
+	Sitemaps        []string `json:"sitemaps"`
+	SitemapURLs     []string `json:"sitemapURLs"`
+	URLs            []string `json:"urls"`
+}
+
+// apiSegmentsResponse is the result of a segmentation session
+type apiSegmentsResponse struct {
+	SessionID    string       `json:"sessionID"`
+	Version      string       `json:"version"`
+	Organization string       `json:"organization"`
+	Project      string       `json:"project"`
+	URLCount     int          `json:"urlCount"`
+	Platforms    []string     `json:"platforms"`
+	Segments     []apiSegment `json:"segments"`
+	SegmentText  string       `json:"segmentText"`
+}
+
+// apiSegment is a generated segment including the number of URLs found for each label
+type apiSegment struct {
+	Name              string     `json:"name"`
+	Labels            []apiLabel `json:"labels"`
+	UnmatchedURLCount int        `json:"unmatchedURLCount"`
+}
+
+type apiLabel struct {
+	Name     string         `json:"name"`
+	Rules    []segment.Rule `json:"rules"`
+	URLCount int            `json:"urlCount"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiCreateSegments handles POST /api/segments
+// Accepts a JSON body (see apiSegmentsRequest) or a form using the same fields as index.html
+// The URLs can be uploaded in a "urls" file field, one URL per line
+func apiCreateSegments(w http.ResponseWriter, r *http.Request) {
+
+	// Lock the function until it's complete to prevent race conditions
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The user logged in owns the session
+	sessionOwner = authenticator.User(r)
+
+	request, uploadedURLs, rules, err := readAPIRequest(r)
+	if uploadedURLs != nil {
+		defer func() {
+			if err := uploadedURLs.Close(); err != nil {
+				slog.Error("apiCreateSegments. Closing the uploaded URLs", "error", err)
+			}
+		}()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	if uploadedURLs == nil && (request.Organization == "" || request.Project == "") {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "the organization and project, or a list of URLs, are required"})
+		return
+	}
+
+	// The names are used in the API URLs
+	if request.Organization != "" || request.Project != "" {
+		if err := validateName("organisation", request.Organization); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if err := validateName("project", request.Project); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if !authenticator.Allowed(sessionOwner, request.Organization) {
+			writeJSON(w, http.StatusForbidden, apiError{Error: "you are not allowed to query the organisation " + request.Organization})
+			return
+		}
+	}
+
+	// Botify token of the session. Not required when the URLs are uploaded
+	if uploadedURLs == nil {
+		if err := startTokenSession(r); err != nil {
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: err.Error()})
+			return
+		}
+		defer endTokenSession()
+	}
+
+	organisation = request.Organization
+	project = request.Project
+	labelRules = rules
+
+	// Crawl fields used to generate additional segments. Use the defaults if none are specified
+	crawlFields, err = parseCrawlFields(strings.Join(request.CrawlFields, ","))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	if len(crawlFields) == 0 {
+		crawlFields = defaultCrawlFields
+	}
+	hreflangEnabled = request.Hreflang
+
+	// Example PDP & PLP URLs used to learn the page type regex
+	pdpExamples, err = loadExamples(strings.NewReader(strings.Join(request.PDPExamples, "\n")))
+	if err == nil {
+		plpExamples, err = loadExamples(strings.NewReader(strings.Join(request.PLPExamples, "\n")))
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	// robots.txt used to test the proposed crawl control rules
+	existingRobots = nil
+	if request.RobotsTxt != "" {
+		if existingRobots, err = parseRobots(strings.NewReader(request.RobotsTxt)); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+	}
+
+	robotsUserAgent = strings.TrimSpace(request.RobotsUserAgent)
+	if robotsUserAgent == "" {
+		robotsUserAgent = defaultRobotsUserAgent
+	}
+
+	// Sitemaps used in the sitemap coverage report. The XML content, or the sitemap URLs fetched from the mirror
+	sitemapSources = nil
+	for i, sitemap := range request.Sitemaps {
+		sitemapSources = append(sitemapSources, sitemapSource{Name: fmt.Sprintf("sitemap %d", i+1), Content: []byte(sitemap)})
+	}
+	urlSources, err := sitemapURLSources(request.SitemapURLs)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	sitemapSources = append(sitemapSources, urlSources...)
+
+	// Generate a session ID used for grouping log entries
+	sessionID, err := generateSessionID(sessionIDLength)
+	if err != nil {
+		slog.Error("apiCreateSegments. Failed generating a session ID", "error", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot generate a session ID"})
+		return
+	}
+
+	cacheFolderRoot = envSegmentifyLiteFolder
+	cacheFolder = cacheFolderRoot + "/" + sessionID
+
+	if err := createCacheFolder(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot create the session folder"})
+		return
+	}
+	writeSessionMarker(cacheFolder, sessionID, organisation, project, sessionOwner)
+	defer completeSessionMarker(cacheFolder)
+
+	// Manage errors
+	if err := runSegmentation(sessionID, uploadedURLs); err != nil {
+		switch {
+		case errors.Is(err, errNoProjectFound):
+			writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("no project found (%s/%s)", organisation, project)})
+		case errors.Is(err, errNoURLs):
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "no URLs found in the request"})
+		case errors.Is(err, errBotifyAPI):
+			writeJSON(w, http.StatusBadGateway, apiError{Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		}
+		return
+	}
+
+	// The response is saved by runSegmentation
+	response, err := os.ReadFile(cacheFolder + "/" + apiResultFile)
+
+	// Display results and clean up
+	finishUp(sessionID)
+
+	if err != nil {
+		logger.Error("apiCreateSegments. Cannot read the response", "error", err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot generate the response"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(response); err != nil {
+		logger.Error("apiCreateSegments. Cannot write response", "error", err)
+	}
+}
+
+// apiGetSegments handles GET /api/segments/{sessionID}. Returns the result of a previous API session
+func apiGetSegments(w http.ResponseWriter, r *http.Request) {
+
+	folder, err := sessionFolder(r.PathValue("sessionID"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return
+	}
+	if !authorizeSession(w, r, r.PathValue("sessionID"), folder) {
+		return
+	}
+
+	content, err := os.ReadFile(folder + "/" + apiResultFile)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot read the session results"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(content); err != nil {
+		slog.Error("apiGetSegments. Cannot write response", "sessionID", r.PathValue("sessionID"), "error", err)
+	}
+}
+
+// readAPIRequest reads the request fields from a JSON body or a form
+func readAPIRequest(r *http.Request) (request apiSegmentsRequest, uploadedURLs io.ReadCloser, rules []labelRule, err error) {
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxUploadSize)).Decode(&request); err != nil {
+			return request, nil, nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		if len(request.URLs) > 0 {
+			uploadedURLs = io.NopCloser(strings.NewReader(strings.Join(request.URLs, "\n")))
+		}
+		rules, err = loadLabelRules(strings.NewReader(request.LabelRules))
+		return request, uploadedURLs, rules, err
+	}
+
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return request, nil, nil, fmt.Errorf("invalid form: %w", err)
+	}
+	request.Organization = r.Form.Get("organization")
+	request.Project = r.Form.Get("project")
+	request.CrawlFields = strings.Split(r.Form.Get("crawlFields"), ",")
+	request.Hreflang = r.Form.Get("hreflang") == "on" || r.Form.Get("hreflang") == "true"
+
+	// Example URLs entered in the form or uploaded as files
+	if request.PDPExamples, err = getExamples(r, "pdpExamples"); err != nil {
+		return request, nil, nil, err
+	}
+	if request.PLPExamples, err = getExamples(r, "plpExamples"); err != nil {
+		return request, nil, nil, err
+	}
+
+	// robots.txt uploaded as a file
+	robotsUpload, _, err := r.FormFile("robotsFile")
+	if err == nil {
+		defer func() {
+			if err := robotsUpload.Close(); err != nil {
+				logger.Error("readAPIRequest. Closing the robots.txt", "error", err)
+			}
+		}()
+		robotsTxt, err := io.ReadAll(io.LimitReader(robotsUpload, maxRobotsSize))
+		if err != nil {
+			return request, nil, nil, err
+		}
+		request.RobotsTxt = string(robotsTxt)
+	}
+	request.RobotsUserAgent = r.Form.Get("robotsUserAgent")
+
+	// Sitemaps uploaded as files, or sitemap URLs fetched from the mirror
+	if r.MultipartForm != nil {
+		for _, header := range r.MultipartForm.File["sitemapFiles"] {
+			sitemap, err := readUploadedFile(header, maxSitemapSize)
+			if err != nil {
+				return request, nil, nil, err
+			}
+			request.Sitemaps = append(request.Sitemaps, string(sitemap))
+		}
+	}
+	request.SitemapURLs = strings.Split(r.Form.Get("sitemapURLs"), "\n")
+
+	// URLs uploaded as a file
+	file, _, err := r.FormFile("urls")
+	if err == nil {
+		uploadedURLs = file
+	} else if urls := r.Form.Get("urls"); urls != "" {
+		uploadedURLs = io.NopCloser(strings.NewReader(urls))
+	}
+
+	rules, err = getLabelRules(r)
+	return request, uploadedURLs, rules, err
+}
+
+// readUploadedFile reads up to maxSize bytes of an uploaded file
+func readUploadedFile(header *multipart.FileHeader, maxSize int64) ([]byte, error) {
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("readUploadedFile. Closing", "error", err)
+		}
+	}()
+
+	return io.ReadAll(io.LimitReader(file, maxSize))
+}
+
+// saveSegmentsResponse saves the generated segments and URL counts in the session cache folder
+// Used by the JSON API and the segment editor
+func saveSegmentsResponse(sessionID string) error {
+
+	response := apiSegmentsResponse{
+		SessionID:    sessionID,
+		Version:      version,
+		Organization: organisation,
+		Project:      project,
+		Platforms:    detectedPlatforms(),
+	}
+
+	segmentText, err := os.ReadFile(regexOutputFile)
+	if err != nil {
+		return err
+	}
+	response.SegmentText = string(segmentText)
+
+	response.Segments, response.URLCount, err = segmentsWithCounts(sessionSegments, urlExtractFile)
+	if err != nil {
+		return err
+	}
+
+	responseData, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cacheFolder+"/"+apiResultFile, responseData, 0644)
+}
+
+// segmentsWithCounts classifies the URLs in a file and adds the number of URLs found to each label
+func segmentsWithCounts(classifier *segment.Classifier, urlFile string) ([]apiSegment, int, error) {
+
+	labelCounts, urlCount, err := countSegmentURLs(classifier, urlFile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var countedSegments []apiSegment
+	for i, seg := range classifier.Segments() {
+		countedSegment := apiSegment{Name: seg.Name, UnmatchedURLCount: urlCount}
+		counted := make(map[string]bool)
+		for _, label := range seg.Labels {
+			// The URLs are counted once when a label name is repeated in the segment
+			key := segmentLabel{Segment: i, Label: label.Name}
+			labelURLCount := 0
+			if !counted[label.Name] {
+				labelURLCount = labelCounts[key]
+				counted[label.Name] = true
+			}
+			countedSegment.Labels = append(countedSegment.Labels, apiLabel{
+				Name:     label.Name,
+				Rules:    label.Rules,
+				URLCount: labelURLCount,
+			})
+			countedSegment.UnmatchedURLCount -= labelURLCount
+		}
+		countedSegments = append(countedSegments, countedSegment)
+	}
+
+	return countedSegments, urlCount, nil
+}
+
+// segmentLabel identifies a label by the position of its segment and its name
+type segmentLabel struct {
+	Segment int
+	Label   string
+}
+
+// countSegmentURLs classifies the URLs in a file. Returns the number of URLs per segment and label
+func countSegmentURLs(classifier *segment.Classifier, fileName string) (labelCounts map[segmentLabel]int, urlCount int, err error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("countSegmentURLs. Closing", "error", err)
+		}
+	}()
+
+	segments := classifier.Segments()
+	labelCounts = make(map[segmentLabel]int)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		url := scanner.Text()
+		if url == "" {
+			continue
+		}
+		urlCount++
+		for i := range segments {
+			if label, found := classifier.ClassifySegment(url, i); found {
+				labelCounts[segmentLabel{Segment: i, Label: label}]++
+			}
+		}
+	}
+
+	return labelCounts, urlCount, scanner.Err()
+}
+
+// detectedPlatforms lists the platforms detected in the current session
+func detectedPlatforms() []string {
+	platforms := []string{}
+	if sfccDetected {
+		platforms = append(platforms, "SFCC")
+	}
+	if shopifyDetected {
+		platforms = append(platforms, "Shopify")
+	}
+	return platforms
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("writeJSON. Cannot write response", "error", err)
+	}
+}
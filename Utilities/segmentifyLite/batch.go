@@ -0,0 +1,450 @@
+// segmentifyLite. Batch mode. Generate the segmentation regex for all projects in an organisation
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goquery/logging"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of projects downloaded at the same time. Can be changed in segmentifyLite.ini (batchConcurrency)
+var batchConcurrency = 4
+
+// Maximum number of projects in a batch
+var maxBatchProjects = 500
+
+// Name of the summary page generated in the batch cache folder
+var batchSummaryFile = "go_seo_batchSummary.html"
+
+// batchProject holds the status of a project processed in batch mode
+type batchProject struct {
+	Project   string
+	SessionID string
+	Folder    string
+	Err       error
+	URLCount  int
+	Started   time.Time
+}
+
+type botifyProjectsResponse struct {
+	Next    string `json:"next"`
+	Results []struct {
+		Slug string `json:"slug"`
+	} `json:"results"`
+}
+
+// batchHandler handles POST /batch
+// The projects are listed in the form (or in an uploaded file). When none are specified all projects in the organisation are used
+// The URLs are downloaded concurrently, the segmentation is then generated for each project in turn
+// The session globals are only locked while a project is segmented (as for a single run), other sessions can run during the downloads
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+
+	// The user logged in owns the batch & the project sessions
+	owner := authenticator.User(r)
+
+	err := r.ParseMultipartForm(maxUploadSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		slog.Error("batchHandler. Cannot parse form", "error", err)
+		return
+	}
+	batchOrganisation := r.Form.Get("organization")
+
+	// Generate a batch ID used to name the batch cache folder
+	batchID, err := generateSessionID(sessionIDLength)
+	if err != nil {
+		slog.Error("batchHandler. Failed generating a session ID", "error", err)
+		http.Error(w, "Cannot generate a session ID", http.StatusInternalServerError)
+		return
+	}
+
+	batchFolder := envSegmentifyLiteFolder + "/" + batchID
+	if err := os.MkdirAll(batchFolder, 0755); err != nil {
+		slog.Error("batchHandler. Cannot create the batch folder", "error", err)
+		http.Error(w, "Cannot create the batch folder", http.StatusInternalServerError)
+		return
+	}
+	writeSessionMarker(batchFolder, batchID, batchOrganisation, "", owner)
+	defer completeSessionMarker(batchFolder)
+
+	// Redirect to the error page
+	batchError := func(displayMessage string) {
+		writeLog(batchID, batchOrganisation, "", "Batch failed")
+		mutex.Lock()
+		cacheFolder = batchFolder
+		generateErrorPage(html.EscapeString(displayMessage))
+		mutex.Unlock()
+		http.Redirect(w, r, sessionURL(batchID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+	}
+
+	if batchOrganisation == "" {
+		batchError("The organisation name is required.")
+		return
+	}
+	if err := validateName("organisation", batchOrganisation); err != nil {
+		batchError(err.Error())
+		return
+	}
+	if !authenticator.Allowed(owner, batchOrganisation) {
+		batchError("You are not allowed to query this organisation. (" + batchOrganisation + ")")
+		return
+	}
+
+	// Botify token used for all projects in the batch. Forgotten when the batch is complete
+	token, err := requestToken(r)
+	if err != nil {
+		batchError("A Botify token is required. " + err.Error())
+		return
+	}
+	defer forgetToken(token)
+
+	// Label rules used to rename, merge or exclude folders. The same rules are used for all projects
+	rules, err := getLabelRules(r)
+	if err != nil {
+		batchError("The label rules are invalid. " + err.Error())
+		return
+	}
+
+	projectNames, err := getProjectList(r)
+	if err != nil {
+		batchError("The project list is invalid. " + err.Error())
+		return
+	}
+	if len(projectNames) == 0 {
+		projectNames, err = listProjects(batchOrganisation, token)
+		if err != nil {
+			slog.Error("batchHandler. Cannot list the projects", "organisation", batchOrganisation, "error", err)
+			batchError("Cannot list the projects in the organisation. (" + batchOrganisation + ")")
+			return
+		}
+	}
+	if len(projectNames) == 0 {
+		batchError("No project found. (" + batchOrganisation + ")")
+		return
+	}
+	if len(projectNames) > maxBatchProjects {
+		batchError(fmt.Sprintf("Too many projects (%d), the maximum is %d.", len(projectNames), maxBatchProjects))
+		return
+	}
+
+	writeLog(batchID, batchOrganisation, "", fmt.Sprintf("Batch started (%d projects)", len(projectNames)))
+
+	// One session (and cache folder) per project
+	var projects []*batchProject
+	for _, projectName := range projectNames {
+		sessionID, err := generateSessionID(sessionIDLength)
+		if err != nil {
+			slog.Error("batchHandler. Failed generating a session ID", "error", err)
+			batchError("Cannot generate a session ID.")
+			return
+		}
+		projects = append(projects, &batchProject{
+			Project:   projectName,
+			SessionID: sessionID,
+			Folder:    envSegmentifyLiteFolder + "/" + sessionID,
+		})
+	}
+
+	downloadProjects(batchOrganisation, owner, token, projects)
+	for _, batchProject := range projects {
+		segmentProject(batchOrganisation, owner, token, rules, batchProject)
+	}
+
+	mutex.Lock()
+	cacheFolder = batchFolder
+	generateBatchSummary(batchOrganisation, projects)
+	mutex.Unlock()
+
+	writeLog(batchID, batchOrganisation, "", "Batch complete")
+
+	http.Redirect(w, r, sessionURL(batchID, batchSummaryFile), http.StatusFound)
+}
+
+// Download the URLs of each project to its cache folder, owned by owner. At most batchConcurrency projects are downloaded at the same time
+// The session globals are not used, the downloads run while other sessions are processed
+func downloadProjects(organisation string, owner string, token string, projects []*batchProject) {
+
+	var waitGroup sync.WaitGroup
+	semaphore := make(chan struct{}, batchConcurrency)
+
+	for _, batchProject := range projects {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			batchProject.Started = time.Now()
+			if err := os.MkdirAll(batchProject.Folder, 0755); err != nil {
+				logging.Session(batchProject.SessionID, organisation, batchProject.Project).Error("downloadProjects. Cannot create the cache folder", "error", err)
+				batchProject.Err = err
+				return
+			}
+			// Written before the download. The cache janitor keeps the session in progress until segmentProject completes it
+			writeSessionMarker(batchProject.Folder, batchProject.SessionID, organisation, batchProject.Project, owner)
+
+			batchProject.Err = downloadURLs(batchProject.SessionID, organisation, batchProject.Project, token, batchProject.Folder+"/"+urlExtractFile, "", nil)
+		}()
+	}
+
+	waitGroup.Wait()
+}
+
+// Generate the segmentation of a project downloaded successfully
+// The session globals are locked until the segmentation is complete, as for a single run
+func segmentProject(batchOrganisation string, owner string, token string, rules []labelRule, batchProject *batchProject) {
+
+	// The project session was marked in progress when its download started
+	defer completeSessionMarker(batchProject.Folder)
+
+	if batchProject.Err != nil {
+		writeLog(batchProject.SessionID, batchOrganisation, batchProject.Project, batchStatusMessage(runStatus(batchProject.Err)))
+		recordRun(runRecord{
+			SessionID:    batchProject.SessionID,
+			Organisation: batchOrganisation,
+			Project:      batchProject.Project,
+			Started:      batchProject.Started,
+			Status:       runStatus(batchProject.Err),
+			Folder:       batchProject.Folder,
+			Owner:        owner,
+		})
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	organisation = batchOrganisation
+	project = batchProject.Project
+	sessionOwner = owner
+	cacheFolderRoot = envSegmentifyLiteFolder
+	cacheFolder = batchProject.Folder
+	labelRules = rules
+	botifyToken = token
+	defer func() { botifyToken = "" }()
+
+	// Crawl fields, hreflang, example URLs, robots.txt & sitemaps are specific to a project, and are not used in batch mode
+	crawlFields = nil
+	hreflangEnabled = false
+	pdpExamples = nil
+	plpExamples = nil
+	existingRobots = nil
+	sitemapSources = nil
+
+	downloadedFile := batchProject.Folder + "/" + urlExtractFile
+	file, err := os.Open(downloadedFile)
+	if err != nil {
+		logging.Session(batchProject.SessionID, organisation, project).Error("segmentProject. Cannot open the URLs", "error", err)
+		batchProject.Err = err
+		return
+	}
+
+	batchProject.Err = runSegmentation(batchProject.SessionID, file)
+
+	if err := file.Close(); err != nil {
+		logger.Error("segmentProject. Closing", "error", err)
+	}
+	_ = os.Remove(downloadedFile)
+
+	if batchProject.Err != nil {
+		_ = os.Remove(urlExtractFile)
+		return
+	}
+
+	if urls, err := readURLFile(urlExtractFile); err == nil {
+		batchProject.URLCount = len(urls)
+	}
+
+	finishUp(batchProject.SessionID)
+}
+
+// getProjectList reads the project names entered in the form and uploaded in the project list file. One project per line
+func getProjectList(r *http.Request) ([]string, error) {
+
+	projectList := r.Form.Get("projects")
+
+	file, _, err := r.FormFile("projectsFile")
+	if err == nil {
+		defer func() {
+			if err := file.Close(); err != nil {
+				slog.Error("getProjectList. Closing", "error", err)
+			}
+		}()
+		fileContent, err := io.ReadAll(io.LimitReader(file, maxUploadSize))
+		if err != nil {
+			return nil, err
+		}
+		projectList += "\n" + string(fileContent)
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, fmt.Errorf("cannot read the project list file: %w", err)
+	}
+
+	var projectNames []string
+	found := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(projectList))
+	for scanner.Scan() {
+		projectName := strings.TrimSpace(scanner.Text())
+		if projectName == "" || strings.HasPrefix(projectName, "#") || found[projectName] {
+			continue
+		}
+		if err := validateName("project", projectName); err != nil {
+			return nil, err
+		}
+		found[projectName] = true
+		projectNames = append(projectNames, projectName)
+	}
+
+	return projectNames, scanner.Err()
+}
+
+// listProjects uses the API to list all projects in an organisation
+func listProjects(organisation string, token string) ([]string, error) {
+
+	var projectNames []string
+
+	url := fmt.Sprintf("%s/v1/projects/%s?page=1&size=100", botifyAPIBaseURL, organisation)
+	for url != "" {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("Authorization", "token "+token)
+
+		res, err := botifyClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var responseObject botifyProjectsResponse
+		err = json.NewDecoder(res.Body).Decode(&responseObject)
+		if err := res.Body.Close(); err != nil {
+			slog.Error("listProjects. Closing", "error", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", res.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range responseObject.Results {
+			projectNames = append(projectNames, result.Slug)
+		}
+		if len(projectNames) > maxBatchProjects {
+			break
+		}
+
+		url = responseObject.Next
+	}
+
+	return projectNames, nil
+}
+
+// Message displayed in the summary page for each status returned by runSegmentation
+func batchStatusMessage(status string) string {
+	switch status {
+	case "success":
+		return "Regex generated successfully"
+	case "errorNoProjectFound":
+		return "No project found, or no crawl found in the project"
+	case "errorNoURLs":
+		return "No URLs found"
+	}
+	return "An error occurred when processing the URLs"
+}
+
+// Generate the summary page linking the segmentation of each project
+func generateBatchSummary(organisation string, projects []*batchProject) {
+
+	successCount := 0
+	var rows strings.Builder
+	for _, batchProject := range projects {
+		status := "<span style='color: red;'>Failed</span>"
+		result := ""
+		if batchProject.Err != nil {
+			result = html.EscapeString(errorMessage(batchProject.Err))
+		} else {
+			successCount++
+			status = "<span style='color: green;'>Success</span>"
+			result = fmt.Sprintf("<a href='%s' target='_blank'>View segmentation</a>", sessionURL(batchProject.SessionID, "go_seo_segmentifyLite.html"))
+		}
+		rows.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%s</td></tr>\n",
+			html.EscapeString(batchProject.Project), status, batchProject.URLCount, result))
+	}
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .summary {
+            margin: 30px auto;
+            width: 80%%;
+            color: LightSlateGray;
+        }
+        table {
+            width: 100%%;
+            border-collapse: collapse;
+            background-color: white;
+        }
+        th, td {
+            padding: 8px;
+            border-bottom: 1px solid #ddd;
+            text-align: left;
+        }
+        th {
+            background-color: DeepSkyBlue;
+            color: white;
+        }
+        a {
+            color: DeepSkyBlue;
+        }
+    </style>
+</head>
+<body>
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite</span>
+</header>
+<div class="summary">
+    <h2>Organisation: %s</h2>
+    <p>%d of %d projects segmented. Generated %s</p>
+    <table>
+        <tr><th>Project</th><th>Status</th><th>URLs</th><th>Result</th></tr>
+%s    </table>
+    <p><a href='%s://%s/batch.html'>Segment another organisation</a></p>
+</div>
+</body>
+</html>`, html.EscapeString(organisation), successCount, len(projects), time.Now().Format(time.RFC1123), rows.String(), protocol, fullHost)
+
+	if err := saveHTML(htmlContent, "/"+batchSummaryFile); err != nil {
+		slog.Error("generateBatchSummary. Cannot save the summary", "organisation", organisation, "error", err)
+	}
+}
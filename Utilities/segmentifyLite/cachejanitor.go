@@ -0,0 +1,326 @@
+// segmentifyLite. Cache janitor. Removes the session cache folders based on their age, the total cache size and the number of sessions per project
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cache retention policy. Can be changed in segmentifyLite.ini. A value of 0 disables the policy
+var cacheMaxAge = 7 * 24 * time.Hour        // cacheMaxAgeHours
+var cacheMaxSize int64 = 1 << 30            // cacheMaxSizeMB
+var cacheMaxSessionsPerProject = 10         // cacheMaxSessionsPerProject
+var cacheCleanupInterval = 60 * time.Minute // cacheCleanupIntervalMinutes
+
+// When true the folders which would be removed are listed, nothing is deleted. Can be changed in segmentifyLite.ini (cacheCleanupDryRun)
+var cacheCleanupDryRun = false
+
+// Sessions marked in progress are not removed, unless the marker is older than this (e.g. the server stopped during the session)
+var cacheInProgressTimeout = 24 * time.Hour
+
+// Folders without a marker modified recently are not removed. The marker is written just after the folder is created
+var cacheMarkerGracePeriod = time.Minute
+
+// Marker file written in each session cache folder. Identifies the folders created by segmentifyLite
+var sessionMarkerFile = ".segmentifyLite_session"
+
+// sessionMarker is the content of the session marker file
+type sessionMarker struct {
+	SessionID    string    `json:"sessionID"`
+	Organisation string    `json:"organisation"`
+	Project      string    `json:"project"`
+	Owner        string    `json:"owner,omitempty"` // User who created the session, when the users are authenticated
+	Created      time.Time `json:"created"`
+	InProgress   bool      `json:"inProgress,omitempty"` // Files are still being written in the folder (see completeSessionMarker)
+}
+
+// cachedSession is a session cache folder found by the janitor
+type cachedSession struct {
+	Folder string
+	Marker sessionMarker
+	Size   int64
+	Reason string
+}
+
+// writeSessionMarker writes the marker file in a session cache folder. Written when the folder is created, the owner is needed to view the session
+// The session is marked in progress, the cache janitor does not remove it until completeSessionMarker is called
+func writeSessionMarker(folder string, sessionID string, organisation string, project string, owner string) {
+	saveSessionMarker(folder, sessionMarker{SessionID: sessionID, Organisation: organisation, Project: project, Owner: owner, Created: time.Now(), InProgress: true})
+}
+
+// completeSessionMarker marks a session as complete. The cache janitor can then remove the folder
+func completeSessionMarker(folder string) {
+
+	marker, err := readSessionMarker(folder)
+	if err != nil {
+		slog.Error("completeSessionMarker. Cannot read the marker", "folder", folder, "error", err)
+		return
+	}
+
+	marker.InProgress = false
+	saveSessionMarker(folder, marker)
+}
+
+// saveSessionMarker writes the marker file of a session cache folder
+func saveSessionMarker(folder string, marker sessionMarker) {
+
+	content, err := json.Marshal(marker)
+	if err != nil {
+		slog.Error("saveSessionMarker. Cannot encode the marker", "error", err)
+		return
+	}
+
+	if err := os.WriteFile(folder+"/"+sessionMarkerFile, content, 0644); err != nil {
+		slog.Error("saveSessionMarker. Cannot write the marker", "error", err)
+	}
+}
+
+// readSessionMarker reads the marker of a session cache folder
+func readSessionMarker(folder string) (sessionMarker, error) {
+	var marker sessionMarker
+	content, err := os.ReadFile(filepath.Join(folder, sessionMarkerFile))
+	if err != nil {
+		return marker, err
+	}
+	err = json.Unmarshal(content, &marker)
+	return marker, err
+}
+
+// cacheJanitor removes the expired session folders at regular intervals. Runs in the background
+func cacheJanitor() {
+
+	// The cache size metric is only measured at startup when the cleanup is disabled
+	if cacheCleanupInterval <= 0 {
+		cacheSizeBytes.Set(float64(folderSize(envSegmentifyLiteFolder)))
+		return
+	}
+
+	for {
+		cleanCache()
+		time.Sleep(cacheCleanupInterval)
+	}
+}
+
+// cleanCache applies the retention policy to the cache folder & measures the size of the cache for the metrics
+// The batch downloads write in the cache folder without holding the mutex, their sessions are marked in progress and are kept
+func cleanCache() {
+
+	// Sessions in progress use the cache folder
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sessions, err := listCachedSessions(envSegmentifyLiteFolder)
+	if err != nil {
+		slog.Error("cleanCache. Cannot list the cache folder", "error", err)
+		return
+	}
+
+	expired := expiredSessions(sessions, time.Now())
+
+	totalSize := int64(0)
+	for _, session := range sessions {
+		totalSize += session.Size
+	}
+
+	removedSize := int64(0)
+	for _, session := range expired {
+		if cacheCleanupDryRun {
+			slog.Info("Cache cleanup (dry run). Would remove", "folder", session.Folder, "reason", session.Reason, "sizeKB", session.Size>>10)
+			continue
+		}
+		if err := removeCachedSession(envSegmentifyLiteFolder, session.Folder); err != nil {
+			slog.Error("cleanCache. Cannot remove the session folder", "folder", session.Folder, "error", err)
+			continue
+		}
+		removedSize += session.Size
+	}
+
+	// Size of the cache folder reported in the metrics
+	cacheSizeBytes.Set(float64(totalSize - removedSize))
+
+	if len(expired) > 0 && !cacheCleanupDryRun {
+		slog.Info("Cache cleanup", "foldersRemoved", len(expired), "sizeMB", removedSize>>20)
+		writeLog("", "", "", fmt.Sprintf("Cache cleanup. %d session folders removed", len(expired)))
+	}
+}
+
+// listCachedSessions returns the session folders in the cache folder, oldest first
+// Folders without a marker file use the folder modification time. Symbolic links are ignored
+func listCachedSessions(root string) ([]cachedSession, error) {
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []cachedSession
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+
+		folder := filepath.Join(root, entry.Name())
+		session := cachedSession{Folder: folder}
+
+		marker, err := readSessionMarker(folder)
+		session.Marker = marker
+		if err != nil {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			session.Marker = sessionMarker{Created: info.ModTime()}
+		}
+
+		session.Size = folderSize(folder)
+		sessions = append(sessions, session)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Marker.Created.Before(sessions[j].Marker.Created)
+	})
+
+	return sessions, nil
+}
+
+// expiredSessions returns the sessions removed by the retention policy. Sessions must be sorted oldest first
+func expiredSessions(sessions []cachedSession, now time.Time) []cachedSession {
+
+	var expired []cachedSession
+	removed := make(map[string]bool)
+	remove := func(session cachedSession, reason string) {
+		if removed[session.Folder] {
+			return
+		}
+		removed[session.Folder] = true
+		session.Reason = reason
+		expired = append(expired, session)
+	}
+
+	// Sessions still being written are kept, and not counted in the policies
+	var completeSessions []cachedSession
+	for _, session := range sessions {
+		if !session.inProgress(now) {
+			completeSessions = append(completeSessions, session)
+		}
+	}
+	sessions = completeSessions
+
+	// Maximum age
+	if cacheMaxAge > 0 {
+		for _, session := range sessions {
+			if now.Sub(session.Marker.Created) > cacheMaxAge {
+				remove(session, "older than "+cacheMaxAge.String())
+			}
+		}
+	}
+
+	// Maximum sessions per project. The most recent sessions are kept. Folders without a marker are not included
+	if cacheMaxSessionsPerProject > 0 {
+		projectSessions := make(map[string]int)
+		for i := len(sessions) - 1; i >= 0; i-- {
+			session := sessions[i]
+			if session.Marker.SessionID == "" || removed[session.Folder] {
+				continue
+			}
+			key := session.Marker.Organisation + "/" + session.Marker.Project
+			projectSessions[key]++
+			if projectSessions[key] > cacheMaxSessionsPerProject {
+				remove(session, fmt.Sprintf("more than %d sessions for %s", cacheMaxSessionsPerProject, key))
+			}
+		}
+	}
+
+	// Maximum total size. The oldest sessions are removed first
+	if cacheMaxSize > 0 {
+		totalSize := int64(0)
+		for _, session := range sessions {
+			if !removed[session.Folder] {
+				totalSize += session.Size
+			}
+		}
+		for _, session := range sessions {
+			if totalSize <= cacheMaxSize {
+				break
+			}
+			if removed[session.Folder] {
+				continue
+			}
+			remove(session, fmt.Sprintf("cache larger than %d MB", cacheMaxSize>>20))
+			totalSize -= session.Size
+		}
+	}
+
+	return expired
+}
+
+// inProgress reports whether files may still be written in the session folder
+// Folders without a marker are in progress just after their creation, before the marker is written
+func (session cachedSession) inProgress(now time.Time) bool {
+	if session.Marker.SessionID == "" {
+		return now.Sub(session.Marker.Created) < cacheMarkerGracePeriod
+	}
+	return session.Marker.InProgress && now.Sub(session.Marker.Created) < cacheInProgressTimeout
+}
+
+// removeCachedSession deletes a session folder. Folders outside the cache root (and the root itself) are refused
+func removeCachedSession(root string, folder string) error {
+
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	absoluteRoot, err = filepath.EvalSymlinks(absoluteRoot)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(folder)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 || !info.IsDir() {
+		return errors.New("not a folder")
+	}
+
+	absoluteFolder, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	absoluteFolder, err = filepath.EvalSymlinks(absoluteFolder)
+	if err != nil {
+		return err
+	}
+
+	relative, err := filepath.Rel(absoluteRoot, absoluteFolder)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) || filepath.IsAbs(relative) {
+		return errors.New("the folder is outside the cache folder " + absoluteRoot)
+	}
+
+	return os.RemoveAll(absoluteFolder)
+}
+
+// folderSize returns the total size of the files in a folder
+func folderSize(folder string) int64 {
+	size := int64(0)
+	_ = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
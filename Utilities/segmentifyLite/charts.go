@@ -0,0 +1,227 @@
+// segmentifyLite. Folder, parameter key & subdomain charts displayed on the results page
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"io"
+	"os"
+	"strings"
+)
+
+// Folder, parameter key and subdomain URL counts, sorted by count. Used to generate the charts
+var chartFoldersLevel1 []FolderCount
+var chartFoldersLevel2 []FolderCount
+var chartParameterKeys []FolderCount
+var chartSubDomains []FolderCount
+
+// Maximum number of items displayed in each chart
+var chartMaxFolders = 50
+var chartMaxSubFolders = 20
+var chartMaxParameterKeys = 30
+var chartMaxSubDomains = 15
+
+// Default size for all chart types
+const chartDefaultWidth = "85vw"
+const chartDefaultHeight = "70vh"
+
+// Chart file names
+var chartFolderTreemapFile = "go_seo_folderTreemap.html"
+var chartParameterKeysFile = "go_seo_parameterKeys.html"
+var chartSubDomainsFile = "go_seo_subDomains.html"
+
+// Reset the chart data used in the previous session
+func resetChartData() {
+	chartFoldersLevel1 = nil
+	chartFoldersLevel2 = nil
+	chartParameterKeys = nil
+	chartSubDomains = nil
+}
+
+// Generate the charts and return the HTML used to embed them in the results page
+func generateCharts() string {
+
+	treemapFolders()
+	barParameterKeys()
+	pieSubDomains()
+
+	var builder strings.Builder
+	builder.WriteString("<div class='charts'>\n")
+	builder.WriteString("<h2 style='color: deepskyblue;'>URL analysis</h2>\n")
+	for _, chartFile := range []string{chartFolderTreemapFile, chartParameterKeysFile, chartSubDomainsFile} {
+		builder.WriteString(fmt.Sprintf("<iframe src='%s' title='%s'></iframe>\n", chartFile, strings.TrimSuffix(chartFile, ".html")))
+	}
+	builder.WriteString("</div>\n")
+
+	return builder.String()
+}
+
+// Treemap of the folder hierarchy. Level 2 folders are displayed inside their level 1 folder
+func treemapFolders() {
+
+	treemap := charts.NewTreeMap()
+	treemap.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    "Folder size",
+			Subtitle: "No. of URLs found in each level 1 and level 2 folder. Click a folder to zoom in.",
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			Width:     chartDefaultWidth,
+			Height:    chartDefaultHeight,
+			PageTitle: "Folder size",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true)}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(false)}),
+	)
+
+	var nodes []opts.TreeMapNode
+	for i, folder := range chartFoldersLevel1 {
+		if i >= chartMaxFolders {
+			break
+		}
+
+		node := opts.TreeMapNode{Name: folderPath(folder.Text), Value: folder.Count}
+
+		// Add the level 2 folders found in this folder
+		childURLs := 0
+		for _, subFolder := range chartFoldersLevel2 {
+			if len(node.Children) >= chartMaxSubFolders {
+				break
+			}
+			if strings.HasPrefix(subFolder.Text, folder.Text+"/") {
+				node.Children = append(node.Children, opts.TreeMapNode{Name: folderPath(subFolder.Text), Value: subFolder.Count})
+				childURLs += subFolder.Count
+			}
+		}
+
+		// URLs found directly in the level 1 folder, or in the level 2 folders not displayed
+		if len(node.Children) > 0 && folder.Count > childURLs {
+			node.Children = append(node.Children, opts.TreeMapNode{Name: folderPath(folder.Text) + " (other)", Value: folder.Count - childURLs})
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	treemap.AddSeries("Folders", nodes,
+		charts.WithTreeMapOpts(opts.TreeMapChart{
+			Animation: opts.Bool(true),
+			Roam:      opts.Bool(false),
+			LeafDepth: 1,
+		}),
+		charts.WithItemStyleOpts(opts.ItemStyle{BorderColor: "#fff"}),
+		charts.WithLabelOpts(opts.Label{Show: opts.Bool(true), Position: "inside"}),
+	)
+
+	renderChart(treemap, chartFolderTreemapFile)
+}
+
+// Bar chart of the parameter key frequency
+func barParameterKeys() {
+
+	bar := charts.NewBar()
+	bar.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    "Parameter keys",
+			Subtitle: "No. of URLs using each parameter key.",
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			Width:     chartDefaultWidth,
+			Height:    chartDefaultHeight,
+			PageTitle: "Parameter keys",
+		}),
+		charts.WithColorsOpts(opts.Colors{"DeepSkyBlue"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true)}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(false)}),
+		charts.WithXAxisOpts(opts.XAxis{AxisLabel: &opts.AxisLabel{Rotate: 45, Interval: "0"}}),
+	)
+
+	var keys []string
+	var barData []opts.BarData
+	for i, key := range chartParameterKeys {
+		if i >= chartMaxParameterKeys {
+			break
+		}
+		keys = append(keys, key.Text)
+		barData = append(barData, opts.BarData{Value: key.Count})
+	}
+
+	bar.SetXAxis(keys).AddSeries("URLs", barData)
+
+	renderChart(bar, chartParameterKeysFile)
+}
+
+// Pie chart of the subdomain distribution
+func pieSubDomains() {
+
+	pie := charts.NewPie()
+	pie.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    "Subdomains",
+			Subtitle: "Distribution of URLs across subdomains.",
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			Width:     chartDefaultWidth,
+			Height:    chartDefaultHeight,
+			PageTitle: "Subdomains",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true)}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(false)}),
+	)
+
+	var pieData []opts.PieData
+	otherURLs := 0
+	for i, subDomain := range chartSubDomains {
+		if i >= chartMaxSubDomains {
+			otherURLs += subDomain.Count
+			continue
+		}
+		pieData = append(pieData, opts.PieData{Name: strings.TrimPrefix(strings.TrimPrefix(subDomain.Text, "https://"), "http://"), Value: subDomain.Count})
+	}
+	if otherURLs > 0 {
+		pieData = append(pieData, opts.PieData{Name: "Other", Value: otherURLs})
+	}
+
+	pie.AddSeries("Subdomains", pieData,
+		charts.WithLabelOpts(opts.Label{Show: opts.Bool(true), Formatter: "{b}: {c} ({d}%)"}),
+		charts.WithPieChartOpts(opts.PieChart{Radius: []string{"35%", "65%"}}),
+	)
+
+	renderChart(pie, chartSubDomainsFile)
+}
+
+// chartRenderer is implemented by all go-echarts charts
+type chartRenderer interface {
+	Render(w io.Writer) error
+}
+
+// Save a chart to the session cache folder
+func renderChart(chart chartRenderer, chartFile string) {
+
+	file, err := os.Create(cacheFolder + "/" + chartFile)
+	if err != nil {
+		logger.Error("renderChart. Cannot create the chart", "file", chartFile, "error", err)
+		return
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("renderChart. Closing", "error", err)
+		}
+	}()
+
+	if err := chart.Render(file); err != nil {
+		logger.Error("renderChart. Cannot render the chart", "file", chartFile, "error", err)
+	}
+}
+
+// Extract the folder path from the folder URL, e.g. https://www.example.com/shoes/boots becomes /shoes/boots
+func folderPath(folderURL string) string {
+	parts := strings.SplitN(folderURL, "/", 4)
+	if len(parts) < 4 {
+		return "/"
+	}
+	return "/" + parts[3]
+}
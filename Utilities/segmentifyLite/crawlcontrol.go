@@ -0,0 +1,510 @@
+// segmentifyLite. Crawl control report. Proposed robots.txt rules & canonicalisation candidates found in the URL analysis
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Name of the report generated in the session cache folder
+var crawlControlFile = "go_seo_crawlControl.html"
+
+// robots.txt uploaded by the user. nil when none is supplied
+var existingRobots *robotsFile
+
+// URLs with at least this number of parameters are considered deep parameter combinations
+var deepParameterCount = 3
+
+// A folder containing dated sub folders (e.g. /events/2024/05/) for at least this number of months is considered a calendar
+var minCalendarMonths = 24
+
+// Number of example URLs listed for each rule
+var maxRuleExamples = 3
+
+// Parameters used for sessions, tracking and sorting. Keys are compared in lower case
+var sessionParameterKeys = []string{"sid", "sessionid", "session_id", "session", "jsessionid", "phpsessid", "sessid", "aspsessionid", "cfid", "cftoken"}
+var trackingParameterKeys = []string{"gclid", "fbclid", "msclkid", "dclid", "gbraid", "wbraid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_gl"}
+var trackingParameterPrefix = "utm_"
+var sortParameterKeys = []string{"sort", "sortby", "sort_by", "order", "orderby", "order_by", "dir", "direction", "view", "display", "limit", "per_page", "perpage", "pagesize", "page_size"}
+var calendarParameterKeys = []string{"date", "day", "month", "year", "week", "calendar", "cal", "start_date", "end_date", "checkin", "checkout"}
+
+var dateValue = regexp.MustCompile(`^(19|20)\d{2}-?(0[1-9]|1[0-2])(-?(0[1-9]|[12]\d|3[01]))?$`)
+var dateFolders = regexp.MustCompile(`^(.*?)/((19|20)\d{2})/(0?[1-9]|1[0-2])(/|$)`)
+
+// crawlRule is a proposed set of robots.txt disallow patterns
+type crawlRule struct {
+	Patterns       []string
+	Reason         string
+	Affected       int // No. of URLs blocked by the rule
+	AlreadyBlocked int // No. of affected URLs already blocked by the existing robots.txt
+	BlockedAfter   int // No. of affected URLs blocked once the rule is added to the existing robots.txt
+	Examples       []string
+}
+
+// canonicalRule is a candidate canonicalisation rule
+type canonicalRule struct {
+	Rule     string
+	Reason   string
+	Affected int // No. of URLs which are not the canonical version
+	Examples []string
+}
+
+// getRobotsFile reads the robots.txt uploaded in the robotsFile form field. Returns nil when no file is uploaded
+func getRobotsFile(r *http.Request) (*robotsFile, error) {
+
+	file, _, err := r.FormFile("robotsFile")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the robots.txt file: %w", err)
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("getRobotsFile. Closing", "error", err)
+		}
+	}()
+
+	return parseRobots(file)
+}
+
+// Generate the crawl control report
+func crawlControlReport() error {
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("crawlControlReport. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	crawlRules := proposeCrawlRules(urls)
+	canonicalRules := proposeCanonicalRules(urls)
+
+	return generateCrawlControlHTML(crawlRules, canonicalRules, len(urls))
+}
+
+// Propose disallow rules for the crawl traps found in the URLs: session IDs, calendars and deep parameter combinations
+func proposeCrawlRules(urls []string) []crawlRule {
+
+	parameterURLs := make(map[string]int)
+	parameterDates := make(map[string]int)
+	calendarMonths := make(map[string]map[string]bool)
+	pathSessionIDs := 0
+
+	for _, url := range urls {
+		path := robotsPath(url)
+		if strings.Contains(strings.ToLower(path), ";jsessionid=") {
+			pathSessionIDs++
+		}
+
+		pathOnly, query, _ := strings.Cut(path, "?")
+		for _, parameter := range strings.Split(query, "&") {
+			key, value, found := strings.Cut(parameter, "=")
+			if !found || key == "" {
+				continue
+			}
+			parameterURLs[key]++
+			if dateValue.MatchString(value) {
+				parameterDates[key]++
+			}
+		}
+
+		// Dated folders, e.g. /events/2024/05/
+		if match := dateFolders.FindStringSubmatch(pathOnly); match != nil {
+			if calendarMonths[match[1]] == nil {
+				calendarMonths[match[1]] = make(map[string]bool)
+			}
+			calendarMonths[match[1]][match[2]+"/"+match[4]] = true
+		}
+	}
+
+	var crawlRules []crawlRule
+
+	if pathSessionIDs > 0 {
+		crawlRules = append(crawlRules, crawlRule{Patterns: []string{"/*;jsessionid="}, Reason: "Session ID in the path"})
+	}
+
+	for _, key := range sortedKeys(parameterURLs) {
+		lowerKey := strings.ToLower(key)
+		patterns := []string{"/*?" + key + "=", "/*&" + key + "="}
+		switch {
+		case containsString(sessionParameterKeys, lowerKey):
+			crawlRules = append(crawlRules, crawlRule{Patterns: patterns, Reason: "Session ID parameter (" + key + ")"})
+		case containsString(calendarParameterKeys, lowerKey) || parameterDates[key]*2 >= parameterURLs[key]:
+			crawlRules = append(crawlRules, crawlRule{Patterns: patterns, Reason: "Calendar / date parameter (" + key + ")"})
+		}
+	}
+
+	// Dated folders at the root (e.g. /2024/05/) are not proposed, the rules would be too broad
+	var calendarFolders []string
+	for folder, months := range calendarMonths {
+		if folder != "" && len(months) >= minCalendarMonths {
+			calendarFolders = append(calendarFolders, folder)
+		}
+	}
+	sort.Strings(calendarFolders)
+	for _, folder := range calendarFolders {
+		crawlRules = append(crawlRules, crawlRule{
+			Patterns: calendarPatterns(folder, calendarMonths[folder]),
+			Reason:   fmt.Sprintf("Calendar. Dated folders found in %s/ for %d months", folder, len(calendarMonths[folder])),
+		})
+	}
+
+	// e.g. /*?*&*& for 3 parameters or more
+	crawlRules = append(crawlRules, crawlRule{
+		Patterns: []string{"/*?" + strings.Repeat("*&", deepParameterCount-1)},
+		Reason:   fmt.Sprintf("Deep parameter combinations (%d parameters or more)", deepParameterCount),
+	})
+
+	// Measure the URLs affected by each rule, and test the rules against the existing robots.txt (rules of the user agent selected)
+	var existingRules []robotsRule
+	if existingRobots != nil {
+		existingRules = existingRobots.agentRules(robotsUserAgent)
+	}
+
+	var measuredRules []crawlRule
+	for _, rule := range crawlRules {
+		var proposedRules []robotsRule
+		for _, pattern := range rule.Patterns {
+			proposedRules = append(proposedRules, newRobotsRule(false, pattern, 0))
+		}
+		combinedRules := append(append([]robotsRule{}, existingRules...), proposedRules...)
+
+		for _, url := range urls {
+			path := robotsPath(url)
+			if robotsAllowed(proposedRules, path) {
+				continue
+			}
+			rule.Affected++
+			if len(rule.Examples) < maxRuleExamples {
+				rule.Examples = append(rule.Examples, url)
+			}
+			if existingRobots != nil && !robotsAllowed(existingRules, path) {
+				rule.AlreadyBlocked++
+			}
+			if !robotsAllowed(combinedRules, path) {
+				rule.BlockedAfter++
+			}
+		}
+
+		if rule.Affected > 0 {
+			measuredRules = append(measuredRules, rule)
+		}
+	}
+
+	sort.SliceStable(measuredRules, func(i, j int) bool { return measuredRules[i].Affected > measuredRules[j].Affected })
+
+	return measuredRules
+}
+
+// Propose canonicalisation rules for the duplicate URLs: tracking & sort parameters, parameter order, case, trailing slash, protocol & www
+func proposeCanonicalRules(urls []string) []canonicalRule {
+
+	var canonicalRules []canonicalRule
+
+	// Tracking & sort parameters
+	parameterRules := make(map[string]*canonicalRule)
+	for _, url := range urls {
+		_, query, _ := strings.Cut(robotsPath(url), "?")
+		for _, parameter := range strings.Split(query, "&") {
+			key, _, _ := strings.Cut(parameter, "=")
+			lowerKey := strings.ToLower(key)
+
+			var reason string
+			switch {
+			case strings.HasPrefix(lowerKey, trackingParameterPrefix) || containsString(trackingParameterKeys, lowerKey):
+				reason = "Tracking parameter"
+			case containsString(sortParameterKeys, lowerKey):
+				reason = "Sort / display parameter"
+			default:
+				continue
+			}
+
+			rule := parameterRules[key]
+			if rule == nil {
+				rule = &canonicalRule{Rule: "Canonical to the URL without the " + key + " parameter", Reason: reason}
+				parameterRules[key] = rule
+			}
+			rule.Affected++
+			if len(rule.Examples) < maxRuleExamples {
+				rule.Examples = append(rule.Examples, url)
+			}
+		}
+	}
+	for _, rule := range parameterRules {
+		canonicalRules = append(canonicalRules, *rule)
+	}
+
+	// URLs which are the same once normalised
+	duplicateRules := []struct {
+		rule      string
+		reason    string
+		normalise func(string) string
+	}{
+		{"Canonical to a single parameter order", "Same parameters in a different order", sortParameters},
+		{"Canonical to the lower case URL", "URLs differing only by case", strings.ToLower},
+		{"Canonical to a single trailing slash convention", "URLs with and without a trailing slash", trimTrailingSlash},
+		{"Canonical to a single protocol & host name", "URLs found on http & https, or with & without www", trimProtocolWWW},
+	}
+	for _, duplicateRule := range duplicateRules {
+		rule := canonicalRule{Rule: duplicateRule.rule, Reason: duplicateRule.reason}
+		firstURLs := make(map[string]string)
+		for _, url := range urls {
+			key := duplicateRule.normalise(url)
+			firstURL, found := firstURLs[key]
+			if !found {
+				firstURLs[key] = url
+				continue
+			}
+			if url == firstURL {
+				continue
+			}
+			rule.Affected++
+			if len(rule.Examples) < maxRuleExamples {
+				rule.Examples = append(rule.Examples, url)
+			}
+		}
+		if rule.Affected > 0 {
+			canonicalRules = append(canonicalRules, rule)
+		}
+	}
+
+	sort.SliceStable(canonicalRules, func(i, j int) bool {
+		if canonicalRules[i].Affected != canonicalRules[j].Affected {
+			return canonicalRules[i].Affected > canonicalRules[j].Affected
+		}
+		return canonicalRules[i].Rule < canonicalRules[j].Rule
+	})
+
+	return canonicalRules
+}
+
+// sortParameters sorts the parameters of a URL
+func sortParameters(url string) string {
+	base, query, found := strings.Cut(url, "?")
+	if !found {
+		return url
+	}
+	parameters := strings.Split(query, "&")
+	sort.Strings(parameters)
+	return base + "?" + strings.Join(parameters, "&")
+}
+
+// trimTrailingSlash removes the trailing slash from the URL path
+func trimTrailingSlash(url string) string {
+	base, query, found := strings.Cut(url, "?")
+	if strings.Count(base, "/") > 3 {
+		base = strings.TrimSuffix(base, "/")
+	}
+	if found {
+		return base + "?" + query
+	}
+	return base
+}
+
+// trimProtocolWWW removes the protocol and www. prefix from the URL
+func trimProtocolWWW(url string) string {
+	if index := strings.Index(url, "://"); index != -1 {
+		url = url[index+3:]
+	}
+	return strings.TrimPrefix(url, "www.")
+}
+
+// calendarPatterns returns the patterns blocking the dated folders of a folder: each year found followed by a month, e.g. /events/2024/0*/
+// robots.txt has no character classes. The two-digit months are matched on their first digit (0 or 1), the other months are listed
+func calendarPatterns(folder string, months map[string]bool) []string {
+
+	var yearMonths []string
+	for yearMonth := range months {
+		yearMonths = append(yearMonths, yearMonth)
+	}
+	sort.Strings(yearMonths)
+
+	found := make(map[string]bool)
+	for _, yearMonth := range yearMonths {
+		year, month, _ := strings.Cut(yearMonth, "/")
+		if len(month) == 2 {
+			found[folder+"/"+year+"/"+month[:1]+"*/"] = true
+		}
+	}
+
+	// January without leading zero (/1/) is already matched by /1*/
+	var patterns []string
+	for _, yearMonth := range yearMonths {
+		year, month, _ := strings.Cut(yearMonth, "/")
+		pattern := folder + "/" + year + "/" + month + "/"
+		if len(month) == 2 {
+			pattern = folder + "/" + year + "/" + month[:1] + "*/"
+		} else if found[folder+"/"+year+"/"+month+"*/"] {
+			continue
+		}
+		if !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys(values map[string]int) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate the crawl control report page
+func generateCrawlControlHTML(crawlRules []crawlRule, canonicalRules []canonicalRule, urlCount int) error {
+
+	var content strings.Builder
+
+	// Proposed robots.txt rules
+	content.WriteString("<h2>Proposed robots.txt rules</h2>\n")
+	// The rules are proposed for the group used by the user agent selected
+	proposedAgent := "*"
+	if existingRobots != nil {
+		proposedAgent = existingRobots.agentGroup(robotsUserAgent)
+		content.WriteString(fmt.Sprintf("<p>The proposed rules have been tested against the robots.txt supplied (user-agent: %s).</p>\n", html.EscapeString(robotsUserAgent)))
+	}
+	content.WriteString("<table>\n<tr><th>Rule</th><th>Reason</th><th>URLs affected</th>")
+	if existingRobots != nil {
+		content.WriteString("<th>Already blocked</th><th>Blocked once added</th>")
+	}
+	content.WriteString("<th>Examples</th></tr>\n")
+
+	var proposedRobots strings.Builder
+	proposedRobots.WriteString("User-agent: " + proposedAgent + "\n")
+	for _, rule := range crawlRules {
+		var patterns []string
+		for _, pattern := range rule.Patterns {
+			patterns = append(patterns, html.EscapeString("Disallow: "+pattern))
+		}
+		content.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td>%s</td><td>%d (%.1f%%)</td>",
+			strings.Join(patterns, "<br>"), html.EscapeString(rule.Reason), rule.Affected, percentage(rule.Affected, urlCount)))
+		if existingRobots != nil {
+			note := ""
+			if rule.AlreadyBlocked == rule.Affected {
+				note = " Already covered"
+			} else if rule.BlockedAfter < rule.Affected {
+				note = " Partly overridden by an Allow rule"
+			}
+			content.WriteString(fmt.Sprintf("<td>%d</td><td>%d%s</td>", rule.AlreadyBlocked, rule.BlockedAfter, note))
+		}
+		content.WriteString("<td>" + examplesHTML(rule.Examples) + "</td></tr>\n")
+
+		proposedRobots.WriteString("# " + rule.Reason + "\n")
+		for _, pattern := range rule.Patterns {
+			proposedRobots.WriteString("Disallow: " + pattern + "\n")
+		}
+	}
+	content.WriteString("</table>\n")
+	if len(crawlRules) > 0 {
+		content.WriteString("<p>Review the rules before adding them to robots.txt:</p>\n<pre>" + html.EscapeString(proposedRobots.String()) + "</pre>\n")
+	} else {
+		content.WriteString("<p>No crawl traps found.</p>\n")
+	}
+
+	// Canonicalisation candidates
+	content.WriteString("<h2>Canonicalisation candidates</h2>\n")
+	content.WriteString("<table>\n<tr><th>Rule</th><th>Reason</th><th>URLs affected</th><th>Examples</th></tr>\n")
+	for _, rule := range canonicalRules {
+		content.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d (%.1f%%)</td><td>%s</td></tr>\n",
+			html.EscapeString(rule.Rule), html.EscapeString(rule.Reason), rule.Affected, percentage(rule.Affected, urlCount), examplesHTML(rule.Examples)))
+	}
+	content.WriteString("</table>\n")
+	if len(canonicalRules) == 0 {
+		content.WriteString("<p>No duplicate URLs found.</p>\n")
+	}
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .report {
+            margin: 30px auto;
+            width: 90%%;
+            color: DimGray;
+        }
+        h2 {
+            color: DeepSkyBlue;
+        }
+        table {
+            width: 100%%;
+            border-collapse: collapse;
+            background-color: white;
+            font-size: 14px;
+        }
+        th, td {
+            padding: 8px;
+            border-bottom: 1px solid #ddd;
+            text-align: left;
+            vertical-align: top;
+            word-break: break-all;
+        }
+        th {
+            background-color: DeepSkyBlue;
+            color: white;
+        }
+        pre {
+            background-color: white;
+            padding: 15px;
+        }
+    </style>
+</head>
+<body>
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite. Crawl control</span>
+</header>
+<div class="report">
+    <p>Organisation: %s, Project: %s. Based on a sample of %d URLs.</p>
+%s</div>
+</body>
+</html>`, html.EscapeString(organisation), html.EscapeString(project), urlCount, content.String())
+
+	return saveHTML(htmlContent, "/"+crawlControlFile)
+}
+
+func examplesHTML(examples []string) string {
+	for i, example := range examples {
+		examples[i] = html.EscapeString(example)
+	}
+	return strings.Join(examples, "<br>")
+}
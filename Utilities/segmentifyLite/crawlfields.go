@@ -0,0 +1,256 @@
+// segmentifyLite. Segments derived from the Botify crawl fields (page type, indexability, schema types etc.)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Temp file used to store the crawl field values of each URL. One JSON object per line
+var urlFieldsFile = "siteurlsFields.tmp"
+
+// Crawl fields requested in the current session & the default fields defined in segmentifyLite.ini
+var crawlFields []string
+var defaultCrawlFields []string
+
+// Maximum number of crawl fields requested & number of values (labels) per field
+var maxCrawlFields = 10
+var maxFieldValues = 10
+
+// Botify field names, e.g. http_code or compliant.is_compliant
+var validCrawlField = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// URLs with this crawl field value (e.g. their schema.org type) are used to learn the PDP regex
+var productFieldValue = "Product"
+
+// urlFields holds the crawl field values of a URL
+type urlFields struct {
+	URL    string              `json:"url"`
+	Fields map[string][]string `json:"fields"`
+}
+
+// parseCrawlFields reads a comma separated list of Botify field names
+func parseCrawlFields(fieldList string) ([]string, error) {
+
+	var fields []string
+	for _, field := range strings.Split(fieldList, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || field == "url" {
+			continue
+		}
+		if !validCrawlField.MatchString(field) {
+			return nil, fmt.Errorf("invalid crawl field name: %q", field)
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) > maxCrawlFields {
+		return nil, fmt.Errorf("too many crawl fields (%d), the maximum is %d", len(fields), maxCrawlFields)
+	}
+
+	return fields, nil
+}
+
+// crawlFieldValues extracts the values of a field from a Botify URL result
+// The field is looked up by its full name first (e.g. "compliant.is_compliant"), then as a path in nested objects
+func crawlFieldValues(result map[string]interface{}, field string) []string {
+
+	if value, ok := result[field]; ok {
+		return fieldValueStrings(value)
+	}
+
+	return nestedFieldValues(result, strings.Split(field, "."))
+}
+
+// nestedFieldValues follows a path in nested objects. Lists of objects return the values of each item (e.g. hreflang.out.url)
+func nestedFieldValues(value interface{}, keys []string) []string {
+
+	if len(keys) == 0 {
+		return fieldValueStrings(value)
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if next, ok := typedValue[keys[0]]; ok {
+			return nestedFieldValues(next, keys[1:])
+		}
+	case []interface{}:
+		var values []string
+		for _, item := range typedValue {
+			values = append(values, nestedFieldValues(item, keys)...)
+		}
+		return values
+	}
+
+	return nil
+}
+
+// fieldValueStrings converts a JSON value to strings. Lists return one string per item
+func fieldValueStrings(value interface{}) []string {
+	switch typedValue := value.(type) {
+	case string:
+		if typedValue == "" {
+			return nil
+		}
+		return []string{typedValue}
+	case float64:
+		return []string{strconv.FormatFloat(typedValue, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(typedValue)}
+	case []interface{}:
+		var values []string
+		for _, item := range typedValue {
+			values = append(values, fieldValueStrings(item)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// Write the crawl field values of a URL to the crawl fields file
+func writeURLFields(file *os.File, url string, result map[string]interface{}, fields []string) error {
+
+	record := urlFields{URL: url, Fields: make(map[string][]string)}
+	for _, field := range fields {
+		record.Fields[field] = crawlFieldValues(result, field)
+	}
+
+	recordData, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(recordData, '\n'))
+	return err
+}
+
+// Read the crawl field values acquired by processURLs
+func readURLFields() ([]urlFields, error) {
+
+	file, err := os.Open(urlFieldsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("readURLFields. Closing", "error", err)
+		}
+	}()
+
+	var records []urlFields
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record urlFields
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Generate one segment per crawl field. Each label is a path regex learned from the URLs sharing the same field value
+// Field values which cannot be identified by their URL pattern are listed as comments
+func crawlFieldSegments() error {
+
+	if len(crawlFields) == 0 {
+		return nil
+	}
+
+	// The crawl field values are not available when the URLs are uploaded
+	records, err := readURLFields()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		logger.Error("crawlFieldSegments. Cannot read the crawl field values", "error", err)
+		return err
+	}
+
+	allURLs := make([]string, len(records))
+	for i, record := range records {
+		allURLs[i] = record.URL
+	}
+
+	for _, field := range crawlFields {
+
+		// Group the URLs by field value
+		valueURLs := make(map[string][]string)
+		for _, record := range records {
+			for _, value := range record.Fields[field] {
+				valueURLs[value] = append(valueURLs[value], record.URL)
+			}
+		}
+
+		var sortedValues []FolderCount
+		for value, urls := range valueURLs {
+			sortedValues = append(sortedValues, FolderCount{value, len(urls)})
+		}
+		sort.Slice(sortedValues, func(i, j int) bool {
+			if sortedValues[i].Count != sortedValues[j].Count {
+				return sortedValues[i].Count > sortedValues[j].Count
+			}
+			return sortedValues[i].Text < sortedValues[j].Text
+		})
+
+		segmentName := "sl_field_" + strings.ToLower(sanitiseLabel(strings.ReplaceAll(field, ".", "_")))
+
+		var labels []FolderCount
+		var analysis strings.Builder
+		for i, value := range sortedValues {
+			if i >= maxFieldValues {
+				analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d) not segmented, only the top %d values are used\n", value.Text, value.Count, maxFieldValues))
+				continue
+			}
+
+			pattern, ok := learnPathRegex(valueURLs[value.Text], allURLs)
+			if !ok || pattern.Precision < minPatternPrecision {
+				analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d) no URL pattern found\n", value.Text, value.Count))
+				continue
+			}
+
+			labels = append(labels, FolderCount{fmt.Sprintf("@%s\npath rx:%s\n\n", sanitiseLabel(value.Text), pattern.Regex), pattern.Matched})
+			analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d, precision: %.0f%%, recall: %.0f%%)\n", value.Text, value.Count, pattern.Precision*100, pattern.Recall*100))
+
+			// Use the URLs of the product pages to learn the PDP regex
+			if strings.EqualFold(value.Text, productFieldValue) || strings.HasSuffix(value.Text, "/"+productFieldValue) {
+				pdpRegex = pattern.Regex
+				generatePDPRegex = true
+			}
+		}
+
+		// Fields can have several values per URL (e.g. schema types). The most specific labels are written first as the first matching label wins
+		sort.SliceStable(labels, func(i, j int) bool { return labels[i].Count < labels[j].Count })
+
+		var fieldSegment string
+		if len(labels) > 0 {
+			fieldSegment = fmt.Sprintf("\n\n[segment:%s]\n", segmentName)
+			for _, label := range labels {
+				fieldSegment += label.Text
+			}
+			fieldSegment += fmt.Sprintf("@~Other\npath /*\n\n# ----End of %s----\n", segmentName)
+		} else {
+			fieldSegment = fmt.Sprintf("\n\n# No URL pattern found for the crawl field %s, segment %s not generated\n", field, segmentName)
+		}
+		fieldSegment += "# ----Crawl field analysis (" + field + ")----\n" + analysis.String()
+
+		if err := insertStaticRegex(fieldSegment); err != nil {
+			logger.Error("crawlFieldSegments. Cannot write the segment", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+// segmentifyLite. Segment editor. Toggle, rename, reorder & merge labels with a live coverage preview
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goquery/segment"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Name of the file used to save the segments exported from the editor
+var editedSegmentFile = "segment_edited.txt"
+
+// editorRequest is the JSON body sent by the segment editor
+type editorRequest struct {
+	Segments []segment.Segment `json:"segments"`
+}
+
+// editorCoverageResponse holds the URL counts of the edited segments
+type editorCoverageResponse struct {
+	URLCount    int          `json:"urlCount"`
+	Segments    []apiSegment `json:"segments"`
+	SegmentText string       `json:"segmentText"`
+}
+
+// apiCoverage handles POST /api/segments/{sessionID}/coverage
+// Computes the URL counts of the edited segments using the URL sample cached for the session
+func apiCoverage(w http.ResponseWriter, r *http.Request) {
+
+	folder, segments, err := readEditorRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	if !authorizeSession(w, r, r.PathValue("sessionID"), folder) {
+		return
+	}
+
+	classifier, err := segment.CompileSegments(segments)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid segments: " + err.Error()})
+		return
+	}
+
+	countedSegments, urlCount, err := segmentsWithCounts(classifier, folder+"/"+urlSampleFile)
+	if err != nil {
+		slog.Error("apiCoverage. Cannot compute the coverage", "sessionID", r.PathValue("sessionID"), "error", err)
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "cannot compute the coverage: " + err.Error()})
+		return
+	}
+
+	segmentText, err := renderSegments(segments)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot generate the segments"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, editorCoverageResponse{URLCount: urlCount, Segments: countedSegments, SegmentText: segmentText})
+}
+
+// apiExport handles POST /api/segments/{sessionID}/export
+// Saves the edited segments in the session cache folder and returns them as a file
+func apiExport(w http.ResponseWriter, r *http.Request) {
+
+	folder, segments, err := readEditorRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+	if !authorizeSession(w, r, r.PathValue("sessionID"), folder) {
+		return
+	}
+
+	segmentText, err := renderSegments(segments)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "cannot generate the segments"})
+		return
+	}
+
+	// The exported segment file must compile (segment.CompileReader parses it, then uses segment.CompileSegments). Invalid regex patterns are rejected
+	if _, err := segment.CompileReader(strings.NewReader(segmentText)); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "invalid segments: " + err.Error()})
+		return
+	}
+
+	if err := os.WriteFile(folder+"/"+editedSegmentFile, []byte(segmentText), 0644); err != nil {
+		slog.Error("apiExport. Cannot save the edited segments", "sessionID", r.PathValue("sessionID"), "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+segmentFileName+"\"")
+	if _, err := io.WriteString(w, segmentText); err != nil {
+		slog.Error("apiExport. Cannot write response", "sessionID", r.PathValue("sessionID"), "error", err)
+	}
+}
+
+// readEditorRequest validates the session and the edited segments
+func readEditorRequest(r *http.Request) (folder string, segments []segment.Segment, err error) {
+
+	folder, err = sessionFolder(r.PathValue("sessionID"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var request editorRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxUploadSize)).Decode(&request); err != nil {
+		return "", nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	for i, seg := range request.Segments {
+		segmentName, valid := editorName(seg.Name)
+		if !valid {
+			return "", nil, fmt.Errorf("invalid segment name %q", seg.Name)
+		}
+		request.Segments[i].Name = segmentName
+		for j, label := range seg.Labels {
+			labelName, valid := editorName(label.Name)
+			if !valid {
+				return "", nil, fmt.Errorf("invalid label name in segment %s", segmentName)
+			}
+			request.Segments[i].Labels[j].Name = labelName
+			if !validEditorRules(label.Rules) {
+				return "", nil, fmt.Errorf("invalid rule in label %s of segment %s", labelName, segmentName)
+			}
+		}
+	}
+
+	return folder, request.Segments, nil
+}
+
+// validEditorRules reports whether the fields & patterns of the rules fit on one line of the segment file
+func validEditorRules(rules []segment.Rule) bool {
+	for _, rule := range rules {
+		if strings.ContainsAny(rule.Field, "\r\n") || strings.ContainsAny(rule.Pattern, "\r\n") || !validEditorRules(rule.Or) {
+			return false
+		}
+	}
+	return true
+}
+
+// editorName trims a segment or label name. Names must not be empty or span several lines (a new line could start a segment or a rule)
+func editorName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && !strings.ContainsAny(name, "\r\n")
+}
+
+// renderSegments writes the segments using the Botify segment syntax
+func renderSegments(segments []segment.Segment) (string, error) {
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("# Regex made with love using segmentifyLite %s (edited)\n\n", version))
+
+	if err := segment.Render(&buffer, segments); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// Generate the segment editor page
+func generateSegmentEditor(sessionID string) error {
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite - Segment editor</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+            color: DimGray;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .layout {
+            display: flex;
+            gap: 20px;
+            padding: 20px;
+        }
+        .editor {
+            flex: 3;
+        }
+        .preview {
+            flex: 2;
+            position: sticky;
+            top: 20px;
+            align-self: flex-start;
+        }
+        .preview pre {
+            background-color: white;
+            border: 2px solid LightGray;
+            border-radius: 10px;
+            padding: 10px;
+            height: 75vh;
+            overflow: auto;
+            font-size: 12px;
+        }
+        .segment {
+            background-color: white;
+            border-radius: 10px;
+            padding: 10px 20px;
+            margin-bottom: 20px;
+            box-shadow: 0 4px 6px rgba(0, 0, 0, 0.1);
+        }
+        .segment h3 {
+            color: DeepSkyBlue;
+        }
+        table {
+            border-collapse: collapse;
+            width: 100%%;
+        }
+        td {
+            padding: 4px;
+            border-bottom: 1px solid Cornsilk;
+        }
+        td.count {
+            text-align: right;
+            color: #00796b;
+            width: 90px;
+        }
+        tr.disabled input[type="text"] {
+            text-decoration: line-through;
+            color: LightGray;
+        }
+        input[type="text"] {
+            width: 300px;
+            padding: 4px;
+            border-radius: 5px;
+            border: 1px solid #ccc;
+        }
+        button {
+            padding: 6px 12px;
+            border: none;
+            background-color: DeepSkyBlue;
+            color: white;
+            border-radius: 5px;
+            cursor: pointer;
+        }
+        button:hover {
+            background-color: Green;
+        }
+        .toolbar {
+            margin-bottom: 20px;
+        }
+        .error {
+            color: red;
+            font-weight: bold;
+        }
+    </style>
+</head>
+<body>
+
+<!-- Top Banner -->
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite - Segment editor</span>
+</header>
+
+<div class="layout">
+    <div class="editor">
+        <div class="toolbar">
+            <button onclick="exportSegments()">Export segments</button>
+            <span>URLs in sample: <span id="urlCount">-</span></span>
+            <span class="error" id="error"></span>
+        </div>
+        <div id="segments"></div>
+    </div>
+    <div class="preview">
+        <h3 style="color: DeepSkyBlue;">Preview</h3>
+        <pre id="preview"></pre>
+    </div>
+</div>
+
+<script>
+    const apiURL = '/api/segments/%s';
+    let segments = [];
+
+    // Load the generated segments
+    async function load() {
+        const response = await fetch(apiURL);
+        if (!response.ok) {
+            showError('Cannot load the segments');
+            return;
+        }
+        const data = await response.json();
+        segments = data.segments.map(s => ({
+            name: s.name,
+            unmatchedURLCount: s.unmatchedURLCount,
+            labels: s.labels.map(l => ({name: l.name, rules: l.rules, urlCount: l.urlCount, enabled: true, selected: false}))
+        }));
+        document.getElementById('urlCount').textContent = data.urlCount;
+        document.getElementById('preview').textContent = data.segmentText;
+        render();
+    }
+
+    // The enabled labels are sent to the server
+    function payload() {
+        return JSON.stringify({
+            segments: segments.map(s => ({
+                name: s.name,
+                labels: s.labels.filter(l => l.enabled).map(l => ({name: l.name, rules: l.rules}))
+            }))
+        });
+    }
+
+    // Recompute the coverage server side using the cached URL sample
+    async function recompute() {
+        const response = await fetch(apiURL + '/coverage', {method: 'POST', headers: {'Content-Type': 'application/json'}, body: payload()});
+        const data = await response.json();
+        if (!response.ok) {
+            showError(data.error);
+            return;
+        }
+        showError('');
+        data.segments.forEach((counted, i) => {
+            const counts = new Map(counted.labels.map(l => [l.name, l.urlCount]));
+            segments[i].unmatchedURLCount = counted.unmatchedURLCount;
+            segments[i].labels.forEach(l => l.urlCount = l.enabled ? (counts.get(l.name) || 0) : null);
+        });
+        document.getElementById('preview').textContent = data.segmentText;
+        render();
+    }
+
+    // Download the edited segments
+    async function exportSegments() {
+        const response = await fetch(apiURL + '/export', {method: 'POST', headers: {'Content-Type': 'application/json'}, body: payload()});
+        if (!response.ok) {
+            showError('Cannot export the segments');
+            return;
+        }
+        const blob = await response.blob();
+        const link = document.createElement('a');
+        link.href = URL.createObjectURL(blob);
+        link.download = '%s';
+        link.click();
+        URL.revokeObjectURL(link.href);
+    }
+
+    function moveLabel(segment, index, offset) {
+        const target = index + offset;
+        if (target < 0 || target >= segment.labels.length) {
+            return;
+        }
+        [segment.labels[index], segment.labels[target]] = [segment.labels[target], segment.labels[index]];
+        recompute();
+    }
+
+    // Merge the selected labels into the first selected label. The rules are combined using "or"
+    function mergeLabels(segment) {
+        const selected = segment.labels.filter(l => l.selected);
+        if (selected.length < 2) {
+            showError('Select at least two labels to merge');
+            return;
+        }
+        const rules = [];
+        for (const label of selected) {
+            if (label.rules.length !== 1) {
+                showError('Labels with several rules (' + label.name + ') cannot be merged');
+                return;
+            }
+            const rule = label.rules[0];
+            rule.or ? rules.push(...rule.or) : rules.push(rule);
+        }
+        const merged = selected[0];
+        merged.rules = [{or: rules}];
+        merged.selected = false;
+        merged.enabled = true;
+        segment.labels = segment.labels.filter(l => !l.selected || l === merged);
+        recompute();
+    }
+
+    function render() {
+        const container = document.getElementById('segments');
+        container.replaceChildren();
+        segments.forEach(segment => {
+            const block = document.createElement('div');
+            block.className = 'segment';
+            const title = document.createElement('h3');
+            title.textContent = segment.name;
+            block.appendChild(title);
+
+            const table = document.createElement('table');
+            segment.labels.forEach((label, index) => {
+                const row = table.insertRow();
+                row.className = label.enabled ? '' : 'disabled';
+
+                const enabled = document.createElement('input');
+                enabled.type = 'checkbox';
+                enabled.checked = label.enabled;
+                enabled.title = 'Include this label';
+                enabled.onchange = () => { label.enabled = enabled.checked; recompute(); };
+                row.insertCell().appendChild(enabled);
+
+                const name = document.createElement('input');
+                name.type = 'text';
+                name.value = label.name;
+                name.onchange = () => { label.name = name.value; recompute(); };
+                row.insertCell().appendChild(name);
+
+                const count = row.insertCell();
+                count.className = 'count';
+                count.textContent = label.urlCount === null ? '-' : label.urlCount + ' URLs';
+
+                const up = document.createElement('button');
+                up.textContent = '▲';
+                up.onclick = () => moveLabel(segment, index, -1);
+                const down = document.createElement('button');
+                down.textContent = '▼';
+                down.onclick = () => moveLabel(segment, index, 1);
+                const moveCell = row.insertCell();
+                moveCell.append(up, ' ', down);
+
+                const select = document.createElement('input');
+                select.type = 'checkbox';
+                select.checked = label.selected;
+                select.title = 'Select to merge';
+                select.onchange = () => { label.selected = select.checked; };
+                row.insertCell().appendChild(select);
+            });
+            block.appendChild(table);
+
+            const footer = document.createElement('p');
+            footer.textContent = 'Unmatched URLs: ' + segment.unmatchedURLCount + ' ';
+            const merge = document.createElement('button');
+            merge.textContent = 'Merge selected';
+            merge.onclick = () => mergeLabels(segment);
+            footer.appendChild(merge);
+            block.appendChild(footer);
+
+            container.appendChild(block);
+        });
+    }
+
+    function showError(message) {
+        document.getElementById('error').textContent = message;
+    }
+
+    document.addEventListener('DOMContentLoaded', load);
+</script>
+
+</body>
+</html>
+`, sessionID, segmentFileName)
+
+	// Save the HTML to a file
+	return saveHTML(htmlContent, "/go_seo_segmentEditor.html")
+}
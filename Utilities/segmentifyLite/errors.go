@@ -0,0 +1,61 @@
+// segmentifyLite. Errors returned when acquiring the URLs & generating the segmentation
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+)
+
+// The project does not exist, has no crawl, or the token cannot access it
+var errNoProjectFound = errors.New("no project found, or no crawl found in the project")
+
+// The Botify API cannot be reached or returned an invalid response
+var errBotifyAPI = errors.New("cannot connect to the Botify API")
+
+// No URLs in the list uploaded by the user
+var errNoURLs = errors.New("no URLs found")
+
+// stageError is returned when a stage of the segmentation fails. Identifies the stage in the message displayed to the user
+type stageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *stageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.Err
+}
+
+// runStatus returns the status of a run, stored in the run history
+func runStatus(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, errNoProjectFound):
+		return "errorNoProjectFound"
+	case errors.Is(err, errNoURLs):
+		return "errorNoURLs"
+	}
+	return "errorProcessURLs"
+}
+
+// errorMessage returns the message displayed to the user when the segmentation fails
+func errorMessage(err error) string {
+	switch {
+	case errors.Is(err, errNoProjectFound):
+		return "No project found. Try another organisation and project name."
+	case errors.Is(err, errNoURLs):
+		return "No URLs found."
+	}
+	return "An error occurred. " + err.Error()
+}
+
+// stageFailed logs the stage which failed and returns the error identifying the stage
+func stageFailed(sessionID string, stage string, err error) error {
+	writeLog(sessionID, organisation, project, "Error. "+stage)
+	return &stageError{stage, err}
+}
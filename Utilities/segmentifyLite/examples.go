@@ -0,0 +1,212 @@
+// segmentifyLite. PDP & PLP segments learned from example URLs supplied by the user
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Example product (PDP) and category (PLP) URLs supplied in the current session
+var pdpExamples []string
+var plpExamples []string
+
+// Maximum number of examples per page type
+var maxExamples = 10000
+
+// Regex learned from the PLP examples. Empty when no examples are supplied
+var plpRegex string
+
+// Measured coverage of the learned regex, written as comments in the PDP & PLP segments
+var pdpAnalysis string
+var plpAnalysis string
+
+// loadExamples reads one example URL (or path) per line. Empty lines and lines starting with # are ignored
+func loadExamples(reader io.Reader) ([]string, error) {
+
+	var examples []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		example := strings.TrimSpace(scanner.Text())
+		if example == "" || strings.HasPrefix(example, "#") {
+			continue
+		}
+		if !strings.HasPrefix(example, "/") && !strings.HasPrefix(example, "http://") && !strings.HasPrefix(example, "https://") {
+			return nil, fmt.Errorf("invalid example URL %q, use a full URL or a path starting with /", example)
+		}
+		examples = append(examples, example)
+		if len(examples) > maxExamples {
+			return nil, fmt.Errorf("too many example URLs, the maximum is %d", maxExamples)
+		}
+	}
+
+	return examples, scanner.Err()
+}
+
+// getExamples reads the example URLs entered in a form field and uploaded in the file field of the same name, e.g. pdpExamples and pdpExamplesFile
+func getExamples(r *http.Request, fieldName string) ([]string, error) {
+
+	var examples []string
+
+	file, _, err := r.FormFile(fieldName + "File")
+	if err == nil {
+		defer func() {
+			if err := file.Close(); err != nil {
+				logger.Error("getExamples. Closing", "error", err)
+			}
+		}()
+		fileExamples, err := loadExamples(file)
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, fileExamples...)
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, fmt.Errorf("cannot read the example URLs file: %w", err)
+	}
+
+	formExamples, err := loadExamples(strings.NewReader(r.Form.Get(fieldName)))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(examples, formExamples...), nil
+}
+
+// Learn the PDP & PLP regex from the examples and measure their coverage against the URLs acquired
+// The PDP regex learned from the examples replaces the regex detected in the URLs or learned from the crawl fields
+func exampleSegments() error {
+
+	plpRegex = ""
+	pdpAnalysis = ""
+	plpAnalysis = ""
+
+	if len(pdpExamples) == 0 && len(plpExamples) == 0 {
+		return nil
+	}
+
+	sampleURLs, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("exampleSegments. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	if len(pdpExamples) > 0 {
+		pdpRegex = generalisePaths(pdpExamples)
+		generatePDPRegex = true
+		pdpAnalysis = examplesAnalysis(pdpRegex, pdpExamples, plpExamples, sampleURLs)
+	}
+
+	if len(plpExamples) > 0 {
+		plpRegex = generalisePaths(plpExamples)
+		plpAnalysis = examplesAnalysis(plpRegex, plpExamples, pdpExamples, sampleURLs)
+	}
+
+	return nil
+}
+
+// examplesAnalysis measures the regex learned from the examples against the URLs acquired
+// The URLs acquired which are examples are the positives. Recall is the share of the positives matched,
+// precision the share of the URLs matched which are positives (see evaluatePathRegex)
+func examplesAnalysis(regex string, examples []string, otherExamples []string, sampleURLs []string) string {
+
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return fmt.Sprintf("# Invalid regex: %v\n", err)
+	}
+
+	positives := examplesFound(examples, sampleURLs)
+	pattern, positiveMatches := evaluatePathRegex(re, positives, sampleURLs)
+
+	analysis := fmt.Sprintf("# Learned from %d example URLs, %d found in the URLs acquired\n", len(examples), len(positives))
+	if len(positives) > 0 {
+		analysis += fmt.Sprintf("# Recall: %.0f%% (%d of the %d examples found matched)\n", pattern.Recall*100, positiveMatches, len(positives))
+		analysis += fmt.Sprintf("# Precision: %.0f%% (%d of the %d URLs matched are examples)\n", pattern.Precision*100, positiveMatches, pattern.Matched)
+	} else {
+		analysis += "# Precision & recall not measured, the examples are not in the URLs acquired\n"
+	}
+	if len(otherExamples) > 0 {
+		otherMatches := patternMatches(re, otherExamples)
+		analysis += fmt.Sprintf("# Examples of the other page type matched: %d of %d\n", otherMatches, len(otherExamples))
+	}
+	analysis += fmt.Sprintf("# Coverage: %.1f%% (URLs found: %d of %d)\n", percentage(pattern.Matched, len(sampleURLs)), pattern.Matched, len(sampleURLs))
+
+	return analysis
+}
+
+// examplesFound returns the URLs acquired which are examples. The path & query string are compared, the host is ignored (examples can be paths)
+func examplesFound(examples []string, sampleURLs []string) []string {
+
+	examplePaths := make(map[string]bool)
+	for _, example := range examples {
+		examplePaths[robotsPath(example)] = true
+	}
+
+	var found []string
+	for _, url := range sampleURLs {
+		if examplePaths[robotsPath(url)] {
+			found = append(found, url)
+		}
+	}
+	return found
+}
+
+// PLP Regex
+func insertPLPRegex() error {
+
+	plpSegment := `
+[segment:sl_PLP]
+@plp
+path rx:` + plpRegex + `
+
+@~Other
+path /*
+
+# ----End of sl_PLP segment----
+` + plpAnalysis
+
+	if err := insertStaticRegex(plpSegment); err != nil {
+		logger.Error("insertPLPRegex. Cannot write the segment", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Read a file containing one URL per line
+func readURLFile(fileName string) ([]string, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("readURLFile. Closing", "error", err)
+		}
+	}()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if url := scanner.Text(); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, scanner.Err()
+}
+
+func percentage(value int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
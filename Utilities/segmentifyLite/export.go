@@ -0,0 +1,327 @@
+// segmentifyLite. Export the generated segmentation to BigQuery, Looker Studio, GA4, JSON & YAML
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"goquery/segment"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Export file names. Saved in the session cache folder
+var exportBigQueryFile = "segment_bigquery.sql"
+var exportLookerStudioFile = "segment_lookerstudio.txt"
+var exportGA4File = "segment_ga4.json"
+var exportJSONFile = "segment_rules.json"
+var exportYAMLFile = "segment_rules.yaml"
+
+// Segments of the current session, compiled once the segmentation is generated
+// The exports, the JSON API & the sitemap coverage use the same compiled segments
+var sessionSegments *segment.Classifier
+
+// Name of the column (or Looker Studio field) containing the full URL
+var exportURLField = "url"
+
+// Placeholder for the BigQuery table containing the URLs
+var exportBigQueryTable = "your_project.your_dataset.your_table"
+
+// Regex used to extract the path and the query string from the full URL
+var pathExtractRegex = `^[a-zA-Z][a-zA-Z0-9+.-]*://[^/?#]*([^?#]*)`
+var queryExtractRegex = `\?([^#]*)`
+
+// Characters not allowed in a BigQuery column name
+var invalidColumnChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// GA4 Data API filter expression. See https://developers.google.com/analytics/devguides/reporting/data/v1/rest/v1beta/FilterExpression
+type ga4FilterExpression struct {
+	AndGroup *ga4FilterExpressionList `json:"andGroup,omitempty"`
+	OrGroup  *ga4FilterExpressionList `json:"orGroup,omitempty"`
+	Filter   *ga4Filter               `json:"filter,omitempty"`
+}
+
+type ga4FilterExpressionList struct {
+	Expressions []ga4FilterExpression `json:"expressions"`
+}
+
+type ga4Filter struct {
+	FieldName    string          `json:"fieldName"`
+	StringFilter ga4StringFilter `json:"stringFilter"`
+}
+
+type ga4StringFilter struct {
+	MatchType     string `json:"matchType"`
+	Value         string `json:"value"`
+	CaseSensitive bool   `json:"caseSensitive"`
+}
+
+// ga4ContentGroup is a content group and the filter used to assign pages to it
+type ga4ContentGroup struct {
+	ContentGroup string              `json:"contentGroup"`
+	Filter       ga4FilterExpression `json:"filter"`
+}
+
+// ga4Segment holds the content groups generated for a segment
+type ga4Segment struct {
+	Segment       string            `json:"segment"`
+	ContentGroups []ga4ContentGroup `json:"contentGroups"`
+}
+
+// exportSegments generates all export formats from the compiled segments of the session
+func exportSegments(segments []segment.Segment) error {
+
+	ga4Content, err := exportGA4(segments)
+	if err != nil {
+		return fmt.Errorf("cannot generate the GA4 export: %w", err)
+	}
+
+	jsonContent, err := json.MarshalIndent(struct {
+		Segments []segment.Segment `json:"segments"`
+	}{segments}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot generate the JSON export: %w", err)
+	}
+
+	exports := map[string]string{
+		exportBigQueryFile:     exportBigQuery(segments),
+		exportLookerStudioFile: exportLookerStudio(segments),
+		exportGA4File:          string(ga4Content),
+		exportJSONFile:         string(jsonContent),
+		exportYAMLFile:         exportYAML(segments),
+	}
+
+	for fileName, content := range exports {
+		if err := os.WriteFile(cacheFolder+"/"+fileName, []byte(content), 0644); err != nil {
+			return fmt.Errorf("cannot write %s: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+// compileSessionSegments compiles the segments written to the regex output file
+func compileSessionSegments() error {
+
+	classifier, err := segment.Compile(regexOutputFile)
+	if err != nil {
+		return fmt.Errorf("cannot compile %s: %w", regexOutputFile, err)
+	}
+
+	sessionSegments = classifier
+	return nil
+}
+
+// exportHeader is used as the comment header of the text based exports
+func exportHeader(commentPrefix string, exportName string) string {
+	return fmt.Sprintf("%s %s made with love using segmentifyLite %s\n%s Organisation name: %s\n%s Project name: %s\n",
+		commentPrefix, exportName, version, commentPrefix, organisation, commentPrefix, project)
+}
+
+// exportBigQuery generates a query adding one CASE WHEN REGEXP_CONTAINS column per segment. NULL when no label matches
+func exportBigQuery(segments []segment.Segment) string {
+
+	fieldExpression := func(field string) string {
+		return field
+	}
+
+	var builder strings.Builder
+	builder.WriteString(exportHeader("--", "BigQuery segmentation"))
+	builder.WriteString(fmt.Sprintf("-- Replace `%s` with the table containing the URLs (column: %s)\n\n", exportBigQueryTable, exportURLField))
+
+	builder.WriteString("WITH urls AS (\n  SELECT\n")
+	builder.WriteString(fmt.Sprintf("    %s AS url,\n", exportURLField))
+	builder.WriteString(fmt.Sprintf("    IFNULL(REGEXP_EXTRACT(%s, %s), '') AS path,\n", exportURLField, quoteSQLString(pathExtractRegex)))
+	builder.WriteString(fmt.Sprintf("    IFNULL(REGEXP_EXTRACT(%s, %s), '') AS query\n", exportURLField, quoteSQLString(queryExtractRegex)))
+	builder.WriteString(fmt.Sprintf("  FROM `%s`\n)\n", exportBigQueryTable))
+
+	builder.WriteString("SELECT\n  url")
+	for _, seg := range segments {
+		builder.WriteString(",\n  CASE\n")
+		for _, label := range seg.Labels {
+			builder.WriteString(fmt.Sprintf("    WHEN %s THEN %s\n", sqlCondition(label.Rules, fieldExpression), quoteSQLString(label.Name)))
+		}
+		builder.WriteString(fmt.Sprintf("    ELSE NULL\n  END AS %s", columnName(seg.Name)))
+	}
+	builder.WriteString("\nFROM urls\n")
+
+	return builder.String()
+}
+
+// exportLookerStudio generates one CASE calculated field per segment. NULL when no label matches
+func exportLookerStudio(segments []segment.Segment) string {
+
+	fieldExpression := func(field string) string {
+		switch field {
+		case segment.FieldPath:
+			return fmt.Sprintf("REGEXP_EXTRACT(%s, %s)", exportURLField, quoteSQLString(pathExtractRegex))
+		case segment.FieldQuery:
+			return fmt.Sprintf("REGEXP_EXTRACT(%s, %s)", exportURLField, quoteSQLString(queryExtractRegex))
+		default:
+			return exportURLField
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(exportHeader("#", "Looker Studio calculated fields"))
+	builder.WriteString(fmt.Sprintf("# Create one calculated field per segment. The %s field must contain the full URL\n", exportURLField))
+
+	for _, seg := range segments {
+		builder.WriteString(fmt.Sprintf("\n# ----Calculated field: %s----\nCASE\n", seg.Name))
+		for _, label := range seg.Labels {
+			builder.WriteString(fmt.Sprintf("  WHEN %s THEN %s\n", sqlCondition(label.Rules, fieldExpression), quoteSQLString(label.Name)))
+		}
+		builder.WriteString("  ELSE NULL\nEND\n")
+	}
+
+	return builder.String()
+}
+
+// sqlCondition generates the REGEXP_CONTAINS condition for the rules of a label
+// Rules are combined with AND, rules in an "or" group are combined with OR
+func sqlCondition(rules []segment.Rule, fieldExpression func(field string) string) string {
+
+	var conditions []string
+	for _, rule := range rules {
+		if rule.IsGroup() {
+			conditions = append(conditions, "("+sqlOrCondition(rule.Or, fieldExpression)+")")
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("REGEXP_CONTAINS(%s, %s)", fieldExpression(rule.Field), quoteSQLString(rule.Regexp())))
+	}
+
+	if len(conditions) == 0 {
+		return "TRUE"
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// sqlOrCondition generates the condition for an "or" group
+func sqlOrCondition(rules []segment.Rule, fieldExpression func(field string) string) string {
+
+	var conditions []string
+	for _, rule := range rules {
+		conditions = append(conditions, sqlCondition([]segment.Rule{rule}, fieldExpression))
+	}
+
+	return strings.Join(conditions, " OR ")
+}
+
+// quoteSQLString quotes a string literal, escaping backslashes and single quotes
+func quoteSQLString(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(text) + "'"
+}
+
+// columnName converts a segment name into a valid column name
+func columnName(segmentName string) string {
+	name := invalidColumnChars.ReplaceAllString(segmentName, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// exportGA4 generates the GA4 content groups. Each content group is described using a GA4 Data API filter expression
+func exportGA4(segments []segment.Segment) ([]byte, error) {
+
+	var ga4Segments []ga4Segment
+	for _, seg := range segments {
+		ga4Seg := ga4Segment{Segment: seg.Name}
+		for _, label := range seg.Labels {
+			ga4Seg.ContentGroups = append(ga4Seg.ContentGroups, ga4ContentGroup{
+				ContentGroup: label.Name,
+				Filter:       ga4Expression(label.Rules, false),
+			})
+		}
+		ga4Segments = append(ga4Segments, ga4Seg)
+	}
+
+	return json.MarshalIndent(struct {
+		Note     string       `json:"note"`
+		Segments []ga4Segment `json:"segments"`
+	}{
+		Note:     "Content groups are evaluated in order, the first matching content group wins",
+		Segments: ga4Segments,
+	}, "", "  ")
+}
+
+// ga4Expression generates the filter expression for a list of rules, combined with AND (or OR for an "or" group)
+func ga4Expression(rules []segment.Rule, orGroup bool) ga4FilterExpression {
+
+	var expressions []ga4FilterExpression
+	for _, rule := range rules {
+		if rule.IsGroup() {
+			expressions = append(expressions, ga4Expression(rule.Or, true))
+			continue
+		}
+		expressions = append(expressions, ga4FilterExpression{Filter: ga4RuleFilter(rule)})
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0]
+	}
+
+	expressionList := &ga4FilterExpressionList{Expressions: expressions}
+	if orGroup {
+		return ga4FilterExpression{OrGroup: expressionList}
+	}
+
+	return ga4FilterExpression{AndGroup: expressionList}
+}
+
+// ga4RuleFilter maps a rule to a GA4 dimension. There is no query string dimension, the page location is used instead
+func ga4RuleFilter(rule segment.Rule) *ga4Filter {
+
+	fieldName := "pageLocation"
+	value := rule.Regexp()
+
+	switch rule.Field {
+	case segment.FieldPath:
+		fieldName = "pagePath"
+	case segment.FieldQuery:
+		if strings.HasPrefix(value, "^") {
+			value = `\?` + value[1:]
+		} else {
+			value = `\?.*` + value
+		}
+	}
+
+	return &ga4Filter{
+		FieldName:    fieldName,
+		StringFilter: ga4StringFilter{MatchType: "PARTIAL_REGEXP", Value: value, CaseSensitive: true},
+	}
+}
+
+// exportYAML generates the neutral rule set in YAML. Strings are always double-quoted
+func exportYAML(segments []segment.Segment) string {
+
+	var builder strings.Builder
+	builder.WriteString(exportHeader("#", "Segment rules"))
+	builder.WriteString("segments:\n")
+
+	for _, seg := range segments {
+		builder.WriteString(fmt.Sprintf("  - name: %s\n    labels:\n", strconv.Quote(seg.Name)))
+		for _, label := range seg.Labels {
+			builder.WriteString(fmt.Sprintf("      - name: %s\n        rules:\n", strconv.Quote(label.Name)))
+			writeYAMLRules(&builder, label.Rules, "          ")
+		}
+	}
+
+	return builder.String()
+}
+
+// writeYAMLRules writes the rules as a YAML list at the specified indentation
+func writeYAMLRules(builder *strings.Builder, rules []segment.Rule, indent string) {
+	for _, rule := range rules {
+		if rule.IsGroup() {
+			builder.WriteString(indent + "- or:\n")
+			writeYAMLRules(builder, rule.Or, indent+"    ")
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("%s- field: %s\n%s  pattern: %s\n", indent, strconv.Quote(rule.Field), indent, strconv.Quote(rule.Pattern)))
+	}
+}
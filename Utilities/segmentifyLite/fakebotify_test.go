@@ -0,0 +1,151 @@
+// segmentifyLite. Fake Botify API used by the tests. Serves the analyses & URLs of the projects in testdata/botify
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"goquery/botifytoken"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Token expected by the fake API
+var fakeBotifyToken = "test-token"
+
+// Folder containing the fixtures. One folder per project, containing analyses.json & urls.txt (one URL per line)
+// Projects with crawl field values use urls.jsonl instead of urls.txt, one Botify URL result per line
+var fakeBotifyFolder = filepath.Join("testdata", "botify")
+
+// newFakeBotify starts a fake Botify API and uses it for the duration of the test
+// GET  /v1/analyses/{organisation}/{project}                 returns analyses.json
+// POST /v1/analyses/{organisation}/{project}/{analysis}/urls returns a page of urls.txt
+// Unknown projects return no analyses, as the Botify API does
+func newFakeBotify(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	fixtures, err := filepath.Abs(fakeBotifyFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/analyses/{organisation}/{project}", func(w http.ResponseWriter, r *http.Request) {
+		content, err := os.ReadFile(filepath.Join(fixtures, r.PathValue("project"), "analyses.json"))
+		if err != nil {
+			writeFakeJSON(t, w, map[string]any{"count": 0, "results": []any{}})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(content)
+	})
+
+	mux.HandleFunc("POST /v1/analyses/{organisation}/{project}/{analysis}/urls", func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Fields []string `json:"fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.Fields) == 0 || payload.Fields[0] != "url" {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		urls, err := readFakeResults(filepath.Join(fixtures, r.PathValue("project")))
+		if err != nil {
+			http.Error(w, "project not found", http.StatusNotFound)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		if page < 1 || size < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		results := []map[string]any{}
+		for i := (page - 1) * size; i < page*size && i < len(urls); i++ {
+			results = append(results, urls[i])
+		}
+		writeFakeJSON(t, w, map[string]any{"count": len(urls), "results": results})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token "+fakeBotifyToken {
+			http.Error(w, `{"detail": "Invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+
+	// Use the fake API. The calls are still recorded in the metrics
+	previousBaseURL, previousBase, previousToken, previousConfig := botifyAPIBaseURL, botifyTransport.Base, envBotifyAPIToken, tokenConfig
+	botifyAPIBaseURL, botifyTransport.Base, envBotifyAPIToken = server.URL, server.Client().Transport, fakeBotifyToken
+	tokenConfig = botifytoken.NewConfig(botifytoken.ModeServer, fakeBotifyToken, nil)
+	botifyToken = fakeBotifyToken
+	t.Cleanup(func() {
+		server.Close()
+		botifyAPIBaseURL, botifyTransport.Base, envBotifyAPIToken, tokenConfig = previousBaseURL, previousBase, previousToken, previousConfig
+		botifyToken = ""
+	})
+
+	return server
+}
+
+// readFakeResults returns the URL results of a project, read from urls.jsonl or urls.txt
+func readFakeResults(folder string) ([]map[string]any, error) {
+
+	content, err := os.ReadFile(filepath.Join(folder, "urls.jsonl"))
+	if err != nil {
+		urls, err := readFakeURLs(filepath.Join(folder, "urls.txt"))
+		if err != nil {
+			return nil, err
+		}
+		results := make([]map[string]any, len(urls))
+		for i, url := range urls {
+			results[i] = map[string]any{"url": url}
+		}
+		return results, nil
+	}
+
+	var results []map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for decoder.More() {
+		var result map[string]any
+		if err := decoder.Decode(&result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func readFakeURLs(fileName string) ([]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			urls = append(urls, scanner.Text())
+		}
+	}
+	return urls, scanner.Err()
+}
+
+func writeFakeJSON(t *testing.T, w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,71 @@
+// segmentifyLite. Health & metrics endpoints. /healthz, /readyz & /metrics (Prometheus)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+	"goquery/metrics"
+	"net/http"
+	"strings"
+)
+
+// Requests served, by route & status code
+var httpRequests = metrics.NewCounter("segmentifylite_http_requests_total", "Requests served by route and status code.", "route", "code")
+var httpRequestDuration = metrics.NewHistogram("segmentifylite_http_request_duration_seconds", "Duration of the requests by route.", metrics.RequestBuckets, "route")
+
+// Segmentation sessions, by status (see runStatus)
+var sessionDuration = metrics.NewHistogram("segmentifylite_session_duration_seconds", "Duration of the segmentation sessions by status.", metrics.SessionBuckets, "status")
+
+// Botify API calls, by endpoint
+var botifyAPIRequests = metrics.NewCounter("segmentifylite_botify_api_requests_total", "Botify API calls by endpoint and status code.", "endpoint", "code")
+var botifyAPIDuration = metrics.NewHistogram("segmentifylite_botify_api_request_duration_seconds", "Latency of the Botify API calls by endpoint.", metrics.APIBuckets, "endpoint")
+var botifyAPIErrors = metrics.NewCounter("segmentifylite_botify_api_errors_total", "Botify API calls failed or answered with an error status by endpoint.", "endpoint")
+
+// Used by botifyClient
+var botifyTransport = &metrics.Transport{
+	Endpoint: botifyEndpoint,
+	Requests: botifyAPIRequests,
+	Duration: botifyAPIDuration,
+	Errors:   botifyAPIErrors,
+}
+
+// Size of the session cache folder. Measured by the cache janitor, the cache is not walked when the metrics are collected
+var cacheSizeBytes = metrics.NewGauge("segmentifylite_cache_size_bytes", "Size of the session cache folder, measured by the cache janitor.")
+
+// Register the health & metrics endpoints. They do not use the mutex and respond while a session is running
+func healthHandlers() {
+	http.HandleFunc("GET /healthz", metrics.Healthz)
+	http.HandleFunc("GET /readyz", metrics.Readyz(
+		metrics.Check{Name: "cache folder", Check: func() error { return metrics.FolderWritable(envSegmentifyLiteFolder) }},
+		metrics.Check{Name: "token", Check: tokenPresent},
+	))
+	http.Handle("GET /metrics", metrics.Handler())
+}
+
+// instrumentedHandler counts the requests served by the default mux
+func instrumentedHandler() http.Handler {
+	return metrics.Instrument(http.DefaultServeMux, httpRequests, httpRequestDuration)
+}
+
+// The users provide their own token in user & proxy modes
+func tokenPresent() error {
+	if envBotifyAPIToken == "" && !tokenConfig.PerUser() {
+		return errors.New("envBotifyAPIToken not set")
+	}
+	return nil
+}
+
+// botifyEndpoint returns the name of the Botify API endpoint called. The organisation, project & analysis are not included
+func botifyEndpoint(req *http.Request) string {
+	path := req.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/urls"):
+		return "urls"
+	case strings.HasPrefix(path, "/v1/analyses/"):
+		return "analyses"
+	case strings.HasPrefix(path, "/v1/projects/"):
+		return "projects"
+	}
+	return "other"
+}
@@ -0,0 +1,367 @@
+// segmentifyLite. Run history. Each run is stored as a JSON line in the log folder. Listed in the admin page & exported as CSV
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the run history file, stored in the log folder
+var historyFile = "_segmentifyLite_history.jsonl"
+
+// Maximum number of runs listed in the admin page. All runs are included in the CSV export
+var maxHistoryRows = 500
+
+// Date format used in the admin page filters
+var historyDateFormat = "2006-01-02"
+
+// runRecord is a segmentation run stored in the history
+type runRecord struct {
+	SessionID    string    `json:"sessionID"`
+	Organisation string    `json:"organisation"`
+	Project      string    `json:"project"`
+	Started      time.Time `json:"started"`
+	Duration     float64   `json:"durationSeconds"`
+	URLCount     int       `json:"urlCount"`
+	Platforms    []string  `json:"platforms,omitempty"`
+	Status       string    `json:"status"`
+	Folder       string    `json:"folder"`
+	Owner        string    `json:"owner,omitempty"`
+}
+
+// historyFilter holds the filters entered in the admin page. User is the logged-in user, empty without authentication
+type historyFilter struct {
+	User         string
+	Organisation string
+	Project      string
+	Status       string
+	From         time.Time
+	To           time.Time
+}
+
+// recordRun appends a run to the history file
+func recordRun(run runRecord) {
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		slog.Error("recordRun. Cannot encode the run", "error", err)
+		return
+	}
+
+	file, err := os.OpenFile(envSegmentifyLiteLogFolder+"/"+historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("recordRun. Cannot open the history file", "error", err)
+		return
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("recordRun. Closing", "error", err)
+		}
+	}()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Error("recordRun. Cannot write to the history file", "error", err)
+	}
+}
+
+// newRunRecord returns the record of the current run. Called when the segmentation is complete
+func newRunRecord(sessionID string, started time.Time, status string) runRecord {
+
+	run := runRecord{
+		SessionID:    sessionID,
+		Organisation: organisation,
+		Project:      project,
+		Started:      started,
+		Duration:     time.Since(started).Seconds(),
+		Status:       status,
+		Folder:       cacheFolder,
+		Owner:        sessionOwner,
+	}
+
+	if status == "success" {
+		if urls, err := readURLFile(urlExtractFile); err == nil {
+			run.URLCount = len(urls)
+		}
+	}
+	if sfccDetected {
+		run.Platforms = append(run.Platforms, "SFCC")
+	}
+	if shopifyDetected {
+		run.Platforms = append(run.Platforms, "Shopify")
+	}
+
+	return run
+}
+
+// readHistory returns the runs matching the filter, most recent first. Invalid lines are ignored
+func readHistory(filter historyFilter) ([]runRecord, error) {
+
+	file, err := os.Open(envSegmentifyLiteLogFolder + "/" + historyFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("readHistory. Closing", "error", err)
+		}
+	}()
+
+	var runs []runRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var run runRecord
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue
+		}
+		if filter.matches(run) {
+			runs = append(runs, run)
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Started.After(runs[j].Started)
+	})
+
+	return runs, scanner.Err()
+}
+
+// matches reports whether a run matches the filter. Organisation & project names are matched on a partial, case-insensitive basis
+// With authentication the users only see their own runs & the runs of the organisations granted to them in the allowlist
+func (filter historyFilter) matches(run runRecord) bool {
+	switch {
+	case authenticator.Enabled() && run.Owner != filter.User && !authenticator.Listed(filter.User, run.Organisation):
+		return false
+	case filter.Organisation != "" && !strings.Contains(strings.ToLower(run.Organisation), strings.ToLower(filter.Organisation)):
+		return false
+	case filter.Project != "" && !strings.Contains(strings.ToLower(run.Project), strings.ToLower(filter.Project)):
+		return false
+	case filter.Status != "" && run.Status != filter.Status:
+		return false
+	case !filter.From.IsZero() && run.Started.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !run.Started.Before(filter.To.AddDate(0, 0, 1)):
+		return false
+	}
+	return true
+}
+
+// getHistoryFilter reads the filter from the query string. Invalid dates are ignored
+func getHistoryFilter(r *http.Request) historyFilter {
+
+	query := r.URL.Query()
+	filter := historyFilter{
+		User:         authenticator.User(r),
+		Organisation: strings.TrimSpace(query.Get("organization")),
+		Project:      strings.TrimSpace(query.Get("project")),
+		Status:       query.Get("status"),
+	}
+	if from, err := time.ParseInLocation(historyDateFormat, query.Get("from"), time.Local); err == nil {
+		filter.From = from
+	}
+	if to, err := time.ParseInLocation(historyDateFormat, query.Get("to"), time.Local); err == nil {
+		filter.To = to
+	}
+
+	return filter
+}
+
+// outputLink returns the link to the segmentation generated by a run
+func (run runRecord) outputLink() string {
+	return sessionURL(run.SessionID, "go_seo_segmentifyLite.html")
+}
+
+// historyCSVHandler handles GET /admin/runs.csv. Exports the runs matching the filter
+func historyCSVHandler(w http.ResponseWriter, r *http.Request) {
+
+	runs, err := readHistory(getHistoryFilter(r))
+	if err != nil {
+		slog.Error("historyCSVHandler. Cannot read the history", "error", err)
+		http.Error(w, "Cannot read the run history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=segmentifyLite_runs.csv")
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"SessionID", "Started", "Organisation", "Project", "DurationSeconds", "URLs", "Platforms", "Status", "Output"})
+	for _, run := range runs {
+		output := ""
+		if run.Status == "success" {
+			output = run.outputLink()
+		}
+		_ = writer.Write([]string{
+			run.SessionID,
+			run.Started.Format(time.RFC3339),
+			run.Organisation,
+			run.Project,
+			strconv.FormatFloat(run.Duration, 'f', 1, 64),
+			strconv.Itoa(run.URLCount),
+			strings.Join(run.Platforms, " "),
+			run.Status,
+			output,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.Error("historyCSVHandler. Cannot write response", "error", err)
+	}
+}
+
+// historyHandler handles GET /admin/runs. Lists the past runs
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+
+	filter := getHistoryFilter(r)
+	runs, err := readHistory(filter)
+	if err != nil {
+		slog.Error("historyHandler. Cannot read the history", "error", err)
+		http.Error(w, "Cannot read the run history", http.StatusInternalServerError)
+		return
+	}
+
+	var rows strings.Builder
+	for i, run := range runs {
+		if i >= maxHistoryRows {
+			break
+		}
+		status := "<span style='color: red;'>" + html.EscapeString(batchStatusMessage(run.Status)) + "</span>"
+		if run.Status == "success" {
+			status = fmt.Sprintf("<a href='%s' target='_blank'>View segmentation</a>", html.EscapeString(run.outputLink()))
+		}
+		rows.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%.1fs</td><td>%d</td><td>%s</td><td>%s</td></tr>\n",
+			run.Started.Local().Format("2006-01-02 15:04:05"), html.EscapeString(run.Organisation), html.EscapeString(run.Project), html.EscapeString(run.SessionID),
+			run.Duration, run.URLCount, html.EscapeString(strings.Join(run.Platforms, ", ")), status))
+	}
+
+	listed := fmt.Sprintf("%d runs found.", len(runs))
+	if len(runs) > maxHistoryRows {
+		listed = fmt.Sprintf("%d runs found, the most recent %d are listed. Export to CSV to see all runs.", len(runs), maxHistoryRows)
+	}
+
+	// Status filter options
+	var statusOptions strings.Builder
+	for _, status := range []string{"", "success", "errorNoProjectFound", "errorNoURLs", "errorProcessURLs"} {
+		statusName := "All"
+		if status != "" {
+			statusName = batchStatusMessage(status)
+		}
+		selected := ""
+		if status == filter.Status {
+			selected = " selected"
+		}
+		statusOptions.WriteString(fmt.Sprintf("<option value='%s'%s>%s</option>", status, selected, html.EscapeString(statusName)))
+	}
+
+	dateValue := func(date time.Time) string {
+		if date.IsZero() {
+			return ""
+		}
+		return date.Format(historyDateFormat)
+	}
+
+	// The CSV export uses the same filters
+	csvQuery := url.Values{}
+	csvQuery.Set("organization", filter.Organisation)
+	csvQuery.Set("project", filter.Project)
+	csvQuery.Set("status", filter.Status)
+	csvQuery.Set("from", dateValue(filter.From))
+	csvQuery.Set("to", dateValue(filter.To))
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .history {
+            margin: 30px auto;
+            width: 90%%;
+            color: LightSlateGray;
+        }
+        form {
+            margin-bottom: 20px;
+        }
+        input, select {
+            margin-right: 10px;
+        }
+        table {
+            width: 100%%;
+            border-collapse: collapse;
+            background-color: white;
+            font-size: 14px;
+        }
+        th, td {
+            padding: 8px;
+            border-bottom: 1px solid #ddd;
+            text-align: left;
+        }
+        th {
+            background-color: DeepSkyBlue;
+            color: white;
+        }
+        a {
+            color: DeepSkyBlue;
+        }
+    </style>
+</head>
+<body>
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite. Run history</span>
+</header>
+<div class="history">
+    <form method="GET" action="/admin/runs">
+        <input type="text" name="organization" placeholder="Organisation" value="%s">
+        <input type="text" name="project" placeholder="Project" value="%s">
+        <select name="status">%s</select>
+        From <input type="date" name="from" value="%s">
+        To <input type="date" name="to" value="%s">
+        <input type="submit" value="Filter">
+        <a href="/admin/runs">Clear</a>
+    </form>
+    <p>%s <a href="/admin/runs.csv?%s">Export to CSV</a></p>
+    <table>
+        <tr><th>Started</th><th>Organisation</th><th>Project</th><th>Session</th><th>Duration</th><th>URLs</th><th>Platforms</th><th>Result</th></tr>
+%s    </table>
+</div>
+</body>
+</html>`, html.EscapeString(filter.Organisation), html.EscapeString(filter.Project), statusOptions.String(),
+		dateValue(filter.From), dateValue(filter.To), html.EscapeString(listed), html.EscapeString(csvQuery.Encode()), rows.String())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write([]byte(htmlContent)); err != nil {
+		slog.Error("historyHandler. Cannot write response", "error", err)
+	}
+}
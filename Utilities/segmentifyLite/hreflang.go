@@ -0,0 +1,199 @@
+// segmentifyLite. Hreflang clusters. Groups the URLs by hreflang cluster completeness using the hreflang crawl fields
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// When true the hreflang fields are requested from the API and the sl_hreflang segment is generated
+var hreflangEnabled = false
+
+// Botify fields containing the locale of a URL & the alternate URLs it declares. Can be changed in segmentifyLite.ini (hreflangLangField, hreflangURLField)
+var hreflangLangField = "hreflang.lang"
+var hreflangURLField = "hreflang.out.url"
+
+// The partial URLs are listed one by one up to this number, above it a path regex is learned
+var maxHreflangURLRules = 200
+
+// Hreflang cluster status of a URL
+const (
+	hreflangComplete = "complete" // All the alternate URLs link back
+	hreflangPartial  = "partial"  // At least one alternate URL does not link back, or was not crawled
+	hreflangNone     = "none"     // No hreflang
+)
+
+// hreflangFields returns the fields requested from the API. The hreflang fields are added to the crawl fields when enabled
+func hreflangFields(fields []string) []string {
+
+	if !hreflangEnabled {
+		return fields
+	}
+
+	requested := append([]string{}, fields...)
+	for _, field := range []string{hreflangLangField, hreflangURLField} {
+		if !containsString(requested, field) {
+			requested = append(requested, field)
+		}
+	}
+
+	return requested
+}
+
+// hreflangStatuses returns the cluster status of each URL
+// A cluster is complete when every alternate URL declared by the page is crawled and declares the page in return
+func hreflangStatuses(records []urlFields) map[string]string {
+
+	alternates := make(map[string]map[string]bool, len(records))
+	for _, record := range records {
+		alternates[record.URL] = make(map[string]bool)
+		for _, alternate := range record.Fields[hreflangURLField] {
+			if alternate != record.URL {
+				alternates[record.URL][alternate] = true
+			}
+		}
+	}
+
+	statuses := make(map[string]string, len(records))
+	for _, record := range records {
+		if len(alternates[record.URL]) == 0 {
+			statuses[record.URL] = hreflangNone
+			continue
+		}
+		statuses[record.URL] = hreflangComplete
+		for alternate := range alternates[record.URL] {
+			if returnLinks, crawled := alternates[alternate]; !crawled || !returnLinks[record.URL] {
+				statuses[record.URL] = hreflangPartial
+				break
+			}
+		}
+	}
+
+	return statuses
+}
+
+// Generate the sl_hreflang segment. Partial clusters are listed first as they are the URLs to fix
+func hreflangSegment() error {
+
+	if !hreflangEnabled {
+		return nil
+	}
+
+	// The crawl field values are not available when the URLs are uploaded
+	records, err := readURLFields()
+	if errors.Is(err, os.ErrNotExist) {
+		if err := insertStaticRegex("\n\n# No hreflang data (the URLs have been uploaded), segment sl_hreflang not generated\n"); err != nil {
+			logger.Error("hreflangSegment. Cannot write to the output file", "error", err)
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		logger.Error("hreflangSegment. Cannot read the crawl field values", "error", err)
+		return err
+	}
+
+	statuses := hreflangStatuses(records)
+
+	allURLs := make([]string, len(records))
+	statusURLs := make(map[string][]string)
+	localeCounts := make(map[string]map[string]int)
+	for i, record := range records {
+		allURLs[i] = record.URL
+		status := statuses[record.URL]
+		statusURLs[status] = append(statusURLs[status], record.URL)
+
+		locale := "(no locale)"
+		if values := record.Fields[hreflangLangField]; len(values) > 0 {
+			locale = strings.ToLower(values[0])
+		}
+		if localeCounts[locale] == nil {
+			localeCounts[locale] = make(map[string]int)
+		}
+		localeCounts[locale][status]++
+	}
+
+	if len(statusURLs[hreflangNone]) == len(records) {
+		if err := insertStaticRegex("\n\n# No hreflang found, segment sl_hreflang not generated\n"); err != nil {
+			logger.Error("hreflangSegment. Cannot write to the output file", "error", err)
+			return err
+		}
+		return nil
+	}
+
+	var builder strings.Builder
+	var analysis strings.Builder
+	builder.WriteString("\n\n[segment:sl_hreflang]\n")
+
+	for _, status := range []string{hreflangPartial, hreflangComplete} {
+		urls := statusURLs[status]
+		if len(urls) == 0 {
+			continue
+		}
+
+		// The partial URLs are listed when there are not too many of them
+		if status == hreflangPartial && len(urls) <= maxHreflangURLRules {
+			sortedURLs := append([]string{}, urls...)
+			sort.Strings(sortedURLs)
+			builder.WriteString("@hreflang/" + status + "\nor (\n")
+			for _, url := range sortedURLs {
+				builder.WriteString(hreflangURLRule(url) + "\n")
+			}
+			builder.WriteString(")\n\n")
+			analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d, listed)\n", status, len(urls)))
+			continue
+		}
+
+		pattern, ok := learnPathRegex(urls, allURLs)
+		if !ok || pattern.Precision < minPatternPrecision {
+			analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d) no URL pattern found\n", status, len(urls)))
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("@hreflang/%s\npath rx:%s\n\n", status, pattern.Regex))
+		analysis.WriteString(fmt.Sprintf("# --%s (URLs found: %d, precision: %.0f%%, recall: %.0f%%)\n", status, len(urls), pattern.Precision*100, pattern.Recall*100))
+	}
+
+	// URLs without hreflang, and the URLs not identified by the patterns above
+	builder.WriteString("@hreflang/none\npath /*\n\n# ----End of sl_hreflang----\n")
+	analysis.WriteString(fmt.Sprintf("# --none (URLs found: %d)\n", len(statusURLs[hreflangNone])))
+
+	builder.WriteString("# ----Hreflang analysis----\n")
+	builder.WriteString(analysis.String())
+	for _, locale := range sortedLocales(localeCounts) {
+		counts := localeCounts[locale]
+		builder.WriteString(fmt.Sprintf("# --%s (complete: %d, partial: %d, none: %d)\n", locale, counts[hreflangComplete], counts[hreflangPartial], counts[hreflangNone]))
+	}
+
+	if err := insertStaticRegex(builder.String()); err != nil {
+		logger.Error("hreflangSegment. Cannot write to the output file", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// hreflangURLRule returns the rule matching a single URL. The URL is escaped, a * in a crawled URL is not a wildcard
+func hreflangURLRule(url string) string {
+	return "url rx:^" + regexp.QuoteMeta(url) + "$"
+}
+
+// sortedLocales returns the locales in alphabetical order, the URLs without a locale last
+func sortedLocales(localeCounts map[string]map[string]int) []string {
+	var locales []string
+	for locale := range localeCounts {
+		locales = append(locales, locale)
+	}
+	sort.Slice(locales, func(i, j int) bool {
+		if (locales[i] == "(no locale)") != (locales[j] == "(no locale)") {
+			return locales[j] == "(no locale)"
+		}
+		return locales[i] < locales[j]
+	})
+	return locales
+}
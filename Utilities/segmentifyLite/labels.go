@@ -0,0 +1,246 @@
+// segmentifyLite. Label sanitisation and user defined label rules
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum number of characters used in a generated label
+var maxLabelLength = 50
+
+// Label used when nothing is left after the label has been sanitised
+var defaultLabel = "Unnamed"
+
+// Separator used in the label rules file between the regex and the label
+var labelRuleSeparator = "=>"
+
+// Label used in the label rules file to exclude a folder from the segment
+var labelRuleExclude = "-"
+
+// Label rules supplied by the user for the current session
+var labelRules []labelRule
+
+// labelRule maps the folders matching a regex to a label. Excluded folders are not written to the segment
+type labelRule struct {
+	pattern *regexp.Regexp
+	label   string
+	exclude bool
+}
+
+// folderLabel holds the folders (and their total URL count) written under a single label
+type folderLabel struct {
+	Label   string
+	Folders []FolderCount
+	Count   int
+}
+
+// loadLabelRules reads the label rules. One rule per line in the format "regex => label"
+// Blank lines and lines starting with # are ignored. Use "regex => -" to exclude the matching folders
+func loadLabelRules(reader io.Reader) ([]labelRule, error) {
+
+	var rules []labelRule
+
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Use the last separator so that the regex can contain "=>"
+		separatorIndex := strings.LastIndex(line, labelRuleSeparator)
+		if separatorIndex == -1 {
+			return nil, fmt.Errorf("label rules line %d: missing %q separator", lineNo, labelRuleSeparator)
+		}
+
+		patternText := strings.TrimSpace(line[:separatorIndex])
+		labelText := strings.TrimSpace(line[separatorIndex+len(labelRuleSeparator):])
+		if patternText == "" || labelText == "" {
+			return nil, fmt.Errorf("label rules line %d: both a regex and a label are required", lineNo)
+		}
+
+		pattern, err := regexp.Compile(patternText)
+		if err != nil {
+			return nil, fmt.Errorf("label rules line %d: invalid regex: %w", lineNo, err)
+		}
+
+		rule := labelRule{pattern: pattern}
+		if labelText == labelRuleExclude {
+			rule.exclude = true
+		} else {
+			rule.label = sanitiseLabel(labelText)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read label rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// sanitiseLabel decodes percent-encoded characters, replaces characters which are not allowed in a Botify label
+// and truncates the label to maxLabelLength characters. Forward-slashes are kept to preserve the label hierarchy
+func sanitiseLabel(label string) string {
+
+	// Decode each part of the label individually so that an encoded slash does not create a new level
+	parts := strings.Split(label, "/")
+	for i, part := range parts {
+		if decoded, err := url.PathUnescape(part); err == nil {
+			part = decoded
+		}
+
+		var builder strings.Builder
+		for _, r := range part {
+			switch {
+			case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.':
+				builder.WriteRune(r)
+			default:
+				builder.WriteRune('_')
+			}
+		}
+
+		parts[i] = collapseUnderscores(builder.String())
+	}
+
+	// Remove the empty levels (e.g. from a trailing slash)
+	var levels []string
+	for _, part := range parts {
+		if part != "" {
+			levels = append(levels, part)
+		}
+	}
+	sanitised := strings.Join(levels, "/")
+
+	// Truncate on a rune boundary, never leaving a dangling separator
+	if utf8.RuneCountInString(sanitised) > maxLabelLength {
+		sanitised = string([]rune(sanitised)[:maxLabelLength])
+		sanitised = strings.TrimRight(sanitised, "/_-.")
+	}
+
+	if sanitised == "" {
+		return defaultLabel
+	}
+
+	return sanitised
+}
+
+// collapseUnderscores replaces runs of underscores with a single underscore and trims them from both ends
+func collapseUnderscores(text string) string {
+	for strings.Contains(text, "__") {
+		text = strings.ReplaceAll(text, "__", "_")
+	}
+	return strings.Trim(text, "_")
+}
+
+// applyLabelRules returns the label for a folder path. The first matching rule wins
+// If no rule matches the sanitised default label is used
+func applyLabelRules(folderPath string, defaultFolderLabel string) (label string, excluded bool) {
+	for _, rule := range labelRules {
+		if rule.pattern.MatchString(folderPath) {
+			return rule.label, rule.exclude
+		}
+	}
+	return sanitiseLabel(defaultFolderLabel), false
+}
+
+// groupFolderLabels applies the label rules to the folders. Folders sharing the same label are merged
+// The excluded folders are returned separately so that they can be reported in the analysis comments
+func groupFolderLabels(folders []FolderCount) (labels []folderLabel, excludedFolders []FolderCount) {
+
+	labelIndex := make(map[string]int)
+
+	for _, folder := range folders {
+		// Extract the text after the host name, e.g. "folder" or "folder/subfolder"
+		parts := strings.SplitN(folder.Text, "/", 4)
+		if len(parts) < 4 || parts[3] == "" {
+			continue
+		}
+
+		label, excluded := applyLabelRules("/"+parts[3], parts[3])
+		if excluded {
+			excludedFolders = append(excludedFolders, folder)
+			continue
+		}
+
+		if i, found := labelIndex[label]; found {
+			labels[i].Folders = append(labels[i].Folders, folder)
+			labels[i].Count += folder.Count
+			continue
+		}
+
+		labelIndex[label] = len(labels)
+		labels = append(labels, folderLabel{Label: label, Folders: []FolderCount{folder}, Count: folder.Count})
+	}
+
+	// Merged labels may now be larger than the labels listed before them
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Count > labels[j].Count
+	})
+
+	return labels, excludedFolders
+}
+
+// folderLabelRegex generates the segment rules for a label. Merged folders are combined using "or"
+func folderLabelRegex(label folderLabel) string {
+
+	if len(label.Folders) == 1 {
+		return fmt.Sprintf("@%s\nurl *%s/*\n\n", label.Label, label.Folders[0].Text)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("@%s\nor (\n", label.Label))
+	for _, folder := range label.Folders {
+		builder.WriteString(fmt.Sprintf("url *%s/*\n", folder.Text))
+	}
+	builder.WriteString(")\n\n")
+
+	return builder.String()
+}
+
+// getLabelRules acquires the label rules from the uploaded rules file and/or the rules entered in the form
+// Rules from the uploaded file are evaluated first
+func getLabelRules(r *http.Request) ([]labelRule, error) {
+
+	var rules []labelRule
+
+	file, _, err := r.FormFile("labelRulesFile")
+	if err == nil {
+		defer func() {
+			if err := file.Close(); err != nil {
+				logger.Error("getLabelRules. Closing", "error", err)
+			}
+		}()
+		fileRules, err := loadLabelRules(file)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, fmt.Errorf("cannot read the label rules file: %w", err)
+	}
+
+	formRules, err := loadLabelRules(strings.NewReader(r.Form.Get("labelRules")))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rules, formRules...), nil
+}
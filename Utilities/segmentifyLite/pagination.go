@@ -0,0 +1,385 @@
+// segmentifyLite. Detect the pagination conventions used in the URLs and generate the sl_pagination segment
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parameters used for page numbers & offsets. Keys are compared in lower case
+var pageParameterKeys = []string{"page", "p", "pg", "paged", "pagenum", "page_number", "pagenumber", "seite", "pagina"}
+var offsetParameterKeys = []string{"start", "offset", "from", "skip", "first"}
+
+// Page numbers in the path, e.g. /page/3/ or /page-3
+var pagePathFormats = []string{"/page/", "/page-"}
+
+// Minimum number of URLs using a convention for it to be detected
+var minPaginationURLs = 10
+
+// Page numbers larger than this are unlikely to be pagination (e.g. product IDs)
+var maxMedianPage = 100
+
+// Page number buckets used as labels. The last bucket has no upper limit
+var paginationBuckets = []struct {
+	label string
+	first int
+	last  int
+}{
+	{"Page_1", 1, 1},
+	{"Page_2-5", 2, 5},
+	{"Page_6-20", 6, 20},
+	{"Page_21+", 21, -1},
+}
+
+// paginationConvention is a way of specifying the page number in the URL
+type paginationConvention struct {
+	Key      string // Parameter key, or path format (e.g. /page/)
+	InPath   bool
+	Step     int // Offset parameters only. No. of items per page
+	URLCount int
+}
+
+// Detect the pagination conventions and generate the sl_pagination segment
+func paginationSegment() error {
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("paginationSegment. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	conventions := detectPagination(urls)
+	if len(conventions) == 0 {
+		if err := insertStaticRegex("\n\n# No pagination found, segment sl_pagination not generated\n"); err != nil {
+			logger.Error("paginationSegment. Cannot write to the output file", "error", err)
+			return err
+		}
+		return nil
+	}
+
+	// Count the URLs in each bucket
+	bucketCounts := make([]int, len(paginationBuckets))
+	deepestPage := 0
+	for _, url := range urls {
+		page, found := pageNumber(url, conventions)
+		if !found {
+			continue
+		}
+		deepestPage = max(deepestPage, page)
+		for i, bucket := range paginationBuckets {
+			if page >= bucket.first && (bucket.last == -1 || page <= bucket.last) {
+				bucketCounts[i]++
+				break
+			}
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\n\n[segment:sl_pagination]\n")
+	for _, bucket := range paginationBuckets {
+		builder.WriteString("@" + bucket.label + "\nor (\n")
+		for _, convention := range conventions {
+			builder.WriteString(paginationRule(convention, bucket.first, bucket.last) + "\n")
+		}
+		builder.WriteString(")\n\n")
+	}
+	builder.WriteString("@~Not_paginated\npath /*\n\n# ----End of sl_pagination----\n")
+
+	builder.WriteString("# ----Pagination analysis----\n")
+	for _, convention := range conventions {
+		builder.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", convention.description(), convention.URLCount))
+	}
+	for i, bucket := range paginationBuckets {
+		builder.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", bucket.label, bucketCounts[i]))
+	}
+	builder.WriteString(fmt.Sprintf("# --Deepest page found: %d\n", deepestPage))
+
+	if err := insertStaticRegex(builder.String()); err != nil {
+		logger.Error("paginationSegment. Cannot write to the output file", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// detectPagination returns the pagination conventions used in at least minPaginationURLs URLs
+func detectPagination(urls []string) []paginationConvention {
+
+	pathValues := make(map[string][]int)
+	parameterValues := make(map[string][]int)
+	parameterCounts := make(map[string]int)
+
+	for _, url := range urls {
+		path, query, _ := strings.Cut(robotsPath(url), "?")
+
+		for _, format := range pagePathFormats {
+			if value, found := pathPageValue(path, format); found {
+				pathValues[format] = append(pathValues[format], value)
+			}
+		}
+
+		for _, parameter := range strings.Split(query, "&") {
+			key, value, found := strings.Cut(parameter, "=")
+			lowerKey := strings.ToLower(key)
+			if !found || !(containsString(pageParameterKeys, lowerKey) || containsString(offsetParameterKeys, lowerKey)) {
+				continue
+			}
+			parameterCounts[key]++
+			if number, err := strconv.Atoi(value); err == nil && number >= 0 {
+				parameterValues[key] = append(parameterValues[key], number)
+			}
+		}
+	}
+
+	var conventions []paginationConvention
+
+	for _, format := range pagePathFormats {
+		if isPageNumbers(pathValues[format]) {
+			conventions = append(conventions, paginationConvention{Key: format, InPath: true, URLCount: len(pathValues[format])})
+		}
+	}
+
+	for _, key := range sortedKeys(parameterCounts) {
+		values := parameterValues[key]
+
+		// Most values must be numeric
+		if len(values) < minPaginationURLs || len(values)*10 < parameterCounts[key]*9 {
+			continue
+		}
+
+		if containsString(offsetParameterKeys, strings.ToLower(key)) {
+			if step := offsetStep(values); step > 1 {
+				conventions = append(conventions, paginationConvention{Key: key, Step: step, URLCount: len(values)})
+			}
+			continue
+		}
+
+		if isPageNumbers(values) {
+			conventions = append(conventions, paginationConvention{Key: key, URLCount: len(values)})
+		}
+	}
+
+	return conventions
+}
+
+// pathPageValue extracts the page number following a path format, e.g. 3 in /blog/page/3/
+func pathPageValue(path string, format string) (int, bool) {
+	index := strings.LastIndex(path, format)
+	if index == -1 {
+		return 0, false
+	}
+	value := strings.TrimSuffix(path[index+len(format):], "/")
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 || strings.HasPrefix(value, "+") {
+		return 0, false
+	}
+	return number, true
+}
+
+// isPageNumbers reports whether the values look like page numbers: several different values, mostly small numbers
+func isPageNumbers(values []int) bool {
+
+	if len(values) < minPaginationURLs {
+		return false
+	}
+
+	sortedValues := append([]int{}, values...)
+	sort.Ints(sortedValues)
+
+	return sortedValues[0] != sortedValues[len(sortedValues)-1] && sortedValues[len(sortedValues)/2] <= maxMedianPage
+}
+
+// offsetStep infers the number of items per page from the offset values (e.g. 20 for start=0, 20, 40...)
+// The greatest common divisor of the values is used. Returns 0 if no step is found
+func offsetStep(values []int) int {
+	step := 0
+	for _, value := range values {
+		step = gcd(step, value)
+	}
+	return step
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// pageNumber returns the page number of a URL. Offsets are converted to page numbers
+func pageNumber(url string, conventions []paginationConvention) (int, bool) {
+
+	path, query, _ := strings.Cut(robotsPath(url), "?")
+
+	for _, convention := range conventions {
+		if convention.InPath {
+			if value, found := pathPageValue(path, convention.Key); found {
+				return max(value, 1), true
+			}
+			continue
+		}
+		for _, parameter := range strings.Split(query, "&") {
+			key, value, _ := strings.Cut(parameter, "=")
+			if key != convention.Key {
+				continue
+			}
+			number, err := strconv.Atoi(value)
+			if err != nil || number < 0 {
+				continue
+			}
+			if convention.Step > 0 {
+				return number/convention.Step + 1, true
+			}
+			return max(number, 1), true
+		}
+	}
+
+	return 0, false
+}
+
+// paginationRule returns the segment rule matching the pages first to last (-1 for no limit) using a convention
+func paginationRule(convention paginationConvention, first int, last int) string {
+
+	// Offsets. Page n covers the offsets (n-1)*step to n*step-1
+	if convention.Step > 0 {
+		lastOffset := -1
+		if last != -1 {
+			lastOffset = last*convention.Step - 1
+		}
+		return fmt.Sprintf("query rx:(^|&)%s=%s(&|$)", regexp.QuoteMeta(convention.Key), numberRangeRegex((first-1)*convention.Step, lastOffset))
+	}
+
+	// Page 0 is considered as page 1
+	if first == 1 {
+		first = 0
+	}
+	if convention.InPath {
+		return fmt.Sprintf("path rx:%s%s/?$", regexp.QuoteMeta(convention.Key), numberRangeRegex(first, last))
+	}
+	return fmt.Sprintf("query rx:(^|&)%s=%s(&|$)", regexp.QuoteMeta(convention.Key), numberRangeRegex(first, last))
+}
+
+// description of the convention used in the analysis comments
+func (convention paginationConvention) description() string {
+	switch {
+	case convention.InPath:
+		return "Page number in the path (" + convention.Key + "N)"
+	case convention.Step > 0:
+		return fmt.Sprintf("Offset parameter %s, %d items per page", convention.Key, convention.Step)
+	}
+	return "Page parameter " + convention.Key
+}
+
+// numberRangeRegex returns a regex matching the integers from first to last (-1 for no limit), e.g. (2[1-9]|[3-9]\d|[1-9]\d{2,}) for 21 and above
+func numberRangeRegex(first int, last int) string {
+
+	var patterns []string
+	if last == -1 {
+		// Numbers with the same number of digits as first, then all longer numbers
+		digits := len(strconv.Itoa(first))
+		patterns = numberRangePatterns(first, pow10(digits)-1)
+		patterns = append(patterns, fmt.Sprintf(`[1-9]\d{%d,}`, digits))
+	} else {
+		patterns = numberRangePatterns(first, last)
+	}
+
+	if len(patterns) == 1 {
+		return patterns[0]
+	}
+	return "(" + strings.Join(patterns, "|") + ")"
+}
+
+// numberRangePatterns splits a range of integers into patterns of numbers with the same number of digits
+func numberRangePatterns(first int, last int) []string {
+
+	if first > last {
+		return nil
+	}
+
+	firstDigits := len(strconv.Itoa(first))
+	if firstDigits != len(strconv.Itoa(last)) {
+		boundary := pow10(firstDigits) - 1
+		return append(numberRangePatterns(first, boundary), numberRangePatterns(boundary+1, last)...)
+	}
+
+	return sameLengthPatterns(strconv.Itoa(first), strconv.Itoa(last))
+}
+
+// sameLengthPatterns returns the patterns matching the numbers from low to high, which have the same number of digits
+func sameLengthPatterns(low string, high string) []string {
+
+	if low == high {
+		return []string{low}
+	}
+	if len(low) == 1 {
+		return []string{digitRange(low[0], high[0])}
+	}
+
+	// Same first digit
+	if low[0] == high[0] {
+		var patterns []string
+		for _, pattern := range sameLengthPatterns(low[1:], high[1:]) {
+			patterns = append(patterns, low[:1]+pattern)
+		}
+		return patterns
+	}
+
+	rest := len(low) - 1
+	zeros := strings.Repeat("0", rest)
+	nines := strings.Repeat("9", rest)
+	anyDigits := `\d`
+	if rest > 1 {
+		anyDigits = fmt.Sprintf(`\d{%d}`, rest)
+	}
+
+	var patterns []string
+
+	// From low to the end of its first digit, e.g. 23-29
+	firstDigit := low[0]
+	if low[1:] != zeros {
+		for _, pattern := range sameLengthPatterns(low[1:], nines) {
+			patterns = append(patterns, low[:1]+pattern)
+		}
+		firstDigit++
+	}
+
+	// From the start of the first digit of high to high, e.g. 50-54
+	lastDigit := high[0]
+	var highPatterns []string
+	if high[1:] != nines {
+		for _, pattern := range sameLengthPatterns(zeros, high[1:]) {
+			highPatterns = append(highPatterns, high[:1]+pattern)
+		}
+		lastDigit--
+	}
+
+	// All the numbers in between, e.g. 30-49
+	if firstDigit <= lastDigit {
+		patterns = append(patterns, digitRange(firstDigit, lastDigit)+anyDigits)
+	}
+
+	return append(patterns, highPatterns...)
+}
+
+func digitRange(first byte, last byte) string {
+	if first == last {
+		return string(first)
+	}
+	if first == '0' && last == '9' {
+		return `\d`
+	}
+	return "[" + string(first) + "-" + string(last) + "]"
+}
+
+func pow10(exponent int) int {
+	result := 1
+	for i := 0; i < exponent; i++ {
+		result *= 10
+	}
+	return result
+}
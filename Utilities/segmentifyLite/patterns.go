@@ -0,0 +1,198 @@
+// segmentifyLite. Learn the URL patterns shared by a set of URLs and express them as a path regex
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Share of the example URLs the learned regex should cover
+var patternCoverage = 0.9
+
+// Maximum number of URL shapes combined in a learned regex
+var maxPatternShapes = 5
+
+// A folder name is kept as is when it's found in at least this share of the example URLs at the same position
+var literalFolderShare = 0.3
+
+// Minimum precision for a learned regex to be used in a segment
+var minPatternPrecision = 0.8
+
+var digitsToken = regexp.MustCompile(`^\d+$`)
+var idToken = regexp.MustCompile(`[-_]\d+$`)
+var extensionToken = regexp.MustCompile(`\.[A-Za-z0-9]{1,5}$`)
+
+// learnedPattern is a path regex learned from a set of example URLs
+type learnedPattern struct {
+	Regex     string
+	Matched   int     // No. of URLs in the sample matching the regex
+	Precision float64 // Share of the URLs matching the regex which are examples
+	Recall    float64 // Share of the examples matching the regex
+}
+
+// learnPathRegex learns a path regex from the example URLs (positives) and evaluates it against all the URLs in the sample
+// The positives must be included in allURLs
+func learnPathRegex(positives []string, allURLs []string) (learnedPattern, bool) {
+
+	var pattern learnedPattern
+
+	if len(positives) == 0 {
+		return pattern, false
+	}
+
+	pattern.Regex = generalisePaths(positives)
+	re, err := regexp.Compile(pattern.Regex)
+	if err != nil {
+		return pattern, false
+	}
+
+	pattern, positiveMatches := evaluatePathRegex(re, positives, allURLs)
+	return pattern, positiveMatches > 0
+}
+
+// evaluatePathRegex measures the precision & recall of a regex against the URLs in the sample. The positives must be included in allURLs
+func evaluatePathRegex(re *regexp.Regexp, positives []string, allURLs []string) (pattern learnedPattern, positiveMatches int) {
+
+	pattern.Regex = re.String()
+	positiveMatches = patternMatches(re, positives)
+	pattern.Matched = patternMatches(re, allURLs)
+
+	if len(positives) > 0 {
+		pattern.Recall = float64(positiveMatches) / float64(len(positives))
+	}
+	if pattern.Matched > 0 {
+		pattern.Precision = float64(positiveMatches) / float64(pattern.Matched)
+	}
+
+	return pattern, positiveMatches
+}
+
+// generalisePaths aligns the folders of the example URLs and returns an anchored regex matching the most common shapes
+// Folder names shared by the examples are kept, the other folder & page names are generalised (see generaliseToken)
+func generalisePaths(examples []string) string {
+
+	var paths [][]string
+	for _, example := range examples {
+		paths = append(paths, strings.Split(urlPath(example), "/"))
+	}
+
+	// Count the folder names found at each position, per number of folders
+	literalCounts := make(map[string]int)
+	depthCounts := make(map[int]int)
+	for _, parts := range paths {
+		depthCounts[len(parts)]++
+		for i, part := range parts {
+			literalCounts[literalKey(len(parts), i, part)]++
+		}
+	}
+
+	// Group the examples by shape
+	shapeCounts := make(map[string]int)
+	for _, parts := range paths {
+		tokens := make([]string, len(parts))
+		for i, part := range parts {
+			// A folder name is kept when it's shared by several examples. The last part is the page name,
+			// keep it only if it's shared by most examples (e.g. index.html)
+			count := literalCounts[literalKey(len(parts), i, part)]
+			share := float64(count) / float64(depthCounts[len(parts)])
+			shared := count >= 2 || depthCounts[len(parts)] == 1
+			if part == "" || (shared && share >= literalFolderShare && (i < len(parts)-1 || share >= patternCoverage)) {
+				tokens[i] = regexp.QuoteMeta(part)
+				continue
+			}
+			tokens[i] = generaliseToken(part)
+		}
+		shapeCounts[strings.Join(tokens, "/")]++
+	}
+
+	var shapes []FolderCount
+	for shape, count := range shapeCounts {
+		shapes = append(shapes, FolderCount{shape, count})
+	}
+	sort.Slice(shapes, func(i, j int) bool {
+		if shapes[i].Count != shapes[j].Count {
+			return shapes[i].Count > shapes[j].Count
+		}
+		return shapes[i].Text < shapes[j].Text
+	})
+
+	// Keep the most common shapes until the target coverage is reached
+	var selectedShapes []string
+	covered := 0
+	for _, shape := range shapes {
+		if len(selectedShapes) >= maxPatternShapes || float64(covered) >= patternCoverage*float64(len(paths)) {
+			break
+		}
+		selectedShapes = append(selectedShapes, shape.Text)
+		covered += shape.Count
+	}
+	sort.Strings(selectedShapes)
+
+	if len(selectedShapes) == 1 {
+		return "^" + selectedShapes[0] + "$"
+	}
+	return "^(" + strings.Join(selectedShapes, "|") + ")$"
+}
+
+// patternMatches returns the number of URLs whose path matches the regex
+func patternMatches(re *regexp.Regexp, urls []string) int {
+	matches := 0
+	for _, url := range urls {
+		if re.MatchString(urlPath(url)) {
+			matches++
+		}
+	}
+	return matches
+}
+
+// generaliseToken replaces a folder or page name with a regex matching names of the same shape
+// e.g. 12345 becomes \d+, red-shoes-123.html becomes [^/]*[-_]\d+\.html
+func generaliseToken(part string) string {
+
+	if digitsToken.MatchString(part) {
+		return `\d+`
+	}
+
+	extension := extensionToken.FindString(part)
+	name := strings.TrimSuffix(part, extension)
+	extension = regexp.QuoteMeta(extension)
+
+	if digitsToken.MatchString(name) {
+		return `\d+` + extension
+	}
+	if idToken.MatchString(name) {
+		return `[^/]*[-_]\d+` + extension
+	}
+	if extension != "" {
+		return `[^/]+` + extension
+	}
+	return `[^/]+`
+}
+
+func literalKey(depth int, position int, part string) string {
+	return fmt.Sprintf("%d/%d/%s", depth, position, part)
+}
+
+// urlPath returns the path of a URL, excluding the query string and fragment. Botify path rules are evaluated against the same value
+func urlPath(rawURL string) string {
+	path := rawURL
+	if index := strings.Index(path, "://"); index != -1 {
+		path = path[index+3:]
+		index = strings.IndexAny(path, "/?#")
+		if index == -1 {
+			return "/"
+		}
+		path = path[index:]
+	}
+	if index := strings.IndexAny(path, "?#"); index != -1 {
+		path = path[:index]
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
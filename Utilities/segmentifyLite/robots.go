@@ -0,0 +1,195 @@
+// segmentifyLite. robots.txt parser. Wildcards (*, $) and longest match as used by Google (RFC 9309)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Maximum size of a robots.txt file. Google ignores the content after 500 KiB
+var maxRobotsSize int64 = 500 << 10
+
+// robotsRule is an allow or disallow directive
+type robotsRule struct {
+	Allow   bool
+	Pattern string
+	Line    int
+	re      *regexp.Regexp
+}
+
+// robotsGroup holds the rules defined for one or more user agents
+type robotsGroup struct {
+	UserAgents []string
+	Rules      []robotsRule
+}
+
+// robotsFile is a parsed robots.txt file
+type robotsFile struct {
+	Groups   []robotsGroup
+	Sitemaps []string
+}
+
+// parseRobots parses a robots.txt file. Unknown directives and invalid lines are ignored
+func parseRobots(reader io.Reader) (*robotsFile, error) {
+
+	robots := &robotsFile{}
+
+	var group *robotsGroup
+	groupHasRules := false
+	lineNumber := 0
+
+	scanner := bufio.NewScanner(io.LimitReader(reader, maxRobotsSize))
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index != -1 {
+			line = line[:index]
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A user agent following rules starts a new group
+			if group == nil || groupHasRules {
+				robots.Groups = append(robots.Groups, robotsGroup{})
+				group = &robots.Groups[len(robots.Groups)-1]
+				groupHasRules = false
+			}
+			group.UserAgents = append(group.UserAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			// Rules found before the first user agent are ignored
+			if group == nil {
+				continue
+			}
+			groupHasRules = true
+			// An empty disallow allows everything, and is the same as no rule
+			if value == "" {
+				continue
+			}
+			group.Rules = append(group.Rules, newRobotsRule(field == "allow", value, lineNumber))
+		case "sitemap":
+			robots.Sitemaps = append(robots.Sitemaps, value)
+		}
+	}
+
+	return robots, scanner.Err()
+}
+
+// newRobotsRule compiles a robots.txt pattern
+func newRobotsRule(allow bool, pattern string, line int) robotsRule {
+	return robotsRule{Allow: allow, Pattern: pattern, Line: line, re: regexp.MustCompile("^" + robotsPatternRegex(pattern))}
+}
+
+// robotsPatternRegex converts a robots.txt pattern to a regex matching from the start of the path
+// * matches any sequence of characters, a trailing $ anchors the end of the URL
+func robotsPatternRegex(pattern string) string {
+
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	regex := strings.Join(parts, ".*")
+	if anchored {
+		regex += "$"
+	}
+	return regex
+}
+
+// agentRules returns the rules applying to a user agent, e.g. googlebot. The rules of the groups selected by agentGroup are combined
+func (robots *robotsFile) agentRules(userAgent string) []robotsRule {
+
+	bestAgent := robots.agentGroup(userAgent)
+
+	// Rules from all groups naming the same user agent are combined
+	var rules []robotsRule
+	for _, group := range robots.Groups {
+		for _, agent := range group.UserAgents {
+			if agent == bestAgent {
+				rules = append(rules, group.Rules...)
+				break
+			}
+		}
+	}
+
+	return rules
+}
+
+// agentGroup returns the user agent of the groups applying to a user agent
+// The groups naming the user agent are used. If there are none, the groups of the most specific user agent matching
+// the start of the user agent name (e.g. googlebot for googlebot-image), otherwise the groups for *
+func (robots *robotsFile) agentGroup(userAgent string) string {
+
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+
+	bestAgent := ""
+	for _, group := range robots.Groups {
+		for _, agent := range group.UserAgents {
+			if agent == "*" || !strings.HasPrefix(userAgent, agent) {
+				continue
+			}
+			if len(agent) > len(bestAgent) {
+				bestAgent = agent
+			}
+		}
+	}
+	if bestAgent == "" {
+		bestAgent = "*"
+	}
+
+	return bestAgent
+}
+
+// robotsMatch returns the rule deciding whether a path is allowed. The longest matching pattern wins, allow wins a tie
+// found is false when no rule matches, in which case the path is allowed
+func robotsMatch(rules []robotsRule, path string) (decidingRule robotsRule, found bool) {
+
+	for _, rule := range rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if !found || len(rule.Pattern) > len(decidingRule.Pattern) || (len(rule.Pattern) == len(decidingRule.Pattern) && rule.Allow && !decidingRule.Allow) {
+			decidingRule = rule
+			found = true
+		}
+	}
+
+	return decidingRule, found
+}
+
+// robotsAllowed reports whether the rules allow a path to be crawled
+func robotsAllowed(rules []robotsRule, path string) bool {
+	rule, found := robotsMatch(rules, path)
+	return !found || rule.Allow
+}
+
+// robotsPath returns the path and query string of a URL, the value robots.txt rules are matched against
+func robotsPath(rawURL string) string {
+	path := rawURL
+	if index := strings.Index(path, "://"); index != -1 {
+		path = path[index+3:]
+		index = strings.IndexAny(path, "/?#")
+		if index == -1 {
+			return "/"
+		}
+		path = path[index:]
+	}
+	if index := strings.IndexByte(path, '#'); index != -1 {
+		path = path[:index]
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
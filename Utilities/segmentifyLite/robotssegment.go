@@ -0,0 +1,255 @@
+// segmentifyLite. Evaluate the robots.txt supplied by the user against the URL sample. Generates the sl_robots segment & the robots.txt report
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// User agent used to select the robots.txt rules
+var defaultRobotsUserAgent = "Googlebot"
+var robotsUserAgent = defaultRobotsUserAgent
+
+// Name of the report generated in the session cache folder
+var robotsReportFile = "go_seo_robots.html"
+
+// Number of level 1 folders listed in the report
+var maxRobotsFolders = 20
+
+// robotsDirective is a robots.txt rule and the URLs it decides
+type robotsDirective struct {
+	Rule     robotsRule
+	URLCount int
+	Examples []string
+}
+
+// Evaluate the robots.txt rules for the selected user agent against the URLs. Generates the sl_robots segment and the report
+func robotsSegment() error {
+
+	if existingRobots == nil {
+		return nil
+	}
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("robotsSegment. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	rules := existingRobots.agentRules(robotsUserAgent)
+
+	// Classify each URL. The deciding directive of each URL is counted
+	directives := make(map[int]*robotsDirective)
+	folderURLs := make(map[string]int)
+	folderBlocked := make(map[string]int)
+	blockedCount := 0
+	for _, url := range urls {
+		folder := robotsFolder(url)
+		folderURLs[folder]++
+
+		rule, found := robotsMatch(rules, robotsPath(url))
+		if !found {
+			continue
+		}
+		if !rule.Allow {
+			blockedCount++
+			folderBlocked[folder]++
+		}
+
+		directive := directives[rule.Line]
+		if directive == nil {
+			directive = &robotsDirective{Rule: rule}
+			directives[rule.Line] = directive
+		}
+		directive.URLCount++
+		if len(directive.Examples) < maxRuleExamples {
+			directive.Examples = append(directive.Examples, url)
+		}
+	}
+
+	if err := insertStaticRegex(robotsSegmentRegex(rules, len(urls), blockedCount)); err != nil {
+		logger.Error("robotsSegment. Cannot write the segment", "error", err)
+		return err
+	}
+
+	var sortedDirectives []robotsDirective
+	for _, directive := range directives {
+		sortedDirectives = append(sortedDirectives, *directive)
+	}
+	sort.Slice(sortedDirectives, func(i, j int) bool {
+		if sortedDirectives[i].URLCount != sortedDirectives[j].URLCount {
+			return sortedDirectives[i].URLCount > sortedDirectives[j].URLCount
+		}
+		return sortedDirectives[i].Rule.Line < sortedDirectives[j].Rule.Line
+	})
+
+	var folders []FolderCount
+	for folder, count := range folderURLs {
+		folders = append(folders, FolderCount{folder, count})
+	}
+	sort.Sort(ByCount(folders))
+
+	return generateRobotsHTML(sortedDirectives, folders, folderBlocked, len(urls), blockedCount, len(rules))
+}
+
+// robotsSegmentRegex translates the robots.txt rules to a segment
+// Segment labels are evaluated in order (first match wins), the rules are therefore sorted by pattern length,
+// with allow rules first for patterns of the same length. Consecutive rules with the same outcome share a label
+func robotsSegmentRegex(rules []robotsRule, urlCount int, blockedCount int) string {
+
+	sortedRules := append([]robotsRule{}, rules...)
+	sort.SliceStable(sortedRules, func(i, j int) bool {
+		if len(sortedRules[i].Pattern) != len(sortedRules[j].Pattern) {
+			return len(sortedRules[i].Pattern) > len(sortedRules[j].Pattern)
+		}
+		return sortedRules[i].Allow && !sortedRules[j].Allow
+	})
+
+	var builder strings.Builder
+	builder.WriteString("\n\n[segment:sl_robots]\n")
+	builder.WriteString(fmt.Sprintf("# robots.txt rules for user-agent: %s. Labels are repeated to keep the robots.txt precedence (longest match wins)\n", robotsUserAgent))
+
+	for i, rule := range sortedRules {
+		if i == 0 || rule.Allow != sortedRules[i-1].Allow {
+			if i > 0 {
+				builder.WriteString(")\n\n")
+			}
+			if rule.Allow {
+				builder.WriteString("@Allowed\nor (\n")
+			} else {
+				builder.WriteString("@Disallowed\nor (\n")
+			}
+		}
+		builder.WriteString(fmt.Sprintf("url rx:%s\n", robotsURLRegex(rule.Pattern)))
+	}
+	if len(sortedRules) > 0 {
+		builder.WriteString(")\n\n")
+	}
+
+	builder.WriteString("@Allowed\npath /*\n\n# ----End of sl_robots----\n")
+	builder.WriteString(fmt.Sprintf("# --Disallowed (URLs found: %d)\n# --Allowed (URLs found: %d)\n", blockedCount, urlCount-blockedCount))
+
+	return builder.String()
+}
+
+// robotsURLRegex converts a robots.txt pattern to a regex matched against the full URL
+func robotsURLRegex(pattern string) string {
+	return "^https?://[^/]+" + robotsPatternRegex(pattern)
+}
+
+// robotsFolder returns the level 1 folder of a URL path, e.g. /shoes
+func robotsFolder(url string) string {
+	path := urlPath(url)
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 3 {
+		return "/"
+	}
+	return "/" + parts[1]
+}
+
+// Generate the robots.txt report page
+func generateRobotsHTML(directives []robotsDirective, folders []FolderCount, folderBlocked map[string]int, urlCount int, blockedCount int, ruleCount int) error {
+
+	var content strings.Builder
+
+	content.WriteString(fmt.Sprintf("<p>User-agent: %s. %d rules apply to this user agent.</p>\n", html.EscapeString(robotsUserAgent), ruleCount))
+	content.WriteString(fmt.Sprintf("<p>Disallowed: %d URLs (%.1f%%). Allowed: %d URLs (%.1f%%).</p>\n",
+		blockedCount, percentage(blockedCount, urlCount), urlCount-blockedCount, percentage(urlCount-blockedCount, urlCount)))
+
+	// Directives deciding the most URLs
+	content.WriteString("<h2>Directives</h2>\n")
+	content.WriteString("<table>\n<tr><th>Line</th><th>Directive</th><th>URLs</th><th>Examples</th></tr>\n")
+	for _, directive := range directives {
+		directiveName := "Disallow"
+		if directive.Rule.Allow {
+			directiveName = "Allow"
+		}
+		content.WriteString(fmt.Sprintf("<tr><td>%d</td><td><code>%s: %s</code></td><td>%d (%.1f%%)</td><td>%s</td></tr>\n",
+			directive.Rule.Line, directiveName, html.EscapeString(directive.Rule.Pattern), directive.URLCount, percentage(directive.URLCount, urlCount), examplesHTML(directive.Examples)))
+	}
+	content.WriteString("</table>\n")
+	if len(directives) == 0 {
+		content.WriteString("<p>No directive matches the URLs.</p>\n")
+	}
+
+	// Level 1 folders. Shows large folders blocked by mistake
+	content.WriteString("<h2>Level 1 folders</h2>\n")
+	content.WriteString("<table>\n<tr><th>Folder</th><th>URLs</th><th>Disallowed</th></tr>\n")
+	for i, folder := range folders {
+		if i >= maxRobotsFolders {
+			break
+		}
+		blocked := folderBlocked[folder.Text]
+		blockedStyle := ""
+		if blocked > 0 {
+			blockedStyle = " style='color: red;'"
+		}
+		content.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%d</td><td%s>%d (%.1f%%)</td></tr>\n",
+			html.EscapeString(folder.Text), folder.Count, blockedStyle, blocked, percentage(blocked, folder.Count)))
+	}
+	content.WriteString("</table>\n")
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .report {
+            margin: 30px auto;
+            width: 90%%;
+            color: DimGray;
+        }
+        h2 {
+            color: DeepSkyBlue;
+        }
+        table {
+            width: 100%%;
+            border-collapse: collapse;
+            background-color: white;
+            font-size: 14px;
+        }
+        th, td {
+            padding: 8px;
+            border-bottom: 1px solid #ddd;
+            text-align: left;
+            vertical-align: top;
+            word-break: break-all;
+        }
+        th {
+            background-color: DeepSkyBlue;
+            color: white;
+        }
+    </style>
+</head>
+<body>
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite. robots.txt</span>
+</header>
+<div class="report">
+    <p>Organisation: %s, Project: %s. Based on a sample of %d URLs.</p>
+%s</div>
+</body>
+</html>`, html.EscapeString(organisation), html.EscapeString(project), urlCount, content.String())
+
+	return saveHTML(htmlContent, "/"+robotsReportFile)
+}
@@ -5,13 +5,16 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gopkg.in/ini.v1"
+	"goquery/logging"
+	"html"
 	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
 	"regexp"
@@ -19,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,18 +49,32 @@ var envSegmentifyLiteLogFolder string
 var envSegmentifyLiteFolder string
 var envSegmentifyLiteHostingMode string
 
+// Botify API base URL & HTTP client. Can be replaced to use another server (e.g. the fake API used by the tests)
+// The API calls are recorded in the metrics (see health.go)
+var botifyAPIBaseURL = "https://api.botify.com"
+var botifyClient = &http.Client{Transport: botifyTransport}
+
+// Logger of the current session, every line carries the session ID, organisation & project (see logging.Session)
+// Set when a session starts. The server logs (startup, cache cleanup, history) use the default logger
+var logger = slog.Default()
+
 // Colours & text formatting
 var purple = "\033[0;35m"
 var red = "\033[0;31m"
 var green = "\033[0;32m"
 var yellow = "\033[0;33m"
 var reset = "\033[0m"
-var lineSeparator = "█" + strings.Repeat("█", 129)
 var clearScreen = "\033[H\033[2J"
 
 // Default input and output files
 var urlExtractFile = "siteurlsExport.tmp"
-var regexOutputFile = "segment.txt"
+var regexOutputFile = segmentFileName
+
+// Name of the segment file. Written in the session cache folder, where the results page fetches it
+var segmentFileName = "segment.txt"
+
+// URL sample kept in the session cache folder
+var urlSampleFile = "siteurlsSample.txt"
 
 // Maximum No. of URLs to process
 var maxURLsToProcess = 100000
@@ -91,13 +109,20 @@ var protocol string
 var cacheFolder string
 var cacheFolderRoot string
 
-// No of executions & generated session ID
-var sessionIDCounter int
+// No of executions & generated session ID. Atomic, the batch mode generates session IDs without holding the mutex
+var sessionIDCounter atomic.Int64
 
 // PDP Regex
 var generatePDPRegex bool
 var isProductURL bool
 
+// Regex used to identify the PDP pages. Replaced by the regex learned from the crawl fields when product pages are found
+var defaultPDPRegex = `[a-zA-Z0-9\-]+-\d+\.html$`
+var pdpRegex = defaultPDPRegex
+
+// Maximum size of the uploaded form data (label rules file)
+var maxUploadSize int64 = 10 << 20
+
 // Declare the mutex
 var mutex sync.Mutex
 
@@ -117,196 +142,513 @@ type FolderCount struct {
 // ByCount implements a sorting interface for FolderCount slice
 type ByCount []FolderCount
 
-func (a ByCount) Len() int           { return len(a) }
-func (a ByCount) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ByCount) Less(i, j int) bool { return a[i].Count > a[j].Count }
+func (a ByCount) Len() int      { return len(a) }
+func (a ByCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByCount) Less(i, j int) bool {
+	// Same count, sort by name so the generated regex is always the same
+	if a[i].Count == a[j].Count {
+		return a[i].Text < a[j].Text
+	}
+	return a[i].Count > a[j].Count
+}
 
 func main() {
 
 	startUp()
 
-	// Serve static files from the current folder
-	fs := http.FileServer(http.Dir("."))
-	http.Handle("/", fs)
+	// Remove the expired session cache folders in the background
+	go cacheJanitor()
+
+	// Serve the static assets. The session outputs are served using the session ID
+	http.Handle("/", authenticator.Require(staticHandler()))
+	http.HandleFunc("GET /sessions/{sessionID}/{file}", sessionFileHandler)
 
 	// Define a handler function for form submission
-	http.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/submit", authenticator.RequireFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// Lock the function until it's complete to prevent race conditions
 		mutex.Lock()
 		defer mutex.Unlock()
 
+		// The user logged in owns the session
+		sessionOwner = authenticator.User(r)
+
 		// Retrieve the form data from the request (org and username)
-		err := r.ParseForm()
-		if err != nil {
-			fmt.Println(red+"Error. Cannot parse form:"+reset, err)
+		// The form is multipart when a label rules file is uploaded
+		err := r.ParseMultipartForm(maxUploadSize)
+		if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			slog.Error("Cannot parse form", "error", err)
 			return
 		}
 		organisation = r.Form.Get("organization")
 		project = r.Form.Get("project")
 
 		// Generate a session ID used for grouping log entries
-		sessionID, err := generateSessionID(8)
+		sessionID, err := generateSessionID(sessionIDLength)
 		if err != nil {
-			fmt.Println(red+"Error. writeLog. Failed generating a session ID: %s"+reset, err)
-			os.Exit(0)
+			slog.Error("Failed generating a session ID", "error", err)
+			http.Error(w, "Cannot create the session", http.StatusInternalServerError)
+			return
 		}
 
+		// Every log line of the session carries the session ID, organisation & project
+		logger = logging.Session(sessionID, organisation, project)
+
 		cacheFolderRoot = envSegmentifyLiteFolder
-		cacheFolder = cacheFolderRoot + "/" + sessionID + organisation
+		cacheFolder = cacheFolderRoot + "/" + sessionID
 
-		createCacheFolder()
+		if err := createCacheFolder(); err != nil {
+			http.Error(w, "Cannot create the session folder", http.StatusInternalServerError)
+			return
+		}
+		writeSessionMarker(cacheFolder, sessionID, organisation, project, sessionOwner)
+		defer completeSessionMarker(cacheFolder)
+
+		// Botify token of the session. Forgotten when the session is complete
+		if err := startTokenSession(r); err != nil {
+			logger.Error("No Botify token", "error", err)
+			writeLog(sessionID, organisation, project, "No Botify token")
+			generateErrorPage("A Botify token is required. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
+		defer endTokenSession()
 
-		// Process URLs
-		dataStatus := processURLs(sessionID)
+		// The organisation & project names are used in the API URLs
+		err = validateName("organisation", organisation)
+		if err == nil {
+			err = validateName("project", project)
+		}
+		if err != nil {
+			logger.Error("Invalid organisation or project name", "error", err)
+			writeLog(sessionID, "", "", "Invalid organisation or project name")
+			generateErrorPage(html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
 
-		// Manage errors
-		// An invalid org/project name has been specified
-		if dataStatus == "errorNoProjectFound" {
-			writeLog(sessionID, organisation, project, "No project found")
-			generateErrorPage("No project found. Try another organisation and project name. (" + organisation + "/" + project + ")")
-			http.Redirect(w, r, cacheFolder+"/"+"go_seo_segmentifyLiteError.html", http.StatusFound)
+		// Organisations the user can query
+		if !authenticator.Allowed(sessionOwner, organisation) {
+			logger.Warn("Organisation not allowed", "user", sessionOwner)
+			writeLog(sessionID, organisation, project, "Organisation not allowed")
+			generateErrorPage("You are not allowed to query this organisation. (" + html.EscapeString(organisation) + ")")
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
 			return
 		}
 
-		// An error occurred in the process URLs function
-		if dataStatus == "errorProcessURLs" {
-			writeLog(sessionID, organisation, project, "No project found")
-			generateErrorPage("Some kind of error occurred when processing URLs. Check the log for more information. (" + organisation + "/" + project + ")")
-			http.Redirect(w, r, cacheFolder+"/"+"go_seo_segmentifyLiteError.html", http.StatusFound)
+		// Label rules used to rename, merge or exclude folders
+		labelRules, err = getLabelRules(r)
+		if err != nil {
+			logger.Error("Invalid label rules", "error", err)
+			writeLog(sessionID, organisation, project, "Invalid label rules")
+			generateErrorPage("The label rules are invalid. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
 			return
 		}
 
-		writeLog(sessionID, organisation, project, "URLs acquired")
+		// Crawl fields used to generate additional segments. Use the defaults if none are specified
+		crawlFields, err = parseCrawlFields(r.Form.Get("crawlFields"))
+		if err != nil {
+			logger.Error("Invalid crawl fields", "error", err)
+			writeLog(sessionID, organisation, project, "Invalid crawl fields")
+			generateErrorPage("The crawl fields are invalid. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
+		if len(crawlFields) == 0 {
+			crawlFields = defaultCrawlFields
+		}
 
-		// Generate the output file to store the regex
-		generateRegexFile()
+		// Hreflang cluster segment
+		hreflangEnabled = r.Form.Get("hreflang") == "on"
 
-		//Level 1 and 2 folders
-		level1and2Folders()
+		// Example PDP & PLP URLs used to learn the page type regex
+		pdpExamples, err = getExamples(r, "pdpExamples")
+		if err == nil {
+			plpExamples, err = getExamples(r, "plpExamples")
+		}
+		if err != nil {
+			logger.Error("Invalid example URLs", "error", err)
+			writeLog(sessionID, organisation, project, "Invalid example URLs")
+			generateErrorPage("The example URLs are invalid. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
 
-		// PDP pages. Only generate if PDP pages have been detected
-		if isProductURL {
-			insertPDPRegex()
+		// robots.txt used to test the proposed crawl control rules
+		existingRobots, err = getRobotsFile(r)
+		if err != nil {
+			logger.Error("Invalid robots.txt", "error", err)
+			writeLog(sessionID, organisation, project, "Invalid robots.txt")
+			generateErrorPage("The robots.txt file is invalid. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
+
+		// User agent used to evaluate the robots.txt
+		robotsUserAgent = strings.TrimSpace(r.Form.Get("robotsUserAgent"))
+		if robotsUserAgent == "" {
+			robotsUserAgent = defaultRobotsUserAgent
+		}
+
+		// Sitemaps used in the sitemap coverage report
+		sitemapSources, err = getSitemaps(r)
+		if err != nil {
+			logger.Error("Invalid sitemaps", "error", err)
+			writeLog(sessionID, organisation, project, "Invalid sitemaps")
+			generateErrorPage("The sitemaps are invalid. " + html.EscapeString(err.Error()))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
+		}
+
+		// Acquire the URLs and generate the segmentation
+		if err := runSegmentation(sessionID, nil); err != nil {
+			generateErrorPage(html.EscapeString(errorMessage(err) + " (" + organisation + "/" + project + ")"))
+			http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLiteError.html"), http.StatusFound)
+			return
 		}
 
-		//Subdomains
-		subDomains()
+		// Display results and clean up
+		finishUp(sessionID)
+
+		// Respond to the client with a success message or redirect to another page
+		http.Redirect(w, r, sessionURL(sessionID, "go_seo_segmentifyLite.html"), http.StatusFound)
+	}))
+
+	// Batch mode. All projects in an organisation
+	http.HandleFunc("POST /batch", authenticator.RequireFunc(batchHandler))
 
-		//Parameter keys
-		parameterKeys()
+	// Run history
+	http.HandleFunc("GET /admin/runs", authenticator.RequireFunc(historyHandler))
+	http.HandleFunc("GET /admin/runs.csv", authenticator.RequireFunc(historyCSVHandler))
 
-		//Parameter keys utilization
-		parameterUsage()
+	// JSON API
+	http.HandleFunc("GET /config", authenticator.RequireFunc(configHandler))
+	http.HandleFunc("POST /api/segments", authenticator.RequireFunc(apiCreateSegments))
+	http.HandleFunc("GET /api/segments/{sessionID}", apiGetSegments)
+	http.HandleFunc("POST /api/segments/{sessionID}/coverage", apiCoverage)
+	http.HandleFunc("POST /api/segments/{sessionID}/export", apiExport)
 
-		//No. of parameter keys
-		noOfParameters()
+	// Login & logout (OIDC)
+	authenticator.RegisterHandlers(http.DefaultServeMux)
 
-		//No. of folders
-		noOfFolders()
+	// Health & metrics
+	healthHandlers()
 
-		// Salesforce Commerce Cloud if detected
-		if sfccDetected {
-			writeLog(sessionID, organisation, project, "SFCC detected")
-			sfccURLs()
+	// Start the HTTP server
+	err := http.ListenAndServe(port, instrumentedHandler())
+	if err != nil {
+		slog.Error("main. Cannot start HTTP server", "error", err)
+		os.Exit(1)
+	}
+}
+
+// Acquire the URLs (from the API or uploaded by the user) and generate the segmentation regex
+// uploadedURLs is nil when the URLs are acquired from the Botify API
+func runSegmentation(sessionID string, uploadedURLs io.Reader) (err error) {
+
+	// Every log line of the session carries the session ID, organisation & project
+	logger = logging.Session(sessionID, organisation, project)
+
+	// Identifies the session cache folder. Used by the cache janitor
+	writeSessionMarker(cacheFolder, sessionID, organisation, project, sessionOwner)
+
+	// The segment file is kept with the session. Concurrent sessions do not overwrite each other's segments
+	regexOutputFile = cacheFolder + "/" + segmentFileName
+
+	// Store the run in the history when complete
+	started := time.Now()
+	defer func() {
+		recordRun(newRunRecord(sessionID, started, runStatus(err)))
+		sessionDuration.Observe(time.Since(started).Seconds(), runStatus(err))
+	}()
+
+	// Reset the platforms detected in the previous session
+	sfccDetected = false
+	shopifyDetected = false
+	generatePDPRegex = false
+	isProductURL = false
+	pdpRegex = defaultPDPRegex
+	sessionSegments = nil
+	resetChartData()
+	_ = os.Remove(urlFieldsFile)
+
+	// Process URLs
+	if uploadedURLs != nil {
+		err = processUploadedURLs(uploadedURLs)
+	} else {
+		err = processURLs(sessionID)
+	}
+
+	// Manage errors
+	// An invalid org/project name has been specified
+	if errors.Is(err, errNoProjectFound) {
+		writeLog(sessionID, organisation, project, "No project found")
+		return err
+	}
+
+	// An error occurred in the process URLs function
+	if err != nil {
+		writeLog(sessionID, organisation, project, "Error processing URLs")
+		return &stageError{"Acquiring the URLs", err}
+	}
+
+	writeLog(sessionID, organisation, project, "URLs acquired")
+
+	// Generate the output file to store the regex
+	if err := generateRegexFile(); err != nil {
+		return stageFailed(sessionID, "Creating the segment file", err)
+	}
+
+	//Level 1 and 2 folders
+	if err := level1and2Folders(); err != nil {
+		return stageFailed(sessionID, "Level 1 & 2 folders", err)
+	}
+
+	//Crawl fields (if requested)
+	if err := crawlFieldSegments(); err != nil {
+		return stageFailed(sessionID, "Crawl fields", err)
+	}
+
+	//Hreflang clusters (if requested)
+	if err := hreflangSegment(); err != nil {
+		return stageFailed(sessionID, "Hreflang", err)
+	}
+
+	//PDP & PLP example URLs (if supplied)
+	if err := exampleSegments(); err != nil {
+		return stageFailed(sessionID, "Example URLs", err)
+	}
+
+	// PDP pages. Only generate if PDP pages have been detected
+	if generatePDPRegex {
+		if err := insertPDPRegex(); err != nil {
+			return stageFailed(sessionID, "PDP", err)
 		}
+	}
 
-		// Shopify if detected
-		if shopifyDetected {
-			writeLog(sessionID, organisation, project, "Shopify detected")
-			shopifyURLs()
+	// PLP pages. Only generate if PLP examples have been supplied
+	if plpRegex != "" {
+		if err := insertPLPRegex(); err != nil {
+			return stageFailed(sessionID, "PLP", err)
 		}
+	}
 
-		//Static resources
-		staticResources()
+	//Subdomains
+	if err := subDomains(); err != nil {
+		return stageFailed(sessionID, "Subdomains", err)
+	}
 
-		writeLog(sessionID, organisation, project, "Regex generated successfully")
+	//Parameter keys
+	if err := parameterKeys(); err != nil {
+		return stageFailed(sessionID, "Parameter keys", err)
+	}
 
-		// Generate the HTML used to present the regex
-		generateSegmentationRegex(sessionID)
+	//Parameter keys utilization
+	if err := parameterUsage(); err != nil {
+		return stageFailed(sessionID, "Parameter keys utilization", err)
+	}
 
-		// Display results and clean up
-		finishUp(sessionID)
+	//No. of parameter keys
+	if err := noOfParameters(); err != nil {
+		return stageFailed(sessionID, "No. of parameter keys", err)
+	}
 
-		// Respond to the client with a success message or redirect to another page
-		http.Redirect(w, r, cacheFolder+"/go_seo_segmentifyLite.html", http.StatusFound)
-	})
+	//No. of folders
+	if err := noOfFolders(); err != nil {
+		return stageFailed(sessionID, "No. of folders", err)
+	}
 
-	// Start the HTTP server
-	err := http.ListenAndServe(port, nil)
-	if err != nil {
-		fmt.Println(red+"Error. main. Cannot start HTTP server.:"+reset, err)
-		os.Exit(1)
+	//Pagination
+	if err := paginationSegment(); err != nil {
+		return stageFailed(sessionID, "Pagination", err)
+	}
+
+	//URL hygiene
+	if err := urlHygieneSegment(); err != nil {
+		return stageFailed(sessionID, "URL hygiene", err)
+	}
+
+	//SPA routes & build artefacts
+	if err := spaRoutesSegment(); err != nil {
+		return stageFailed(sessionID, "SPA routes", err)
+	}
+	if err := buildArtefactsSegment(); err != nil {
+		return stageFailed(sessionID, "Build artefacts", err)
+	}
+
+	// Salesforce Commerce Cloud if detected
+	if sfccDetected {
+		writeLog(sessionID, organisation, project, "SFCC detected")
+		if err := sfccURLs(); err != nil {
+			return stageFailed(sessionID, "SFCC", err)
+		}
+	}
+
+	// Shopify if detected
+	if shopifyDetected {
+		writeLog(sessionID, organisation, project, "Shopify detected")
+		if err := shopifyURLs(); err != nil {
+			return stageFailed(sessionID, "Shopify", err)
+		}
 	}
+
+	//Static resources
+	if err := staticResources(); err != nil {
+		return stageFailed(sessionID, "Static resources", err)
+	}
+
+	//robots.txt (if supplied)
+	if err := robotsSegment(); err != nil {
+		return stageFailed(sessionID, "robots.txt", err)
+	}
+
+	writeLog(sessionID, organisation, project, "Regex generated successfully")
+
+	// The segments are compiled once. Used by the exports, the JSON API & the sitemap coverage
+	if err := compileSessionSegments(); err != nil {
+		return stageFailed(sessionID, "Compiling the segments", err)
+	}
+
+	// Export the segmentation to BigQuery, Looker Studio, GA4, JSON & YAML. The segmentation is still presented if the export fails
+	if err := exportSegments(sessionSegments.Segments()); err != nil {
+		logger.Error("Cannot export the segmentation", "error", err)
+		writeLog(sessionID, organisation, project, "Export failed")
+	}
+
+	// Save the segments and URL counts. Used by the JSON API and the segment editor
+	if err := saveSegmentsResponse(sessionID); err != nil {
+		logger.Error("Cannot save the segments", "error", err)
+		return stageFailed(sessionID, "Saving the segments", err)
+	}
+
+	// Proposed robots.txt rules & canonicalisation candidates
+	if err := crawlControlReport(); err != nil {
+		return stageFailed(sessionID, "Crawl control report", err)
+	}
+
+	// Sitemap coverage for each segment label (if sitemaps are supplied)
+	if err := sitemapCoverageReport(); err != nil {
+		return stageFailed(sessionID, "Sitemap coverage", err)
+	}
+
+	// Generate the HTML used to present the regex
+	if err := generateSegmentationRegex(sessionID); err != nil {
+		return stageFailed(sessionID, "Generating the HTML", err)
+	}
+
+	return nil
 }
 
 // Use the API to get the first 300k URLs and export them to a temp file
-func processURLs(sessionID string) string {
+func processURLs(sessionID string) error {
+
+	// The hreflang fields are requested with the crawl fields
+	if err := downloadURLs(sessionID, organisation, project, botifyToken, urlExtractFile, urlFieldsFile, hreflangFields(crawlFields)); err != nil {
+		return err
+	}
+
+	// Check the platforms used once all URLs are acquired
+	if err := detectFilePlatforms(urlExtractFile); err != nil {
+		logger.Error("processURLs. Cannot read the URLs", "error", err)
+		return fmt.Errorf("cannot read the URLs: %w", err)
+	}
+
+	return nil
+}
+
+// Download the URLs of the latest analysis of a project to urlFileName
+// The values of the crawl fields (if any) are written to fieldsFileName
+// Does not use the session globals, and can be used to download several projects concurrently (see batch.go)
+func downloadURLs(sessionID, organisation, project, token, urlFileName, fieldsFileName string, fields []string) error {
+
+	// Not the session logger, the projects are downloaded concurrently in batch mode
+	logger := logging.Session(sessionID, organisation, project)
 
 	//Get the last analysis slug
-	url := fmt.Sprintf("https://api.botify.com/v1/analyses/%s/%s?page=1&only_success=true", organisation, project)
+	url := fmt.Sprintf("%s/v1/analyses/%s/%s?page=1&only_success=true", botifyAPIBaseURL, organisation, project)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Println(red+"\nError. processURLs Cannot create request:"+reset, err)
-		return "errorProcessURLs"
+		logger.Error("processURLs. Cannot create request", "error", err)
+		return fmt.Errorf("cannot create the API request: %w", err)
 	}
 	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", "token "+envBotifyAPIToken)
+	req.Header.Add("Authorization", "token "+token)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := botifyClient.Do(req)
 	if err != nil {
-		fmt.Println(red+"\nError. processURLs. Check your network connection: "+reset, err)
-		return "errorProcessURLs"
+		logger.Error("processURLs. Check your network connection", "error", err)
+		return fmt.Errorf("%w, check the network connection: %w", errBotifyAPI, err)
 	}
 
 	defer func() {
 		if err := res.Body.Close(); err != nil {
-			fmt.Println(red+"Error. processURLs. Closing (1):"+reset, err)
+			logger.Error("processURLs. Closing (1)", "error", err)
 		}
 	}()
 
 	responseData, err := io.ReadAll(res.Body)
 	if err != nil {
-		log.Fatal(red+"\nError. processURLs. Cannot read response body: "+reset, err)
-		return "errorProcessURLs"
+		logger.Error("processURLs. Cannot read response body", "error", err)
+		return fmt.Errorf("%w, cannot read the response: %w", errBotifyAPI, err)
 	}
 
 	var responseObject botifyResponse
 	err = json.Unmarshal(responseData, &responseObject)
 
 	if err != nil {
-		fmt.Println(red+"\nError. processURLs. Cannot unmarshall JSON: "+reset, err)
-		return "errorProcessURLs"
+		logger.Error("processURLs. Cannot unmarshall JSON", "error", err)
+		return fmt.Errorf("%w, invalid response: %w", errBotifyAPI, err)
 	}
 
 	//Display an error if no crawls found
-	if responseObject.Count == 0 {
-		fmt.Println(red + "\nError. processURLs. Invalid credentials or no crawls found in the project (1)" + reset)
-		return "errorNoProjectFound"
+	if responseObject.Count == 0 || len(responseObject.Results) == 0 {
+		logger.Error("processURLs. Invalid credentials or no crawls found in the project (1)")
+		return errNoProjectFound
 	}
 
-	//Display the welcome message
-	fmt.Println()
-	fmt.Printf(yellow + sessionID + purple + " Generating segmentation regex" + reset)
-	fmt.Printf("\n%s%s%s Organisation: %s, Project: %s\n", yellow, sessionID, reset, organisation, project)
+	logger.Info("Generating segmentation regex")
 
 	//Create a file for writing
-	file, err := os.Create(urlExtractFile)
+	file, err := os.Create(urlFileName)
 	if err != nil {
-		fmt.Println(red+"\nError. processURLs. Cannot create file: "+reset, err)
-		return "errorProcessURLs"
+		logger.Error("processURLs. Cannot create file", "error", err)
+		return fmt.Errorf("cannot create the URL file: %w", err)
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. processURLs. Closing (2):"+reset, err)
+			logger.Error("processURLs. Closing (2)", "error", err)
 		}
 	}()
 
+	//Create a file for the crawl field values if crawl fields are requested
+	var fieldsFile *os.File
+	if len(fields) > 0 {
+		fieldsFile, err = os.Create(fieldsFileName)
+		if err != nil {
+			logger.Error("processURLs. Cannot create the crawl fields file", "error", err)
+			return fmt.Errorf("cannot create the crawl fields file: %w", err)
+		}
+
+		defer func() {
+			if err := fieldsFile.Close(); err != nil {
+				logger.Error("processURLs. Closing crawl fields file", "error", err)
+			}
+		}()
+	}
+
+	//The URL is always requested, the crawl fields are added if specified
+	payloadData, err := json.Marshal(map[string][]string{"fields": append([]string{"url"}, fields...)})
+	if err != nil {
+		logger.Error("processURLs. Cannot create the payload", "error", err)
+		return fmt.Errorf("cannot create the API request: %w", err)
+	}
+
 	//Initialize total count
 	totalCount := 0
-	fmt.Println(yellow+sessionID+reset+" Latest analysis slug:", responseObject.Results[0].Slug)
+	logger.Info("Latest analysis", "slug", responseObject.Results[0].Slug)
 
 	analysisSlug := responseObject.Results[0].Slug
 
@@ -314,34 +656,41 @@ func processURLs(sessionID string) string {
 	//Each page returns 1000 URLs
 	for page := 1; page <= maxURLsToProcess; page++ {
 
-		url := fmt.Sprintf("https://api.botify.com/v1/analyses/%s/%s/%s/urls?area=current&page=%d&size=1000", organisation, project, analysisSlug, page)
+		url := fmt.Sprintf("%s/v1/analyses/%s/%s/%s/urls?area=current&page=%d&size=1000", botifyAPIBaseURL, organisation, project, analysisSlug, page)
 
-		payload := strings.NewReader("{\"fields\":[\"url\"]}")
+		payload := strings.NewReader(string(payloadData))
 
-		req, _ := http.NewRequest("POST", url, payload)
-		//bloo
+		req, err := http.NewRequest("POST", url, payload)
+		if err != nil {
+			logger.Error("processURLs. Cannot create request", "error", err)
+			return fmt.Errorf("cannot create the API request: %w", err)
+		}
 		req.Header.Add("accept", "application/json")
 		req.Header.Add("content-type", "application/json")
-		req.Header.Add("Authorization", "token "+envBotifyAPIToken)
+		req.Header.Add("Authorization", "token "+token)
 
-		res, err := http.DefaultClient.Do(req)
+		res, err := botifyClient.Do(req)
 		if err != nil {
-			fmt.Println(red+"\nError. processURLs. Cannot connect to the API: "+reset, err)
-			return "errorProcessURLs"
+			logger.Error("processURLs. Cannot connect to the API", "error", err)
+			return fmt.Errorf("%w: %w", errBotifyAPI, err)
 		}
 
 		//Decode JSON response
 		var response map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-			fmt.Println(red+"\nError. processURLs. Cannot decode JSON: "+reset, err)
-			return "errorProcessURLs"
+		err = json.NewDecoder(res.Body).Decode(&response)
+		if err := res.Body.Close(); err != nil {
+			logger.Error("processURLs. Closing (4)", "error", err)
+		}
+		if err != nil {
+			logger.Error("processURLs. Cannot decode JSON", "error", err)
+			return fmt.Errorf("%w, invalid response: %w", errBotifyAPI, err)
 		}
 
 		//Extract URLs from the "results" key
 		results, ok := response["results"].([]interface{})
 		if !ok {
-			fmt.Println(red + "\nError. processURLs. Invalid credentials or no crawls found in the project (2)" + reset)
-			return "errorNoProjectFound"
+			logger.Error("processURLs. Invalid credentials or no crawls found in the project (2)")
+			return errNoProjectFound
 		}
 
 		//Write URLs to the file
@@ -349,17 +698,15 @@ func processURLs(sessionID string) string {
 		for _, result := range results {
 			if resultMap, ok := result.(map[string]interface{}); ok {
 				if url, ok := resultMap["url"].(string); ok {
-					// Check if SFCC is used. This bool us used to determine if the SFCC regex is generated
-					if strings.Contains(url, "/demandware/") {
-						sfccDetected = true
-					}
-					// Check if Shopify is used. This bool us used to determine if the Shopify regex is generated
-					if strings.Contains(url, "/collections/") && strings.Contains(url, "/products/") {
-						shopifyDetected = true
-					}
 					if _, err := file.WriteString(url + "\n"); err != nil {
-						fmt.Println(red+"\nError. processURLs. Cannot write to file: "+reset, err)
-						return "errorProcessURLs"
+						logger.Error("processURLs. Cannot write to file", "error", err)
+						return fmt.Errorf("cannot write the URLs: %w", err)
+					}
+					if fieldsFile != nil {
+						if err := writeURLFields(fieldsFile, url, resultMap, fields); err != nil {
+							logger.Error("processURLs. Cannot write the crawl field values", "error", err)
+							return fmt.Errorf("cannot write the crawl field values: %w", err)
+						}
 					}
 					count++
 					totalCount++
@@ -377,48 +724,133 @@ func processURLs(sessionID string) string {
 			break
 		}
 
-		fmt.Printf("%s%s%s Page %d: %d URLs processed\n", yellow, sessionID, reset, page, count)
+		logger.Debug("URLs processed", "page", page, "count", count)
+	}
+
+	return nil
+}
+
+// Write the URLs uploaded by the user to the temp file. One URL per line
+func processUploadedURLs(uploadedURLs io.Reader) error {
+
+	file, err := os.Create(urlExtractFile)
+	if err != nil {
+		logger.Error("processUploadedURLs. Cannot create file", "error", err)
+		return fmt.Errorf("cannot create the URL file: %w", err)
 	}
 
 	defer func() {
-		if err := res.Body.Close(); err != nil {
-			fmt.Println(red+"Error. processURLs. Closing (3):"+reset, err)
+		if err := file.Close(); err != nil {
+			logger.Error("processUploadedURLs. Closing", "error", err)
 		}
 	}()
 
-	return "success"
+	totalCount := 0
+	scanner := bufio.NewScanner(uploadedURLs)
+	for scanner.Scan() {
+		url := strings.TrimSpace(scanner.Text())
+		if url == "" {
+			continue
+		}
+
+		detectPlatforms(url)
+
+		if _, err := file.WriteString(url + "\n"); err != nil {
+			logger.Error("processUploadedURLs. Cannot write to file", "error", err)
+			return fmt.Errorf("cannot write the URLs: %w", err)
+		}
+
+		//Max. number of URLs has been reached
+		totalCount++
+		if totalCount > maxURLsToProcess {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error("processUploadedURLs. Cannot read the uploaded URLs", "error", err)
+		return fmt.Errorf("cannot read the uploaded URLs: %w", err)
+	}
+
+	if totalCount == 0 {
+		return errNoURLs
+	}
+
+	return nil
+}
+
+// Check the platforms used in a file containing one URL per line
+func detectFilePlatforms(fileName string) error {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Error("detectFilePlatforms. Closing", "error", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		detectPlatforms(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+// Check if a URL signals the use of a platform for which a dedicated segment is generated
+func detectPlatforms(url string) {
+	// Check if SFCC is used. This bool us used to determine if the SFCC regex is generated
+	if strings.Contains(url, "/demandware/") {
+		sfccDetected = true
+	}
+	// Check if Shopify is used. This bool us used to determine if the Shopify regex is generated
+	if strings.Contains(url, "/collections/") && strings.Contains(url, "/products/") {
+		shopifyDetected = true
+	}
 }
 
 // Generate regex for level 1 and 2 folders
-func level1and2Folders() {
+func level1and2Folders() error {
 
 	//Level1 folders
 	//Get the threshold. Use the level 1 slashCount
-	_, thresholdValueL1 := levelThreshold(urlExtractFile, slashCountLevel1)
+	_, thresholdValueL1, err := levelThreshold(urlExtractFile, slashCountLevel1)
+	if err != nil {
+		return err
+	}
 
 	//Generate the regex
-	segmentFolders(thresholdValueL1, slashCountLevel1, "Level 1 Folders")
+	if err := segmentFolders(thresholdValueL1, slashCountLevel1, "Level 1 Folders"); err != nil {
+		return err
+	}
 
 	//Level2 folders
 	//Get the threshold. Use the level 2 slashCount
-	_, thresholdValueL2 := levelThreshold(urlExtractFile, slashCountLevel2)
+	_, thresholdValueL2, err := levelThreshold(urlExtractFile, slashCountLevel2)
+	if err != nil {
+		return err
+	}
 
 	//Level2 folders
-	segmentFolders(thresholdValueL2, slashCountLevel2, "Level 2 Folders")
+	return segmentFolders(thresholdValueL2, slashCountLevel2, "Level 2 Folders")
 }
 
-func generateRegexFile() {
+func generateRegexFile() error {
 
 	//Always create the file.
 	outputFile, err := os.Create(regexOutputFile)
 	if err != nil {
-		fmt.Printf(red+"\nError. generateRegexFile. Cannot create output file: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("generateRegexFile. Cannot create output file", "error", err)
+		return err
 	}
 
 	defer func() {
 		if err := outputFile.Close(); err != nil {
-			fmt.Println(red+"Error. generateRegexFile. Closing (4):"+reset, err)
+			logger.Error("generateRegexFile. Closing (4)", "error", err)
 		}
 	}()
 
@@ -428,8 +860,8 @@ func generateRegexFile() {
 	// Get the user's local time zone for the header
 	userLocation, err := time.LoadLocation("") // Load the default local time zone
 	if err != nil {
-		fmt.Println("\nError loading user's location:", err)
-		return
+		logger.Error("generateRegexFile. Cannot load the local time zone", "error", err)
+		return err
 	}
 	// Get the current date and time in the user's local time zone
 	currentTime := time.Now().In(userLocation)
@@ -437,44 +869,43 @@ func generateRegexFile() {
 	_, err = writer.WriteString(fmt.Sprintf("# Regex made with love using segmentifyLite %s\n", version))
 
 	if err != nil {
-		fmt.Printf(red+"\nError. generateRegexFile. Cannot write header to output file: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("generateRegexFile. Cannot write header to output file", "error", err)
+		return err
 	}
 
 	_, err = writer.WriteString(fmt.Sprintf("# Organisation name: %s\n", organisation))
 	if err != nil {
-		errMsg := fmt.Errorf(red+"Error. Cannot write organisation name in Regex file: %w"+reset, err)
-		println(errMsg)
+		logger.Error("Cannot write organisation name in Regex file", "error", err)
 	}
 	_, err = writer.WriteString(fmt.Sprintf("# Project name: %s\n", project))
 	if err != nil {
-		errMsg := fmt.Errorf(red+"Error. Cannot write project name in Regex file: %w"+reset, err)
-		println(errMsg)
+		logger.Error("Cannot write project name in Regex file", "error", err)
 	}
 	_, err = writer.WriteString(fmt.Sprintf("# Generated %s", currentTime.Format(time.RFC1123)))
 	if err != nil {
-		errMsg := fmt.Errorf(red+"Error. Cannot write generate date/time name in Regex file: %w"+reset, err)
-		println(errMsg)
+		logger.Error("Cannot write generate date/time name in Regex file", "error", err)
 	}
 
 	//Flush the writer to ensure all data is written to the file
 	err = writer.Flush()
 	if err != nil {
-		fmt.Printf(red+"\nError. generateRegexFile. Cannot flush writer: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("generateRegexFile. Cannot flush writer", "error", err)
+		return err
 	}
+
+	return nil
 }
 
-func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
+func segmentFolders(thresholdValue int, slashCount int, folderLevel string) error {
 
 	//Open the input file for reading
 	file, err := os.Open(urlExtractFile)
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. segmentFolders. Closing (5):"+reset, err)
+			logger.Error("segmentFolders. Closing (5)", "error", err)
 		}
 	}()
 
@@ -509,6 +940,12 @@ func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
 		//	continue
 		//}
 
+		//Build artefacts are segmented in sl_build_artefacts, fragment routes in sl_spa_routes
+		if _, found := buildArtefactIndex(line); found {
+			continue
+		}
+		line = withoutFragment(line)
+
 		// Is this a product URL?
 		isProductURL = isValidisProductURL(line)
 		if isProductURL {
@@ -534,7 +971,17 @@ func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
 		}
 	}
 
-	fmt.Printf("\n")
+	//Keep all folders for the folder size chart
+	var allFolders []FolderCount
+	for folderName, count := range FolderCounts {
+		allFolders = append(allFolders, FolderCount{folderName, count})
+	}
+	sort.Sort(ByCount(allFolders))
+	if slashCount == slashCountLevel1 {
+		chartFoldersLevel1 = allFolders
+	} else {
+		chartFoldersLevel2 = allFolders
+	}
 
 	//Create a slice to hold FolderCount structs
 	var sortedCounts []FolderCount
@@ -559,12 +1006,12 @@ func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
 	//Open the file in append mode, create if it doesn't exist
 	outputFile, err := os.OpenFile(regexOutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	defer func() {
 		if err := outputFile.Close(); err != nil {
-			fmt.Println(red+"Error. segmentFolders. Closing (6):"+reset, err)
+			logger.Error("segmentFolders. Closing (6)", "error", err)
 		}
 	}()
 
@@ -578,30 +1025,26 @@ func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
 	// Level 1
 	if slashCount == 4 {
 		if _, err := writer.WriteString(fmt.Sprintf("\n\n[segment:sl_level1_folders]\n@Home\npath /\n\n")); err != nil {
-			fmt.Printf(red+"Error. segmentFolders. Cannot write segment to writer. Level 1 folders: %v\n"+reset, err)
+			logger.Error("segmentFolders. Cannot write segment to writer. Level 1 folders", "error", err)
 		}
 	}
 
 	// Level 2
 	if slashCount == 5 {
 		if _, err := writer.WriteString(fmt.Sprintf("\n\n[segment:sl_level2_folders]\n@Home\npath /\n\n")); err != nil {
-			fmt.Printf(red+"Error. segmentFolders. Cannot write segment to writer. Level 2 folders: %v\n"+reset, err)
+			logger.Error("segmentFolders. Cannot write segment to writer. Level 2 folders", "error", err)
 		}
 	}
 
+	//Apply the label rules. Folders sharing the same label are merged into a single label
+	folderLabels, excludedFolders := groupFolderLabels(sortedCounts)
+
 	//Write the regex
-	for _, folderValueCount := range sortedCounts {
-		if folderValueCount.Text != "" {
-			//Extract the text between the third and fourth forward-slashes
-			parts := strings.SplitN(folderValueCount.Text, "/", 4)
-			if len(parts) >= 4 && parts[3] != "" {
-				folderLabel := parts[3] //Extract the text between the third and fourth forward-slashes
-				_, err := writer.WriteString(fmt.Sprintf("@%s\nurl *%s/*\n\n", folderLabel, folderValueCount.Text))
-				if err != nil {
-					fmt.Printf(red+"\nError. segmentFolders. Cannot write to output file: %v\n"+reset, err)
-					os.Exit(1)
-				}
-			}
+	for _, label := range folderLabels {
+		_, err := writer.WriteString(folderLabelRegex(label))
+		if err != nil {
+			logger.Error("segmentFolders. Cannot write to output file", "error", err)
+			return err
 		}
 	}
 
@@ -610,41 +1053,51 @@ func segmentFolders(thresholdValue int, slashCount int, folderLevel string) {
 	formattedString := fmt.Sprintf("@~Other\npath /*\n# ----End of %s Segment----\n", folderLevel)
 	_, err = writer.WriteString(formattedString)
 	if err != nil {
-		fmt.Printf(red+"Error. segmentFolders. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("segmentFolders. Cannot write segment to writer", "error", err)
 	}
 
 	//Insert the number of URLs found in each folder as comments
 	_, err = writer.WriteString("\n# ----Folder URL analysis----\n")
 	if err != nil {
-		fmt.Printf(red+"Error. segmentFolders. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("segmentFolders. Cannot write segment to writer", "error", err)
 	}
-	for _, folderValueCount := range sortedCounts {
-		_, err := writer.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", folderValueCount.Text, folderValueCount.Count))
+	for _, label := range folderLabels {
+		for _, folderValueCount := range label.Folders {
+			_, err := writer.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", folderValueCount.Text, folderValueCount.Count))
+			if err != nil {
+				logger.Error("segmentFolders. Cannot write segment to writer", "error", err)
+			}
+		}
+	}
+	for _, folderValueCount := range excludedFolders {
+		_, err := writer.WriteString(fmt.Sprintf("# --%s (URLs found: %d) excluded by label rule\n", folderValueCount.Text, folderValueCount.Count))
 		if err != nil {
-			fmt.Printf(red+"Error. segmentFolders. Cannot write segment to writer: %v\n"+reset, err)
+			logger.Error("segmentFolders. Cannot write segment to writer", "error", err)
 		}
 	}
 
 	//Flush the writer to ensure all data is written to the file
 	err = writer.Flush()
 	if err != nil {
-		fmt.Printf(red+"\nError. segmentFolders. Cannot flush writer: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("segmentFolders. Cannot flush writer", "error", err)
+		return err
 	}
+
+	return nil
 }
 
 // Regex for subdomains
-func subDomains() {
+func subDomains() error {
 
 	//Open the input file
 	file, err := os.Open(urlExtractFile)
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. subDomains. Closing (7):"+reset, err)
+			logger.Error("subDomains. Closing (7)", "error", err)
 		}
 	}()
 
@@ -670,8 +1123,8 @@ func subDomains() {
 			continue
 		}
 
-		//Split the line into substrings using a forward-slash as delimiter
-		parts := strings.Split(line, "/")
+		//Split the line into substrings using a forward-slash as delimiter. Fragment routes are segmented in sl_spa_routes
+		parts := strings.Split(withoutFragment(line), "/")
 		//Check if there are at least 4 parts in the line
 		if len(parts) >= 4 {
 			//Extract the text between the third and fourth forward-slashes
@@ -698,16 +1151,17 @@ func subDomains() {
 
 	//Sort the slice based on counts
 	sort.Sort(ByCount(sortedCounts))
+	chartSubDomains = sortedCounts
 
 	//Open the file in append mode, create if it doesn't exist
 	outputFile, err := os.OpenFile(regexOutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	defer func() {
 		if err := outputFile.Close(); err != nil {
-			fmt.Println(red+"Error. subDomains. Closing (8):"+reset, err)
+			logger.Error("subDomains. Closing (8)", "error", err)
 		}
 	}()
 
@@ -717,7 +1171,7 @@ func subDomains() {
 	//Write the header lines
 	_, err = writer.WriteString(fmt.Sprintf("\n\n[segment:sl_subdomains]\n@Home\npath /\n\n"))
 	if err != nil {
-		fmt.Printf(red+"Error. subDomains. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("subDomains. Cannot write segment to writer", "error", err)
 	}
 
 	//Write the regex
@@ -727,9 +1181,9 @@ func subDomains() {
 			parts := strings.SplitN(folderValueCount.Text, "/", 4)
 			if len(parts) >= 3 && parts[2] != "" {
 				folderLabel := parts[2] //Extract the text between the third and fourth forward-slashes
-				_, err := writer.WriteString(fmt.Sprintf("@%s\nurl *%s/*\n\n", folderLabel, folderValueCount.Text))
+				_, err := writer.WriteString(fmt.Sprintf("@%s\nurl *%s/*\n\n", sanitiseLabel(folderLabel), folderValueCount.Text))
 				if err != nil {
-					fmt.Printf(red+"Error. subDomains. Cannot write segment to writer: %v\n"+reset, err)
+					logger.Error("subDomains. Cannot write segment to writer", "error", err)
 					// Handle or return the error as needed
 				}
 			}
@@ -739,42 +1193,44 @@ func subDomains() {
 	//Write the footer lines
 	_, err = writer.WriteString("@~Other\npath /*\n# ----End of subDomains Segment----\n")
 	if err != nil {
-		fmt.Printf(red+"Error. subDomains. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("subDomains. Cannot write segment to writer", "error", err)
 	}
 
 	//Insert the number of URLs found in each folder as comments
 	_, err = writer.WriteString("\n# ----subDomains Folder URL analysis----\n")
 	if err != nil {
-		fmt.Printf(red+"Error. subDomains. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("subDomains. Cannot write segment to writer", "error", err)
 	}
 	for _, folderValueCount := range sortedCounts {
 		_, err := writer.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", folderValueCount.Text, folderValueCount.Count))
 		if err != nil {
-			fmt.Printf(red+"\nError. subDomains. Cannot write to output file: %v\n"+reset, err)
-			os.Exit(1)
+			logger.Error("subDomains. Cannot write to output file", "error", err)
+			return err
 		}
 	}
 
 	//Flush the writer to ensure all data is written to the file
 	err = writer.Flush()
 	if err != nil {
-		fmt.Printf(red+"\nError. subDomains. Cannot flush writer: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("subDomains. Cannot flush writer", "error", err)
+		return err
 	}
+
+	return nil
 }
 
 // Regex to identify which parameter keys are used
-func parameterKeys() {
+func parameterKeys() error {
 
 	//Open the input file
 	file, err := os.Open(urlExtractFile)
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. parameterKeys. Closing (9):"+reset, err)
+			logger.Error("parameterKeys. Closing (9)", "error", err)
 		}
 	}()
 
@@ -823,8 +1279,6 @@ func parameterKeys() {
 	//Subtract 2 in order to account for the two header records which are defaults in Botify URL extracts
 	totalRecords -= 2
 
-	fmt.Printf("\n")
-
 	//Create a slice to hold FolderCount structs
 	var sortedCounts []FolderCount
 
@@ -835,16 +1289,17 @@ func parameterKeys() {
 
 	//Sort the slice based on counts
 	sort.Sort(ByCount(sortedCounts))
+	chartParameterKeys = sortedCounts
 
 	//Open the file in append mode, create if it doesn't exist
 	outputFile, err := os.OpenFile(regexOutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	defer func() {
 		if err := outputFile.Close(); err != nil {
-			fmt.Println(red+"Error. parameterKeys. Closing (10):"+reset, err)
+			logger.Error("parameterKeys. Closing (10)", "error", err)
 		}
 	}()
 
@@ -854,49 +1309,51 @@ func parameterKeys() {
 	//Write the header lines
 	_, err = writer.WriteString(fmt.Sprintf("\n\n[segment:sl_parameter_keys]\n"))
 	if err != nil {
-		fmt.Printf(red+"Error. parameterKeys. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("parameterKeys. Cannot write segment to writer", "error", err)
 	}
 
 	//Write the regex
 	for _, folderValueCount := range sortedCounts {
-		_, err := writer.WriteString(fmt.Sprintf("@%s\nquery *%s=*\n\n", folderValueCount.Text, folderValueCount.Text))
+		_, err := writer.WriteString(fmt.Sprintf("@%s\nquery *%s=*\n\n", sanitiseLabel(folderValueCount.Text), folderValueCount.Text))
 		if err != nil {
-			fmt.Printf(red+"\nError. parameterKeys. Cannot write to output file: %v\n"+reset, err)
-			os.Exit(1)
+			logger.Error("parameterKeys. Cannot write to output file", "error", err)
+			return err
 		}
 	}
 
 	//Write the footer lines
 	_, err = writer.WriteString("@~Other\npath /*\n# ----End of parameterKeys Segment----\n")
 	if err != nil {
-		fmt.Printf(red+"Error. parameterKeys. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("parameterKeys. Cannot write segment to writer", "error", err)
 		// Handle or return the error as needed
 	}
 
 	//Insert the number of URLs found in each folder as comments
 	_, err = writer.WriteString("\n# ----parameterKeys URL analysis----\n")
 	if err != nil {
-		fmt.Printf(red+"Error. parameterKeys. Cannot write segment to writer: %v\n"+reset, err)
+		logger.Error("parameterKeys. Cannot write segment to writer", "error", err)
 		// Handle or return the error as needed
 	}
 	for _, folderValueCount := range sortedCounts {
 		_, err := writer.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", folderValueCount.Text, folderValueCount.Count))
 		if err != nil {
-			fmt.Printf(red+"\nError. parameterKeys. Cannot write to output file: %v\n"+reset, err)
-			os.Exit(1)
+			logger.Error("parameterKeys. Cannot write to output file", "error", err)
+			return err
 		}
 	}
 
 	//Flush the writer to ensure all data is written to the file
 	err = writer.Flush()
 	if err != nil {
-		fmt.Printf(red+"\nError. parameterKeys. Cannot flush writer: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("parameterKeys. Cannot flush writer", "error", err)
+		return err
 	}
+
+	return nil
 }
 
 // Regex to identify of a parameter key is used in the URL
-func parameterUsage() {
+func parameterUsage() error {
 
 	//URLs containing parameters
 	parameterUsageRegex := `
@@ -913,13 +1370,14 @@ path /*
 
 	errParameterUsage := insertStaticRegex(parameterUsageRegex)
 	if errParameterUsage != nil {
-		panic(errParameterUsage)
+		return errParameterUsage
 	}
 
+	return nil
 }
 
 // Regex to count the number of parameters in the URL
-func noOfParameters() {
+func noOfParameters() error {
 
 	//Number of parameters
 	parameterNoRegex := `
@@ -952,13 +1410,14 @@ path /*
 
 	errParameterNoRegex := insertStaticRegex(parameterNoRegex)
 	if errParameterNoRegex != nil {
-		panic(errParameterNoRegex)
+		return errParameterNoRegex
 	}
 
+	return nil
 }
 
 // Regex to count the number of folders in the URL
-func noOfFolders() {
+func noOfFolders() error {
 
 	//Number of folders
 	folderNoRegex := `
@@ -990,13 +1449,14 @@ path /*
 	//No. of folders message
 	errFolderNoRegex := insertStaticRegex(folderNoRegex)
 	if errFolderNoRegex != nil {
-		panic(errFolderNoRegex)
+		return errFolderNoRegex
 	}
 
+	return nil
 }
 
 // SFCC Regex
-func sfccURLs() {
+func sfccURLs() error {
 
 	//SFCC
 	sfccURLs := `
@@ -1016,16 +1476,17 @@ path /*
 `
 
 	// SFCC message
-	fmt.Println(purple + "Salesforce Commerce Cloud (Demandware)" + reset)
+	logger.Info("Platform detected", "platform", "Salesforce Commerce Cloud (Demandware)")
 	errSfccURLs := insertStaticRegex(sfccURLs)
 	if errSfccURLs != nil {
-		panic(errSfccURLs)
+		return errSfccURLs
 	}
 
+	return nil
 }
 
 // Shopify Regex
-func shopifyURLs() {
+func shopifyURLs() error {
 
 	// Shopify
 	shopifyURLs := `
@@ -1052,16 +1513,17 @@ path /*
 `
 
 	// Shopify message
-	fmt.Println(purple + "Shopify" + reset)
+	logger.Info("Platform detected", "platform", "Shopify")
 	errShopify := insertStaticRegex(shopifyURLs)
 	if errShopify != nil {
-		panic(errShopify)
+		return errShopify
 	}
 
+	return nil
 }
 
 // Static resources
-func staticResources() {
+func staticResources() error {
 
 	// Static resources
 	staticResources := `
@@ -1122,43 +1584,46 @@ path /*
 
 	errStaticResources := insertStaticRegex(staticResources)
 	if errStaticResources != nil {
-		panic(errStaticResources)
+		return errStaticResources
 	}
 
+	return nil
 }
 
 // PDP Regex
-func insertPDPRegex() {
+func insertPDPRegex() error {
 
-	generatePDPRegex := `
+	pdpSegment := `
 [segment:sl_PDP]  
 @pdp
-path rx:[a-zA-Z0-9\-]+-\d+\.html$
+path rx:` + pdpRegex + `
 
 @Other
 path /*
 
 # ----End of sl_PDP segment----
-`
-	errStaticResources := insertStaticRegex(generatePDPRegex)
+` + pdpAnalysis
+	errStaticResources := insertStaticRegex(pdpSegment)
 	if errStaticResources != nil {
-		panic(errStaticResources)
+		return errStaticResources
 	}
+
+	return nil
 }
 
 // Get the folder size threshold for level 1 & 2 folders
-func levelThreshold(inputFilename string, slashCount int) (largestValueSize, fivePercentValue int) {
+func levelThreshold(inputFilename string, slashCount int) (largestValueSize, fivePercentValue int, err error) {
 
 	// Open the input file
 	file, err := os.Open(inputFilename)
 	if err != nil {
-		fmt.Printf(red+"\nError. levelThreshhold. Cannot open input file: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("levelThreshhold. Cannot open input file", "error", err)
+		return 0, 0, err
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. levelThreshold. Closing (11):"+reset, err)
+			logger.Error("levelThreshold. Closing (11)", "error", err)
 		}
 	}()
 
@@ -1185,8 +1650,13 @@ func levelThreshold(inputFilename string, slashCount int) (largestValueSize, fiv
 			continue
 		}
 
+		// Build artefacts & fragment routes are not included in the folder segments
+		if _, found := buildArtefactIndex(line); found {
+			continue
+		}
+
 		// Split the line into substrings using a forward-slash as delimiter
-		parts := strings.Split(line, "/")
+		parts := strings.Split(withoutFragment(line), "/")
 
 		// Check if there are at least slashCount parts in the URL
 		// See slashCount variable declaration comments for more information
@@ -1226,27 +1696,23 @@ func levelThreshold(inputFilename string, slashCount int) (largestValueSize, fiv
 	// Calculate 5% of the largest value
 	fivePercentValue = int(float64(largestValueSize) * thresholdPercent)
 
-	return largestValueSize, fivePercentValue
+	return largestValueSize, fivePercentValue, scanner.Err()
 }
 
 // Display the results and finishUp
 func finishUp(sessionID string) {
 
 	// We're done
-	fmt.Println(lineSeparator)
-
-	now := time.Now()
-	formattedTime := now.Format("15:04 02/01/2006")
-	fmt.Println("\nSession ID: " + sessionID)
-	fmt.Println("\nsegmentifyLite: Done at " + formattedTime)
-	fmt.Printf("\n%s%s%s Organisation: %s, Project: %s\n", yellow, sessionID, reset, organisation, project)
+	logger.Info("segmentifyLite: Done")
 
-	// Make a tidy display
-	fmt.Println()
-	fmt.Println(lineSeparator)
+	// Keep the URL sample in the cache folder, it is used by the segment editor to compute the coverage
+	if err := moveFile(urlExtractFile, cacheFolder+"/"+urlSampleFile); err != nil {
+		logger.Error("finishUp. Cannot save the URL sample", "error", err)
+	}
 
-	// Delete the temp. file
+	// Delete the temp. files
 	_ = os.Remove(urlExtractFile)
+	_ = os.Remove(urlFieldsFile)
 }
 
 // Write the static Regex to the segments file
@@ -1255,12 +1721,13 @@ func insertStaticRegex(regexText string) error {
 	//Open the file in append mode, create if it doesn't exist
 	outputFile, err := os.OpenFile(regexOutputFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		logger.Error("insertStaticRegex. Cannot open outputfile", "error", err)
+		return err
 	}
 
 	defer func() {
 		if err := outputFile.Close(); err != nil {
-			fmt.Println(red+"Error. insertStaticRegex. Closing (12):"+reset, err)
+			logger.Error("insertStaticRegex. Closing (12)", "error", err)
 		}
 	}()
 
@@ -1269,22 +1736,25 @@ func insertStaticRegex(regexText string) error {
 
 	_, err = writer.WriteString(regexText)
 	if err != nil {
-		fmt.Printf(red+"\nError. insertStaticRegex. Cannot write to outputfile: %v\n"+reset, err)
-		panic(err)
+		logger.Error("insertStaticRegex. Cannot write to outputfile", "error", err)
+		return err
 	}
 
 	//Flush the writer to ensure all data is written to the file
 	err = writer.Flush()
 	if err != nil {
-		fmt.Printf(red+"\nError. insertStaticRegex. Cannot flush writer: %v\n"+reset, err)
-		os.Exit(1)
+		logger.Error("insertStaticRegex. Cannot flush writer", "error", err)
+		return err
 	}
 
-	return err
+	return nil
 }
 
 func writeLog(sessionID, organisation, project, statusDescription string) {
 
+	// The status is also logged. The CSV log file is kept for the existing reports
+	logging.Session(sessionID, organisation, project).Info(statusDescription)
+
 	// Define log file name
 	fileName := envSegmentifyLiteLogFolder + "/_segmentifyLite.log"
 
@@ -1297,12 +1767,13 @@ func writeLog(sessionID, organisation, project, statusDescription string) {
 	// Open or create the log file
 	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Fatalf(red+"Error. writeLog. Cannot oprn log file: %s"+reset, err)
+		slog.Error("writeLog. Cannot open log file", "error", err)
+		return
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. writeLog. Closing (13):"+reset, err)
+			slog.Error("writeLog. Closing (13)", "error", err)
 		}
 	}()
 
@@ -1317,13 +1788,13 @@ func writeLog(sessionID, organisation, project, statusDescription string) {
 	if !fileExists {
 		header := "SessionID,Date,Organisation,Project,Status\n"
 		if _, err := file.WriteString(header); err != nil {
-			log.Fatalf(red+"Error. writeLog. Failed to write log header: %s"+reset, err)
+			slog.Error("writeLog. Failed to write log header", "error", err)
 		}
 	}
 
 	// Write log record to file
 	if _, err := file.WriteString(logRecord); err != nil {
-		log.Fatalf(red+"Error. writeLog. Cannot write to log file: %s"+reset, err)
+		slog.Error("writeLog. Cannot write to log file", "error", err)
 	}
 }
 
@@ -1335,19 +1806,19 @@ func generateSessionID(length int) (string, error) {
 	}
 
 	// Add to the execution increment
-	sessionIDCounter++
+	counter := sessionIDCounter.Add(1)
 
 	var builder strings.Builder
-	builder.WriteString(strconv.Itoa(sessionIDCounter))
+	builder.WriteString(strconv.FormatInt(counter, 10))
 	builder.WriteString("-")
-	builder.WriteString(base64.URLEncoding.EncodeToString(sessionID))
+	builder.WriteString(base64.RawURLEncoding.EncodeToString(sessionID))
 
 	// Convert the builder to a string and return
 	return builder.String(), nil
 }
 
 // Generate the HTML pages used to present the segmentation regex
-func generateSegmentationRegex(sessionID string) {
+func generateSegmentationRegex(sessionID string) error {
 
 	// Using these two variables to replace width values in the HTML below because string interpolation confuses the percent signs as variables
 	width50 := "50%"
@@ -1366,9 +1837,10 @@ func generateSegmentationRegex(sessionID string) {
             font-family: Arial, sans-serif;
             background-color: Cornsilk;
             display: flex;
+            flex-wrap: wrap;
             justify-content: center;
             align-items: center;
-            height: 100vh;
+            min-height: 100vh;
         }
         .banner {
             background-color: DeepSkyBlue;
@@ -1437,6 +1909,17 @@ func generateSegmentationRegex(sessionID string) {
         .darkgrey {
             color: #00796b;
         }
+        .charts {
+            flex-basis: %s;
+            text-align: center;
+            padding-bottom: 100px;
+        }
+        .charts iframe {
+            width: 90vw;
+            height: 75vh;
+            margin-bottom: 20px;
+            border: none;
+        }
     </style>
 </head>
 <body>
@@ -1459,7 +1942,7 @@ func generateSegmentationRegex(sessionID string) {
     }
 async function copyFileToClipboard() {
         try {
-            const response = await fetch('../../segment.txt');
+            const response = await fetch('`+segmentFileName+`');
             if (!response.ok) {
                 throw new Error('Network response was not ok ' + response.statusText);
             }
@@ -1482,7 +1965,7 @@ async function copyFileToClipboard() {
 
 </body>
 </html>
-`, width100, width50, width100, protocol, fullHost)
+`, width100, width50, width100, width100, protocol, fullHost)
 
 	// Generate the URL to link to the segment editor in the project
 	projectURL := "https://app.botify.com/" + organisation + "/" + project + "/segmentation"
@@ -1491,27 +1974,51 @@ async function copyFileToClipboard() {
 	htmlContent += fmt.Sprintf("<h2 style='color: deepskyblue;'>Segmentation regex generation is complete</h2>\n")
 	htmlContent += fmt.Sprintf("<h3 style='color: dimgray; padding-left: 20px; padding-right: 20px;'>The regex has been copied to the clipboard ready for pasting directly into your Botify project.</h3>\n")
 	htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='%s' target='_blank'>Click here to open the segment editor for %s</a></h4>\n", projectURL, project)
+	htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='go_seo_segmentEditor.html' target='_blank'>Open the segment editor to toggle, rename, reorder or merge labels</a></h4>\n")
+	htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'>Export: <a href='%s' target='_blank'>BigQuery</a> | <a href='%s' target='_blank'>Looker Studio</a> | <a href='%s' target='_blank'>GA4 content groups</a> | <a href='%s' target='_blank'>JSON</a> | <a href='%s' target='_blank'>YAML</a></h4>\n",
+		exportBigQueryFile, exportLookerStudioFile, exportGA4File, exportJSONFile, exportYAMLFile)
+	htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='%s' target='_blank'>Crawl control. Proposed robots.txt rules & canonicalisation candidates</a></h4>\n", crawlControlFile)
+	if existingRobots != nil {
+		htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='%s' target='_blank'>robots.txt. URLs allowed & disallowed for %s</a></h4>\n", robotsReportFile, html.EscapeString(robotsUserAgent))
+	}
+	if _, err := os.Stat(cacheFolder + "/" + sitemapCoverageFile); err == nil {
+		htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='%s' target='_blank'>Sitemap coverage. Crawled URLs in & missing from the sitemaps for each segment</a></h4>\n", sitemapCoverageFile)
+	}
+	if link := shareLink(sessionID, "go_seo_segmentifyLite.html"); link != "" {
+		htmlContent += fmt.Sprintf("<h4 style='color: dimgray;'><a href='%s' target='_blank'>Share link</a>. Anyone holding the link can view these results</h4>\n", link)
+	}
 	htmlContent += fmt.Sprintf("</div>\n")
 
+	// Folder, parameter key & subdomain charts
+	htmlContent += generateCharts()
+
 	// Save the HTML to a file
-	saveHTML(htmlContent, "/go_seo_segmentifyLite.html")
+	if err := saveHTML(htmlContent, "/go_seo_segmentifyLite.html"); err != nil {
+		return err
+	}
 
 	// Generate the HTML containing the segmentation regex
-	generateSegmentHTML()
+	if err := generateSegmentHTML(); err != nil {
+		return err
+	}
 
 	// Copy the regex to the clipboard
 	// Not used, unable to do this when segmentifyLite is hosted by Botify.
 	//copyRegexToClipboard()
+
+	// Generate the segment editor
+	return generateSegmentEditor(sessionID)
 }
 
 // Copy Regex to the clipboard
-func generateSegmentHTML() {
+func generateSegmentHTML() error {
 
 	// Read the contents of segment.txt
-	content, err := os.ReadFile("segment.txt")
+	content, err := os.ReadFile(regexOutputFile)
 
 	if err != nil {
-		log.Fatalf(red+"Error. generateSegmentationRegex. Failed to read segment.txt: %v"+reset, err)
+		logger.Error("generateSegmentationRegex. Failed to read the segment file", "error", err)
+		return err
 	}
 
 	// HTML template with the content
@@ -1531,12 +2038,13 @@ func generateSegmentHTML() {
 	// Create the HTML file
 	file, err := os.Create(cacheFolder + "/go_seo_segmentationRegex.html")
 	if err != nil {
-		log.Fatalf(red+"Error. generateSegmentHTML. Failed to create HTML file: %v"+reset, err)
+		logger.Error("generateSegmentHTML. Failed to create HTML file", "error", err)
+		return err
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. generateSegmentHTML. Closing (14):"+reset, err)
+			logger.Error("generateSegmentHTML. Closing (14)", "error", err)
 		}
 	}()
 
@@ -1545,8 +2053,11 @@ func generateSegmentHTML() {
 		fmt.Sprintf(htmlContent, content),
 	)
 	if err != nil {
-		log.Fatalf("Failed to write to HTML file: %v", err)
+		logger.Error("generateSegmentHTML. Failed to write to HTML file", "error", err)
+		return err
 	}
+
+	return nil
 }
 
 // Define the error page
@@ -1642,30 +2153,51 @@ func generateErrorPage(displayMessage string) {
 }
 
 // Function used to generate and save the HTML content to a file
-func saveHTML(genHTML string, genFilename string) {
+func saveHTML(genHTML string, genFilename string) error {
 
 	file, err := os.Create(cacheFolder + genFilename)
 	if err != nil {
-		fmt.Printf(red+"Error. saveHTML. Can create %s: "+reset+"%s\n", genFilename, err)
-		return
+		logger.Error("saveHTML. Cannot create the file", "file", genFilename, "error", err)
+		return err
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. saveHTML. Closing (15):"+reset, err)
+			logger.Error("saveHTML. Closing (15)", "error", err)
 			return
 		}
 	}()
 
 	_, err = file.WriteString(genHTML)
 	if err != nil {
-		fmt.Printf(red+"Error. saveHTML. Can write %s: "+reset+"%s\n", genFilename, err)
-		return
+		logger.Error("saveHTML. Cannot write the file", "file", genFilename, "error", err)
+		return err
 	}
+
+	return nil
+}
+
+// Move a file. Falls back to copying the file when it cannot be renamed (e.g. to another file system)
+func moveFile(source string, destination string) error {
+
+	if err := os.Rename(source, destination); err == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(destination, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Remove(source)
 }
 
 // Create the cache folder
-func createCacheFolder() {
+func createCacheFolder() error {
 
 	cacheDir := cacheFolder
 
@@ -1674,9 +2206,12 @@ func createCacheFolder() {
 		// Create the directory and any necessary parents
 		err := os.MkdirAll(cacheDir, 0755)
 		if err != nil {
-			log.Fatalf(red+"Error. Failed to create the cache directory: %v"+reset, err)
+			logger.Error("Failed to create the cache directory", "error", err)
+			return err
 		}
 	}
+
+	return nil
 }
 
 func getHostnamePort() {
@@ -1684,31 +2219,132 @@ func getHostnamePort() {
 	// Load the INI file
 	cfg, err := ini.Load("segmentifyLite.ini")
 	if err != nil {
-		fmt.Printf(red+"Error. getHostnamePort. Failed to read segmentifyLite.ini file: %v"+reset, err)
+		slog.Error("getHostnamePort. Failed to read segmentifyLite.ini file", "error", err)
 	}
 
 	// Get values from the .ini file
 	if !cfg.Section("").HasKey("protocol") {
-		fmt.Println(yellow + "Warning: 'protocol' not found in configuration file. Will default to HTTPS." + reset)
+		slog.Warn("'protocol' not found in configuration file. Will default to HTTPS")
 		protocol = "https"
 	} else {
 		protocol = cfg.Section("").Key("protocol").String()
 	}
 
 	if !cfg.Section("").HasKey("hostname") {
-		fmt.Println(yellow + "Warning: 'hostname' not found in configuration file. Will default to localhost." + reset)
+		slog.Warn("'hostname' not found in configuration file. Will default to localhost")
 	} else {
 		hostname = cfg.Section("").Key("hostname").String()
 	}
 
 	if !cfg.Section("").HasKey("port") {
-		fmt.Println(yellow + "Warning: 'port' not found in configuration file. By default no port number will be used." + reset)
+		slog.Warn("'port' not found in configuration file. By default no port number will be used")
 		port = ""
 	} else {
 		port = cfg.Section("").Key("port").String()
 		port = ":" + port
 	}
 
+	// Crawl fields requested by default. Comma separated list of Botify field names
+	if cfg.Section("").HasKey("crawlFields") {
+		defaultCrawlFields, err = parseCrawlFields(cfg.Section("").Key("crawlFields").String())
+		if err != nil {
+			slog.Warn("Invalid setting ignored", "setting", "crawlFields", "error", err)
+		}
+	}
+
+	// Maximum number of projects downloaded at the same time in batch mode
+	if cfg.Section("").HasKey("batchConcurrency") {
+		concurrency, err := cfg.Section("").Key("batchConcurrency").Int()
+		if err != nil || concurrency < 1 {
+			slog.Warn("Invalid setting, the default is used", "setting", "batchConcurrency", "default", batchConcurrency)
+		} else {
+			batchConcurrency = concurrency
+		}
+	}
+
+	// URL lengths flagged in the URL hygiene segment. Comma separated list, e.g. 115,200
+	if cfg.Section("").HasKey("urlLengths") {
+		lengths, err := parseURLLengths(cfg.Section("").Key("urlLengths").String())
+		if err != nil || len(lengths) == 0 {
+			slog.Warn("Invalid setting ignored", "setting", "urlLengths", "error", err)
+		} else {
+			urlLengths = lengths
+		}
+	}
+
+	// Cache retention policy. A value of 0 disables the policy
+	section := cfg.Section("")
+	if section.HasKey("cacheMaxAgeHours") {
+		value, err := section.Key("cacheMaxAgeHours").Int()
+		if err != nil || value < 0 {
+			slog.Warn("Invalid setting ignored", "setting", "cacheMaxAgeHours")
+		} else {
+			cacheMaxAge = time.Duration(value) * time.Hour
+		}
+	}
+	if section.HasKey("cacheCleanupIntervalMinutes") {
+		value, err := section.Key("cacheCleanupIntervalMinutes").Int()
+		if err != nil || value < 0 {
+			slog.Warn("Invalid setting ignored", "setting", "cacheCleanupIntervalMinutes")
+		} else {
+			cacheCleanupInterval = time.Duration(value) * time.Minute
+		}
+	}
+	if section.HasKey("cacheMaxSizeMB") {
+		value, err := section.Key("cacheMaxSizeMB").Int64()
+		if err != nil || value < 0 {
+			slog.Warn("Invalid setting ignored", "setting", "cacheMaxSizeMB")
+		} else {
+			cacheMaxSize = value << 20
+		}
+	}
+	if section.HasKey("cacheMaxSessionsPerProject") {
+		value, err := section.Key("cacheMaxSessionsPerProject").Int()
+		if err != nil || value < 0 {
+			slog.Warn("Invalid setting ignored", "setting", "cacheMaxSessionsPerProject")
+		} else {
+			cacheMaxSessionsPerProject = value
+		}
+	}
+	if section.HasKey("cacheCleanupDryRun") {
+		value, err := section.Key("cacheCleanupDryRun").Bool()
+		if err != nil {
+			slog.Warn("Invalid setting ignored", "setting", "cacheCleanupDryRun")
+		} else {
+			cacheCleanupDryRun = value
+		}
+	}
+
+	// Botify API base URL. Used to go through a proxy
+	if section.HasKey("botifyAPIBaseURL") {
+		botifyAPIBaseURL = strings.TrimSuffix(section.Key("botifyAPIBaseURL").String(), "/")
+	}
+
+	// Hreflang fields
+	for _, setting := range []struct {
+		key   string
+		field *string
+	}{{"hreflangLangField", &hreflangLangField}, {"hreflangURLField", &hreflangURLField}} {
+		if !section.HasKey(setting.key) {
+			continue
+		}
+		if value := section.Key(setting.key).String(); validCrawlField.MatchString(value) {
+			*setting.field = value
+		} else {
+			slog.Warn("Invalid setting ignored", "setting", setting.key)
+		}
+	}
+
+	// Local mirror used to fetch the sitemaps
+	if section.HasKey("sitemapMirrorURL") {
+		sitemapMirrorURL = strings.TrimSuffix(section.Key("sitemapMirrorURL").String(), "/")
+	}
+
+	// Folder containing the static assets
+	if section.HasKey("staticFolder") {
+		staticFolder = section.Key("staticFolder").String()
+	}
+
 	// Add port to the hostname if running locally.
 	if envSegmentifyLiteHostingMode == "local" {
 		fullHost = hostname + port
@@ -1720,19 +2356,24 @@ func getHostnamePort() {
 	serverHostname = hostname
 	serverPort = port
 
-	fmt.Printf(green+"\nHostname: %s\n"+reset, serverHostname)
-	fmt.Printf(green+"Port: %s\n"+reset, serverPort)
+	slog.Info("Server address", "hostname", serverHostname, "port", serverPort)
 }
 
 func startUp() {
 
-	//Banner
-	//https://patorjk.com/software/taag/#p=display&c=bash&f=ANSI%20Shadow&t=SegmentifyLite
+	// Structured logs. JSON in a container, colour output when running locally. The level is set with envSegmentifyLiteLogLevel
+	if err := logging.Setup(os.Getenv("envSegmentifyLiteHostingMode"), os.Getenv("envSegmentifyLiteLogLevel")); err != nil {
+		slog.Warn("Invalid log level, info is used", "error", err)
+	}
+	logger = slog.Default()
 
-	// Clear the screen
-	fmt.Print(clearScreen)
+	// The banner is only displayed when running locally
+	//https://patorjk.com/software/taag/#p=display&c=bash&f=ANSI%20Shadow&t=SegmentifyLite
+	if os.Getenv("envSegmentifyLiteHostingMode") == "local" {
+		// Clear the screen
+		fmt.Print(clearScreen)
 
-	fmt.Print(green + `
+		fmt.Print(green + `
  ██████╗  ██████╗         ███████╗███████╗ ██████╗ 
 ██╔════╝ ██╔═══██╗        ██╔════╝██╔════╝██╔═══██╗
 ██║  ███╗██║   ██║        ███████╗█████╗  ██║   ██║
@@ -1740,72 +2381,78 @@ func startUp() {
 ╚██████╔╝╚██████╔╝███████╗███████║███████╗╚██████╔╝
  ╚═════╝  ╚═════╝ ╚══════╝╚══════╝╚══════╝ ╚═════╝`)
 
-	fmt.Print(purple + `
+		fmt.Print(purple + `
 ███████╗███████╗ ██████╗ ███╗   ███╗███████╗███╗   ██╗████████╗██╗███████╗██╗   ██╗██╗     ██╗████████╗███████╗
 ██╔════╝██╔════╝██╔════╝ ████╗ ████║██╔════╝████╗  ██║╚══██╔══╝██║██╔════╝╚██╗ ██╔╝██║     ██║╚══██╔══╝██╔════╝
 ███████╗█████╗  ██║  ███╗██╔████╔██║█████╗  ██╔██╗ ██║   ██║   ██║█████╗   ╚████╔╝ ██║     ██║   ██║   █████╗
 ╚════██║██╔══╝  ██║   ██║██║╚██╔╝██║██╔══╝  ██║╚██╗██║   ██║   ██║██╔══╝    ╚██╔╝  ██║     ██║   ██║   ██╔══╝
 ███████║███████╗╚██████╔╝██║ ╚═╝ ██║███████╗██║ ╚████║   ██║   ██║██║        ██║   ███████╗██║   ██║   ███████╗
 ╚══════╝╚══════╝ ╚═════╝ ╚═╝     ╚═╝╚══════╝╚═╝  ╚═══╝   ╚═╝   ╚═╝╚═╝        ╚═╝   ╚══════╝╚═╝   ╚═╝   ╚══════╝`)
+		fmt.Println()
+	}
 
-	fmt.Println()
-	fmt.Println(purple+"\nVersion:"+reset, version)
-	fmt.Println(green + "\nsegmentifyLite server is ON\n" + reset)
+	slog.Info("segmentifyLite server is ON", "version", version, "maxURLs", maxURLsToProcess*1000)
 
-	now := time.Now()
-	formattedTime := now.Format("15:04 02/01/2006")
-	fmt.Println(green + "Server started at " + formattedTime + reset)
-	fmt.Println(green+"Maximum No. of URLs to be processed is", maxURLsToProcess, "k")
+	// Where the Botify token comes from. The server token is not required when the users provide their own
+	getTokenConfig()
+
+	// How the users are authenticated
+	getAuthConfig()
 
 	// Get the environment variables for token, log & cache folder
 	envBotifyAPIToken, envSegmentifyLiteLogFolder, envSegmentifyLiteFolder, envSegmentifyLiteHostingMode = getEnvVariables()
 
+	// The token never appears in the logs
+	tokenConfig.ServerToken = envBotifyAPIToken
+	logging.Redact(envBotifyAPIToken)
+
+	// The cache folder is created at startup, the readiness check does not create it
+	if err := os.MkdirAll(envSegmentifyLiteFolder, 0755); err != nil {
+		slog.Error("startUp. Cannot create the cache folder", "folder", envSegmentifyLiteFolder, "error", err)
+	}
+
 	// Get the hostname and port
 	getHostnamePort()
 
-	fmt.Println(green + "\n... waiting for requests\n" + reset)
+	slog.Info("Waiting for requests")
 }
 
 // Get environment variables for token and cache folders
 func getEnvVariables() (envBotifyAPIToken string, envSegmentifyLiteLogFolder string, envSegmentifyLiteFolder string, envSegmentifyLiteHostingMode string) {
 
 	// Botify API token from the env. variable getbotifyAPIToken
+	// Not required in user & proxy modes, the token is provided with each request
 	envBotifyAPIToken = os.Getenv("envBotifyAPIToken")
-	if envBotifyAPIToken == "" {
-		fmt.Println(red + "Error. getEnvVariables. envBotifyAPIToken environment variable not set." + reset)
-		fmt.Println(red + "Cannot start segmentifyLite server." + reset)
+	if envBotifyAPIToken == "" && !tokenConfig.PerUser() {
+		slog.Error("getEnvVariables. envBotifyAPIToken environment variable not set. Cannot start segmentifyLite server")
 		os.Exit(0)
 	}
 
 	// Storage folder for the log file
 	envSegmentifyLiteLogFolder = os.Getenv("envSegmentifyLiteLogFolder")
 	if envSegmentifyLiteLogFolder == "" {
-		fmt.Println(red + "Error. getEnvVariables. envSegmentifyLiteLogFolder environment variable not set." + reset)
-		fmt.Println(red + "Cannot start segmentifyLite server." + reset)
+		slog.Error("getEnvVariables. envSegmentifyLiteLogFolder environment variable not set. Cannot start segmentifyLite server")
 		os.Exit(0)
 	} else {
-		fmt.Println()
-		fmt.Println(green + "Log folder: " + envSegmentifyLiteLogFolder + reset)
+		slog.Info("Log folder", "folder", envSegmentifyLiteLogFolder)
 	}
 
 	// Storage folder
 	envSegmentifyLiteFolder = os.Getenv("envSegmentifyLiteFolder")
 	if envSegmentifyLiteFolder == "" {
-		fmt.Println(red + "Error. getEnvVariables. envSegmentifyLiteFolder environment variable not set." + reset)
-		fmt.Println(red + "Cannot start segmentifyLite server." + reset)
+		slog.Error("getEnvVariables. envSegmentifyLiteFolder environment variable not set. Cannot start segmentifyLite server")
 		os.Exit(0)
 	} else {
-		fmt.Println(green + "segmentifyLite cache folder: " + envSegmentifyLiteFolder + reset)
+		slog.Info("segmentifyLite cache folder", "folder", envSegmentifyLiteFolder)
 	}
 
 	// Hosting mode. This will be either "local" or "docker"
 	envSegmentifyLiteHostingMode = os.Getenv("envSegmentifyLiteHostingMode")
 	if envSegmentifyLiteHostingMode == "" {
-		fmt.Println(red + "Error. getEnvVariables. envSegmentifyLiteHostingMode environment variable not set." + reset)
-		fmt.Println(red + "Cannot start segmentifyLite server." + reset)
+		slog.Error("getEnvVariables. envSegmentifyLiteHostingMode environment variable not set. Cannot start segmentifyLite server")
 		os.Exit(0)
 	} else {
-		fmt.Println(green + "segmentifyLite hosting mode: " + envSegmentifyLiteHostingMode + reset)
+		slog.Info("segmentifyLite hosting mode", "mode", envSegmentifyLiteHostingMode)
 	}
 
 	return envBotifyAPIToken, envSegmentifyLiteLogFolder, envSegmentifyLiteFolder, envSegmentifyLiteHostingMode
@@ -1814,7 +2461,6 @@ func getEnvVariables() (envBotifyAPIToken string, envSegmentifyLiteLogFolder str
 // isValidisProductURL checks if a URL ends with a product name followed by a numeric identifier
 func isValidisProductURL(url string) bool {
 	// Define the regex pattern for matching URLs ending with a product name and numeric identifier
-	pattern := `[a-zA-Z0-9\-]+-\d+\.html$`
-	re := regexp.MustCompile(pattern)
+	re := regexp.MustCompile(defaultPDPRegex)
 	return re.MatchString(url)
 }
@@ -0,0 +1,2039 @@
+// segmentifyLite. End-to-end tests. The URLs are downloaded from the fake Botify API and the generated regex is compared to the golden files
+// Run "go test -update" to update the golden files
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"goquery/auth"
+	"goquery/auth/mockidp"
+	"goquery/botifytoken"
+	"goquery/logging"
+	"goquery/segment"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// The generation date changes with each run
+var generatedDateRegex = regexp.MustCompile(`(?m)^# Generated .*$`)
+
+// The health & metrics endpoints are registered once in the default mux
+var registerHealthHandlers sync.Once
+
+// newTestSession prepares a session in a temporary folder. The temporary files are written to the current folder,
+// the test therefore runs in the temporary folder
+func newTestSession(t *testing.T, organisationName string, projectName string) string {
+	t.Helper()
+
+	folder := t.TempDir()
+
+	workingFolder, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(folder); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(workingFolder); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	envSegmentifyLiteLogFolder = folder
+	envSegmentifyLiteFolder = filepath.Join(folder, "cache")
+
+	sessionID, err := generateSessionID(sessionIDLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFolderRoot = envSegmentifyLiteFolder
+	cacheFolder = cacheFolderRoot + "/" + sessionID
+	regexOutputFile = cacheFolder + "/" + segmentFileName
+	if err := createCacheFolder(); err != nil {
+		t.Fatal(err)
+	}
+
+	organisation = organisationName
+	project = projectName
+	labelRules = nil
+	crawlFields = nil
+	hreflangEnabled = false
+	pdpExamples = nil
+	plpExamples = nil
+	existingRobots = nil
+	sitemapSources = nil
+	robotsUserAgent = defaultRobotsUserAgent
+	sessionOwner = ""
+
+	return sessionID
+}
+
+func TestSegmentationGolden(t *testing.T) {
+
+	goldenFolder, err := filepath.Abs(filepath.Join("testdata", "golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		project  string
+		shopify  bool
+		sfcc     bool
+		hreflang bool
+		robots   bool // The robots.txt of the project is evaluated, the golden file is <project>-robots.segment.txt
+		urlCount int
+	}{
+		{project: "shopify", shopify: true, urlCount: 703},
+		{project: "shopify", shopify: true, robots: true, urlCount: 703},
+		{project: "sfcc", sfcc: true, urlCount: 663},
+		{project: "multi-subdomain", urlCount: 805},
+		{project: "parameter-heavy", urlCount: 1065},
+		{project: "spa", urlCount: 327},
+		{project: "hreflang", hreflang: true, urlCount: 141},
+	}
+
+	for _, test := range tests {
+		goldenName := test.project
+		if test.robots {
+			goldenName += "-robots"
+		}
+		t.Run(goldenName, func(t *testing.T) {
+			newFakeBotify(t)
+			sessionID := newTestSession(t, "test-org", test.project)
+			hreflangEnabled = test.hreflang
+			if test.robots {
+				robotsFile, err := os.Open(filepath.Join(goldenFolder, "..", "botify", test.project, "robots.txt"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer robotsFile.Close()
+				if existingRobots, err = parseRobots(robotsFile); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := runSegmentation(sessionID, nil); err != nil {
+				t.Fatalf("runSegmentation() = %v, want no error", err)
+			}
+
+			if shopifyDetected != test.shopify || sfccDetected != test.sfcc {
+				t.Errorf("platforms detected: Shopify %v, SFCC %v. Want Shopify %v, SFCC %v", shopifyDetected, sfccDetected, test.shopify, test.sfcc)
+			}
+
+			urls, err := readURLFile(urlExtractFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(urls) != test.urlCount {
+				t.Errorf("%d URLs downloaded, want %d", len(urls), test.urlCount)
+			}
+
+			segmentText, err := os.ReadFile(regexOutputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := generatedDateRegex.ReplaceAll(segmentText, []byte("# Generated <date>"))
+
+			goldenFile := filepath.Join(goldenFolder, goldenName+".segment.txt")
+			if *updateGolden {
+				if err := os.WriteFile(goldenFile, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("cannot read the golden file (run go test -update to create it): %v", err)
+			}
+			if string(got) != string(want) {
+				gotFile := filepath.Join(t.TempDir(), goldenName+".segment.txt")
+				_ = os.WriteFile(gotFile, got, 0644)
+				t.Errorf("the generated regex is different from %s. Generated regex saved to %s", goldenFile, gotFile)
+			}
+		})
+	}
+}
+
+func TestSegmentationNoProject(t *testing.T) {
+
+	newFakeBotify(t)
+	sessionID := newTestSession(t, "test-org", "unknown-project")
+
+	if err := runSegmentation(sessionID, nil); !errors.Is(err, errNoProjectFound) {
+		t.Errorf("runSegmentation() = %v, want %v", err, errNoProjectFound)
+	}
+}
+
+func TestSegmentationInvalidToken(t *testing.T) {
+
+	newFakeBotify(t)
+	botifyToken = "invalid-token"
+	sessionID := newTestSession(t, "test-org", "shopify")
+
+	if err := runSegmentation(sessionID, nil); !errors.Is(err, errNoProjectFound) {
+		t.Errorf("runSegmentation() = %v, want %v", err, errNoProjectFound)
+	}
+}
+
+func TestSegmentationUploadedURLs(t *testing.T) {
+
+	fixture, err := filepath.Abs(filepath.Join(fakeBotifyFolder, "shopify", "urls.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := newTestSession(t, "", "")
+
+	// The API is not used when the URLs are uploaded
+	botifyAPIBaseURL = "http://127.0.0.1:0"
+	t.Cleanup(func() { botifyAPIBaseURL = "https://api.botify.com" })
+
+	file, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := runSegmentation(sessionID, file); err != nil {
+		t.Fatalf("runSegmentation() = %v, want no error", err)
+	}
+	if !shopifyDetected {
+		t.Error("Shopify not detected")
+	}
+}
+
+func TestSitemapCoverage(t *testing.T) {
+
+	newFakeBotify(t)
+	sessionID := newTestSession(t, "test-org", "shopify")
+
+	// The child sitemaps listed in the uploaded sitemap index are fetched from the mirror
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	_, _ = writer.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://www.shop-example.com/products/winter-blue-shirt-0</loc></url>
+<url><loc>https://www.shop-example.com/products/sport-slim-boots-1</loc></url>
+<url><loc>https://www.shop-example.com/products/not-crawled</loc></url>
+</urlset>`))
+	_ = writer.Close()
+
+	mirror := http.NewServeMux()
+	mirror.HandleFunc("GET /sitemap_products.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(gzipped.Bytes())
+	})
+	mirror.HandleFunc("GET /sitemap_pages.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("https://www.shop-example.com/\n"))
+	})
+	server := httptest.NewServer(mirror)
+	t.Cleanup(server.Close)
+
+	sitemapMirrorURL = server.URL
+	t.Cleanup(func() { sitemapMirrorURL = "" })
+
+	sitemapSources = []sitemapSource{{Name: "sitemap_index.xml", Content: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://www.shop-example.com/sitemap_products.xml.gz</loc></sitemap>
+<sitemap><loc>https://www.shop-example.com/sitemap_pages.txt</loc></sitemap>
+<sitemap><loc>https://www.shop-example.com/sitemap_missing.xml</loc></sitemap>
+</sitemapindex>`)}}
+
+	if err := runSegmentation(sessionID, nil); err != nil {
+		t.Fatalf("runSegmentation() = %v, want no error", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheFolder, sitemapCoverageFile)); err != nil {
+		t.Fatalf("sitemap coverage report not generated: %v", err)
+	}
+
+	sitemapURLs, load := loadSitemaps(sitemapSources)
+	if load.Files != 3 || load.Indexes != 1 || len(load.Errors) != 1 || len(sitemapURLs) != 4 {
+		t.Fatalf("loadSitemaps() read %d files, %d indexes, %d errors, %d URLs. Want 3, 1, 1, 4", load.Files, load.Indexes, len(load.Errors), len(sitemapURLs))
+	}
+
+	classifier, err := segment.Compile(regexOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawledURLs, err := readURLFile(urlExtractFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coverage, missingExamples, notCrawledExamples := sitemapCoverage(classifier, crawledURLs, sitemapURLs)
+
+	for _, segmentCounts := range coverage {
+		crawled, inSitemaps, notCrawled := 0, 0, 0
+		for _, label := range segmentCounts.Labels {
+			crawled += label.Crawled
+			inSitemaps += label.InSitemaps
+			notCrawled += label.NotCrawled
+		}
+		if crawled != 703 || inSitemaps != 3 || notCrawled != 1 {
+			t.Errorf("%s: %d crawled, %d in sitemaps, %d not crawled. Want 703, 3, 1", segmentCounts.Name, crawled, inSitemaps, notCrawled)
+		}
+	}
+	if len(missingExamples) != maxSitemapExamples || len(notCrawledExamples) != 1 {
+		t.Errorf("%d missing examples, %d not crawled examples. Want %d, 1", len(missingExamples), len(notCrawledExamples), maxSitemapExamples)
+	}
+}
+
+func TestBatch(t *testing.T) {
+
+	newFakeBotify(t)
+	newTestSession(t, "", "")
+
+	form := url.Values{}
+	form.Set("organization", "test-org")
+	form.Set("projects", "shopify\nsfcc\nmissing")
+	request := httptest.NewRequest("POST", "/batch", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+
+	// The session globals are locked during the downloads. The downloads must not wait for the lock
+	mutex.Lock()
+	done := make(chan struct{})
+	go func() {
+		batchHandler(recorder, request)
+		close(done)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		downloads, _ := filepath.Glob(filepath.Join(envSegmentifyLiteFolder, "*", urlExtractFile))
+		if len(downloads) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			mutex.Unlock()
+			t.Fatalf("%d projects downloaded while the session globals are locked, want 2", len(downloads))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.Unlock()
+	<-done
+
+	if recorder.Code != http.StatusFound || !strings.HasSuffix(recorder.Header().Get("Location"), batchSummaryFile) {
+		t.Fatalf("POST /batch = %d %s, want a redirection to the summary", recorder.Code, recorder.Header().Get("Location"))
+	}
+	summary, err := os.ReadFile(filepath.Join(envSegmentifyLiteFolder, strings.TrimPrefix(recorder.Header().Get("Location"), "/sessions/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(summary), "2 of 3 projects segmented") {
+		t.Errorf("the batch summary does not report 2 of 3 projects segmented")
+	}
+
+	runs, err := readHistory(historyFilter{})
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("readHistory() = %d runs, %v, want 3 runs", len(runs), err)
+	}
+	for _, run := range runs {
+		wantStatus := "success"
+		if run.Project == "missing" {
+			wantStatus = "errorNoProjectFound"
+		}
+		if run.Status != wantStatus {
+			t.Errorf("run of %s = %s, want %s", run.Project, run.Status, wantStatus)
+		}
+		if marker, err := readSessionMarker(run.Folder); err != nil || marker.InProgress {
+			t.Errorf("run of %s. readSessionMarker() = %+v, %v, want the session complete", run.Project, marker, err)
+		}
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+
+	robots, err := parseRobots(strings.NewReader(`# Rules before the first user agent are ignored
+Disallow: /ignored
+
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search*?q=
+Disallow: /tie
+Allow: /tie
+Disallow:
+
+User-agent: Googlebot
+User-agent: Bingbot # Comment
+Disallow: /google
+Allow: /google/allowed
+Disallow: /*?sessionid=
+
+user-agent: googlebot-news
+DISALLOW: /news
+
+User-agent: Googlebot
+Disallow: /combined
+
+Sitemap: https://www.example.com/sitemap.xml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(robots.Groups) != 4 || !slices.Equal(robots.Sitemaps, []string{"https://www.example.com/sitemap.xml"}) {
+		t.Fatalf("parseRobots() = %d groups, sitemaps %v, want 4 groups and 1 sitemap", len(robots.Groups), robots.Sitemaps)
+	}
+
+	tests := []struct {
+		name        string
+		userAgent   string
+		url         string
+		wantAllowed bool
+		wantPattern string // Pattern of the deciding rule, empty when no rule matches
+	}{
+		{"no rule", "*", "https://www.example.com/products", true, ""},
+		{"rule before the first user agent", "*", "/ignored", true, ""},
+		{"prefix match", "*", "/private/area", false, "/private"},
+		{"longest match wins", "*", "/private/public/page", true, "/private/public"},
+		{"longest match, shorter allow", "*", "/privately", false, "/private"},
+		{"wildcard", "*", "/search/all?q=shoes", false, "/search*?q="},
+		{"wildcard, no match", "*", "/search?page=2", true, ""},
+		{"end anchor", "*", "/docs/guide.pdf", false, "/*.pdf$"},
+		{"end anchor, query string", "*", "/docs/guide.pdf?version=2", true, ""},
+		{"allow wins a tie", "*", "/tie/page", true, "/tie"},
+		{"case sensitive paths", "*", "/PRIVATE", true, ""},
+		{"query string matched", "googlebot", "https://www.example.com/list?sessionid=1", false, "/*?sessionid="},
+		{"fragment ignored", "googlebot", "https://www.example.com/google/allowed#top", true, "/google/allowed"},
+		{"user agent group", "Googlebot", "/private/area", true, ""},
+		{"user agent case insensitive", "GOOGLEBOT", "/google/page", false, "/google"},
+		{"several user agents in a group", "bingbot", "/google/page", false, "/google"},
+		{"groups of the same user agent combined", "googlebot", "/combined", false, "/combined"},
+		{"most specific user agent", "googlebot-news", "/news/today", false, "/news"},
+		{"most specific user agent, no other group", "googlebot-news", "/google/page", true, ""},
+		{"user agent prefix", "googlebot-image", "/google/page", false, "/google"},
+		{"unknown user agent uses *", "otherbot", "/private/area", false, "/private"},
+		{"host without path", "*", "https://www.example.com", true, ""},
+	}
+
+	for _, test := range tests {
+		rules := robots.agentRules(test.userAgent)
+		path := robotsPath(test.url)
+		rule, found := robotsMatch(rules, path)
+		if robotsAllowed(rules, path) != test.wantAllowed || found != (test.wantPattern != "") || rule.Pattern != test.wantPattern {
+			t.Errorf("%s. robotsMatch(%s, %q) = %q, found %v, want %q. Allowed %v, want %v",
+				test.name, test.userAgent, path, rule.Pattern, found, test.wantPattern, robotsAllowed(rules, path), test.wantAllowed)
+		}
+	}
+}
+
+func TestCalendarRules(t *testing.T) {
+
+	// Dated folders for 24 months, e.g. /events/2023/01/ to /events/2024/12/
+	datedURLs := func(folder string, monthFormat string) []string {
+		var urls []string
+		for month := 0; month < 24; month++ {
+			urls = append(urls, fmt.Sprintf("https://www.example.com%s/%d/"+monthFormat+"/", folder, 2023+month/12, month%12+1))
+		}
+		return urls
+	}
+
+	tests := []struct {
+		name         string
+		urls         []string
+		wantPatterns []string
+	}{
+		{"two-digit months", datedURLs("/events", "%02d"), []string{"/events/2023/0*/", "/events/2023/1*/", "/events/2024/0*/", "/events/2024/1*/"}},
+		{"months without leading zero", datedURLs("/news", "%d"), []string{
+			"/news/2023/1*/", "/news/2023/2/", "/news/2023/3/", "/news/2023/4/", "/news/2023/5/", "/news/2023/6/", "/news/2023/7/", "/news/2023/8/", "/news/2023/9/",
+			"/news/2024/1*/", "/news/2024/2/", "/news/2024/3/", "/news/2024/4/", "/news/2024/5/", "/news/2024/6/", "/news/2024/7/", "/news/2024/8/", "/news/2024/9/",
+		}},
+		{"root level", datedURLs("", "%02d"), nil},
+		{"too few months", datedURLs("/events", "%02d")[:23], nil},
+	}
+
+	for _, test := range tests {
+		// Folders starting like a year are not blocked
+		urls := append(test.urls, "https://www.example.com/2000-products/", "https://www.example.com/events/20-years/")
+		var patterns []string
+		for _, rule := range proposeCrawlRules(urls) {
+			if strings.HasPrefix(rule.Reason, "Calendar.") {
+				patterns = append(patterns, rule.Patterns...)
+				for _, example := range rule.Examples {
+					if strings.Contains(example, "products") || strings.Contains(example, "years") {
+						t.Errorf("%s. %s is blocked by %v", test.name, example, rule.Patterns)
+					}
+				}
+			}
+		}
+		if !slices.Equal(patterns, test.wantPatterns) {
+			t.Errorf("%s. calendar patterns = %v, want %v", test.name, patterns, test.wantPatterns)
+		}
+	}
+
+	// The proposals are tested against the robots.txt group of the user agent selected
+	defer func(robots *robotsFile, userAgent string) { existingRobots, robotsUserAgent = robots, userAgent }(existingRobots, robotsUserAgent)
+	var err error
+	if existingRobots, err = parseRobots(strings.NewReader("User-agent: *\nDisallow: /other\n\nUser-agent: Googlebot\nDisallow: /events/\n")); err != nil {
+		t.Fatal(err)
+	}
+	for userAgent, wantBlocked := range map[string]int{"Googlebot": 24, "otherbot": 0} {
+		robotsUserAgent = userAgent
+		found := false
+		for _, rule := range proposeCrawlRules(datedURLs("/events", "%02d")) {
+			if !strings.HasPrefix(rule.Reason, "Calendar.") {
+				continue
+			}
+			found = true
+			if rule.Affected != 24 || rule.AlreadyBlocked != wantBlocked {
+				t.Errorf("user agent %s. %d of %d URLs already blocked, want %d of 24", userAgent, rule.AlreadyBlocked, rule.Affected, wantBlocked)
+			}
+		}
+		if !found {
+			t.Errorf("user agent %s. No calendar rule proposed", userAgent)
+		}
+	}
+}
+
+func TestParseURLLengths(t *testing.T) {
+
+	tests := []struct {
+		lengthList string
+		want       []int
+		wantErr    bool
+	}{
+		{"115,200", []int{115, 200}, false},
+		{" 100, 150 ,250,", []int{100, 150, 250}, false},
+		{"999", []int{999}, false},
+		{"1000", nil, true},
+		{"5000", nil, true},
+		{"0", nil, true},
+		{"-1", nil, true},
+		{"long", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseURLLengths(test.lengthList)
+		if (err != nil) != test.wantErr || !slices.Equal(got, test.want) {
+			t.Errorf("parseURLLengths(%q) = %v, %v, want %v (error %v)", test.lengthList, got, err, test.want, test.wantErr)
+		}
+	}
+
+	// The longest length accepted must compile
+	defer func(lengths []int) { urlLengths = lengths }(urlLengths)
+	urlLengths = []int{maxURLLength}
+	checks, err := urlHygieneChecks()
+	if err != nil {
+		t.Fatalf("urlHygieneChecks() = %v, want no error", err)
+	}
+	longest := checks[len(checks)-1]
+	if url := "https://www.example.com/" + strings.Repeat("a", maxURLLength); !longest.re.MatchString(url) {
+		t.Errorf("%s does not match a URL of %d characters", longest.Label, len(url))
+	}
+}
+
+func TestSegmentsWithCounts(t *testing.T) {
+
+	// The same label name in two segments, and repeated in a segment
+	classifier, err := segment.CompileReader(strings.NewReader(`[segment:folders]
+@Products
+path /products/*
+
+@~Other
+path /*
+
+[segment:types]
+@Products
+path *.html
+
+@Products
+path /shop/*
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	urlFile := filepath.Join(t.TempDir(), "urls.txt")
+	urls := "https://www.example.com/products/a\nhttps://www.example.com/products/b.html\nhttps://www.example.com/shop/c\n"
+	if err := os.WriteFile(urlFile, []byte(urls), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	countedSegments, urlCount, err := segmentsWithCounts(classifier, urlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts []string
+	for _, seg := range countedSegments {
+		for _, label := range seg.Labels {
+			counts = append(counts, fmt.Sprintf("%s/%s=%d", seg.Name, label.Name, label.URLCount))
+		}
+		counts = append(counts, fmt.Sprintf("%s unmatched=%d", seg.Name, seg.UnmatchedURLCount))
+	}
+	want := []string{"folders/Products=2", "folders/~Other=1", "folders unmatched=0", "types/Products=2", "types/Products=0", "types unmatched=1"}
+	if urlCount != 3 || !slices.Equal(counts, want) {
+		t.Errorf("segmentsWithCounts() = %d URLs, %v, want 3 URLs, %v", urlCount, counts, want)
+	}
+}
+
+func TestEditorName(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		want      string
+		wantValid bool
+	}{
+		{"sl_folders", "sl_folders", true},
+		{"  Products ", "Products", true},
+		{"", "", false},
+		{" \t", "", false},
+		{"folders\n[segment:injected]", "", false},
+		{"Products\r\n@Injected", "", false},
+	}
+
+	for _, test := range tests {
+		got, valid := editorName(test.name)
+		if valid != test.wantValid || (valid && got != test.want) {
+			t.Errorf("editorName(%q) = %q, %v, want %q, %v", test.name, got, valid, test.want, test.wantValid)
+		}
+	}
+}
+
+func TestEditorExport(t *testing.T) {
+
+	sessionID := newTestSession(t, "", "")
+	writeSessionMarker(cacheFolder, sessionID, "", "", "")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/segments/{sessionID}/export", apiExport)
+
+	editedSegments := func(field string, pattern string) string {
+		rules, _ := json.Marshal([]segment.Rule{{Field: field, Pattern: pattern}})
+		return `{"segments": [{"name": "sl_edited", "labels": [{"name": "Products", "rules": ` + string(rules) + `}]}]}`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{"valid", editedSegments("path", "/products/*"), http.StatusOK, "[segment:sl_edited]\n@Products\npath /products/*\n"},
+		{"valid regex", editedSegments("path", "rx:^/p/[0-9]+$"), http.StatusOK, "path rx:^/p/[0-9]+$\n"},
+		{"new line in the pattern", editedSegments("path", "/a\n[segment:injected]"), http.StatusBadRequest, "invalid rule"},
+		{"carriage return in the pattern", editedSegments("path", "/a\r@Injected"), http.StatusBadRequest, "invalid rule"},
+		{"new line in the field", editedSegments("path /a\nurl", "*"), http.StatusBadRequest, "invalid rule"},
+		{"new line in an or group", `{"segments": [{"name": "s", "labels": [{"name": "A", "rules": [{"or": [{"field": "path", "pattern": "/a\n@B"}]}]}]}]}`, http.StatusBadRequest, "invalid rule"},
+		{"invalid regex", editedSegments("path", "rx:(unclosed"), http.StatusBadRequest, "invalid regex"},
+		{"unsupported field", editedSegments("host", "*"), http.StatusBadRequest, "unsupported rule field"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/api/segments/"+sessionID+"/export", strings.NewReader(test.body))
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		if recorder.Code != test.want || !strings.Contains(recorder.Body.String(), test.wantBody) {
+			t.Errorf("%s. POST export = %d %q, want %d and %q", test.name, recorder.Code, recorder.Body.String(), test.want, test.wantBody)
+		}
+	}
+}
+
+func TestGenerateSessionID(t *testing.T) {
+
+	// Session IDs are generated concurrently by the batch mode and /submit
+	var wg sync.WaitGroup
+	sessionIDs := make([]string, 50)
+	for i := range sessionIDs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessionID, err := generateSessionID(sessionIDLength)
+			if err != nil {
+				t.Error(err)
+			}
+			sessionIDs[i] = sessionID
+		}(i)
+	}
+	wg.Wait()
+
+	counters := make(map[string]bool)
+	for _, sessionID := range sessionIDs {
+		counter, _, _ := strings.Cut(sessionID, "-")
+		if !validSessionID.MatchString(sessionID) || counters[counter] {
+			t.Errorf("session ID %s is invalid or its counter is not unique", sessionID)
+		}
+		counters[counter] = true
+	}
+}
+
+// useCachePolicy sets the cache retention policy for a test
+func useCachePolicy(t *testing.T, maxAge time.Duration, maxSize int64, maxSessionsPerProject int, dryRun bool) {
+	t.Helper()
+
+	previousAge, previousSize, previousSessions, previousDryRun := cacheMaxAge, cacheMaxSize, cacheMaxSessionsPerProject, cacheCleanupDryRun
+	cacheMaxAge, cacheMaxSize, cacheMaxSessionsPerProject, cacheCleanupDryRun = maxAge, maxSize, maxSessionsPerProject, dryRun
+	t.Cleanup(func() {
+		cacheMaxAge, cacheMaxSize, cacheMaxSessionsPerProject, cacheCleanupDryRun = previousAge, previousSize, previousSessions, previousDryRun
+	})
+}
+
+// createCachedSession creates a session folder with a file of size bytes. The marker is not written when created is zero
+func createCachedSession(t *testing.T, folder string, marker sessionMarker, size int) {
+	t.Helper()
+
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "go_seo_segmentifyLite.html"), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !marker.Created.IsZero() {
+		saveSessionMarker(folder, marker)
+	}
+}
+
+func TestRemoveCachedSession(t *testing.T) {
+
+	root := filepath.Join(t.TempDir(), "cache")
+	outside := filepath.Join(t.TempDir(), "outside")
+	createCachedSession(t, filepath.Join(root, "session"), sessionMarker{}, 10)
+	createCachedSession(t, filepath.Join(outside, "sub"), sessionMarker{}, 10)
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		folder  string
+		wantErr bool
+	}{
+		{"cache root", root, true},
+		{"parent folder", root + "/..", true},
+		{"../ path", root + "/../outside", true},
+		{"../ path from a session", root + "/session/../../outside", true},
+		{"absolute path outside", outside, true},
+		{"symbolic link to a folder outside", filepath.Join(root, "link"), true},
+		{"folder behind a symbolic link", filepath.Join(root, "link", "sub"), true},
+		{"missing folder", filepath.Join(root, "missing"), true},
+		{"session folder", filepath.Join(root, "session"), false},
+	}
+
+	for _, test := range tests {
+		if err := removeCachedSession(root, test.folder); (err != nil) != test.wantErr {
+			t.Errorf("%s. removeCachedSession(%s) = %v, want error %v", test.name, test.folder, err, test.wantErr)
+		}
+	}
+
+	// Nothing outside the session folder is removed
+	for _, folder := range []string{root, filepath.Join(outside, "sub")} {
+		if _, err := os.Stat(folder); err != nil {
+			t.Errorf("%s was removed", folder)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "session")); !os.IsNotExist(err) {
+		t.Errorf("the session folder was not removed")
+	}
+}
+
+func TestExpiredSessions(t *testing.T) {
+
+	now := time.Now()
+	session := func(name string, project string, age time.Duration, sizeMB int64, inProgress bool) cachedSession {
+		marker := sessionMarker{SessionID: name, Organisation: "org", Project: project, Created: now.Add(-age), InProgress: inProgress}
+		if project == "" {
+			// Folder without marker. The folder modification time is used
+			marker = sessionMarker{Created: now.Add(-age)}
+		}
+		return cachedSession{Folder: name, Marker: marker, Size: sizeMB << 20}
+	}
+
+	tests := []struct {
+		name                  string
+		maxAge                time.Duration
+		maxSizeMB             int64
+		maxSessionsPerProject int
+		sessions              []cachedSession // Oldest first
+		want                  []string
+	}{
+		{"policies disabled", 0, 0, 0,
+			[]cachedSession{session("old", "p1", 1000*time.Hour, 100, false)}, nil},
+		{"maximum age", 24 * time.Hour, 0, 0,
+			[]cachedSession{session("old", "p1", 48*time.Hour, 1, false), session("recent", "p1", time.Hour, 1, false)}, []string{"old"}},
+		{"maximum age, folder without marker", 24 * time.Hour, 0, 0,
+			[]cachedSession{session("unmarked-old", "", 48*time.Hour, 1, false), session("unmarked-recent", "", time.Hour, 1, false)}, []string{"unmarked-old"}},
+		{"sessions per project", 0, 0, 2,
+			[]cachedSession{session("p1-1", "p1", 4*time.Hour, 1, false), session("p1-2", "p1", 3*time.Hour, 1, false), session("p2-1", "p2", 2*time.Hour, 1, false),
+				session("unmarked", "", 2*time.Hour, 1, false), session("p1-3", "p1", time.Hour, 1, false)}, []string{"p1-1"}},
+		{"total size, oldest first", 0, 10, 0,
+			[]cachedSession{session("s1", "p1", 3*time.Hour, 6, false), session("s2", "p2", 2*time.Hour, 6, false), session("s3", "p3", time.Hour, 6, false)}, []string{"s1", "s2"}},
+		{"removed once", 24 * time.Hour, 1, 1,
+			[]cachedSession{session("old", "p1", 48*time.Hour, 6, false), session("recent", "p1", time.Hour, 1, false)}, []string{"old"}},
+		{"in progress", time.Hour, 1, 1,
+			[]cachedSession{session("batch", "p1", 2*time.Hour, 6, true), session("recent", "p2", time.Minute, 1, false)}, nil},
+		{"in progress, timed out", time.Hour, 0, 0,
+			[]cachedSession{session("stopped", "p1", cacheInProgressTimeout+time.Hour, 1, true)}, []string{"stopped"}},
+		{"folder without marker being created", 0, 1, 0,
+			[]cachedSession{session("unmarked-new", "", time.Second, 6, false)}, nil},
+	}
+
+	for _, test := range tests {
+		useCachePolicy(t, test.maxAge, test.maxSizeMB<<20, test.maxSessionsPerProject, false)
+		var got []string
+		for _, session := range expiredSessions(test.sessions, now) {
+			got = append(got, session.Folder)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s. expiredSessions() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCleanCache(t *testing.T) {
+
+	newTestSession(t, "", "")
+	root := envSegmentifyLiteFolder
+	old := time.Now().Add(-48 * time.Hour)
+
+	createCachedSession(t, filepath.Join(root, "expired"), sessionMarker{SessionID: "expired", Organisation: "org", Project: "p1", Created: old}, 10)
+	createCachedSession(t, filepath.Join(root, "in-progress"), sessionMarker{SessionID: "in-progress", Organisation: "org", Project: "p1", Created: time.Now().Add(-2 * time.Hour), InProgress: true}, 10)
+	createCachedSession(t, filepath.Join(root, "unmarked"), sessionMarker{}, 10)
+	if err := os.Chtimes(filepath.Join(root, "unmarked"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired session outside the cache folder, linked from the cache folder
+	outside := filepath.Join(t.TempDir(), "outside")
+	createCachedSession(t, outside, sessionMarker{SessionID: "outside", Organisation: "org", Project: "p1", Created: old}, 10)
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(folder string) bool {
+		_, err := os.Stat(folder)
+		return err == nil
+	}
+
+	// Dry run. Nothing is removed
+	useCachePolicy(t, time.Hour, 0, 0, true)
+	cleanCache()
+	for _, name := range []string{"expired", "in-progress", "unmarked", "link"} {
+		if !exists(filepath.Join(root, name)) {
+			t.Errorf("dry run. %s was removed", name)
+		}
+	}
+
+	useCachePolicy(t, time.Hour, 0, 0, false)
+	cleanCache()
+	want := map[string]bool{"expired": false, "unmarked": false, "in-progress": true, "link": true, filepath.Base(cacheFolder): true}
+	for name, wantExists := range want {
+		if exists(filepath.Join(root, name)) != wantExists {
+			t.Errorf("cleanCache(). %s exists = %v, want %v", name, !wantExists, wantExists)
+		}
+	}
+	if !exists(filepath.Join(outside, sessionMarkerFile)) {
+		t.Error("cleanCache() removed a folder outside the cache folder")
+	}
+
+	// Completed sessions can be removed
+	completeSessionMarker(filepath.Join(root, "in-progress"))
+	if marker, err := readSessionMarker(filepath.Join(root, "in-progress")); err != nil || marker.InProgress || marker.SessionID != "in-progress" {
+		t.Errorf("completeSessionMarker() = %+v, %v, want the session complete", marker, err)
+	}
+	cleanCache()
+	if exists(filepath.Join(root, "in-progress")) {
+		t.Error("cleanCache() kept the completed session")
+	}
+}
+
+func TestSPARouteLabels(t *testing.T) {
+
+	newTestSession(t, "", "")
+
+	// Route folders taken from the URL fragments
+	var urls []string
+	for i := 0; i < minSPARouteURLs; i++ {
+		urls = append(urls, fmt.Sprintf("https://www.example.com/#!/my shop[1]/item-%d", i), fmt.Sprintf("https://www.example.com/#/products/%d", i))
+	}
+	if err := os.WriteFile(urlExtractFile, []byte(strings.Join(urls, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spaRoutesSegment(); err != nil {
+		t.Fatal(err)
+	}
+	segmentText, err := os.ReadFile(regexOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var labels []string
+	for _, line := range strings.Split(string(segmentText), "\n") {
+		if strings.HasPrefix(line, "@") {
+			labels = append(labels, line)
+		}
+	}
+	want := []string{"@Route/my_shop_1", "@Route/products", "@Route/Other", "@~Server_routes"}
+	if !slices.Equal(labels, want) {
+		t.Errorf("sl_spa_routes labels = %v, want %v", labels, want)
+	}
+	if _, err := segment.CompileReader(bytes.NewReader(segmentText)); err != nil {
+		t.Errorf("the sl_spa_routes segment does not compile: %v", err)
+	}
+}
+
+func TestGeneralisePaths(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		examples []string
+		want     string
+	}{
+		{"names ending with an ID", []string{"https://www.example.com/products/red-shoes-123.html", "https://www.example.com/products/blue-shirt-45.html", "/products/green-hat-9.html"},
+			`^/products/[^/]*[-_]\d+\.html$`},
+		{"numeric IDs", []string{"/p/12345", "/p/678", "/p/9"}, `^/p/\d+$`},
+		{"query string & fragment ignored", []string{"/item/1?color=red", "/item/2#reviews"}, `^/item/\d+$`},
+		{"shared folder kept", []string{"/shop/women/dresses", "/shop/men/shirts", "/shop/kids/toys", "/shop/men/shoes"}, `^(/shop/[^/]+/[^/]+|/shop/men/[^/]+)$`},
+		{"shared page name kept", []string{"/c/index.html", "/d/index.html", "/e/index.html"}, `^/[^/]+/index\.html$`},
+		{"single example", []string{"/only/one-page"}, `^/only/one-page$`},
+	}
+
+	for _, test := range tests {
+		if got := generalisePaths(test.examples); got != test.want {
+			t.Errorf("%s. generalisePaths() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLearnPathRegex(t *testing.T) {
+
+	allURLs := []string{"/p/1", "/p/2", "/p/3", "/p/4", "/c/shoes", "/c/shirts"}
+
+	tests := []struct {
+		name          string
+		positives     []string
+		wantRegex     string
+		wantMatched   int
+		wantPrecision float64
+		wantRecall    float64
+		wantOK        bool
+	}{
+		{"all positives", []string{"/p/1", "/p/2", "/p/3", "/p/4"}, `^/p/\d+$`, 4, 1, 1, true},
+		{"URL matched which is not a positive", []string{"/p/1", "/p/2", "/p/3"}, `^/p/\d+$`, 4, 0.75, 1, true},
+		{"no positives", nil, "", 0, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		pattern, ok := learnPathRegex(test.positives, allURLs)
+		if ok != test.wantOK || pattern.Regex != test.wantRegex || pattern.Matched != test.wantMatched || pattern.Precision != test.wantPrecision || pattern.Recall != test.wantRecall {
+			t.Errorf("%s. learnPathRegex() = %+v, %v, want %s matching %d URLs, precision %.2f, recall %.2f", test.name, pattern, ok, test.wantRegex, test.wantMatched, test.wantPrecision, test.wantRecall)
+		}
+	}
+}
+
+func TestExamplesAnalysis(t *testing.T) {
+
+	sampleURLs := []string{
+		"https://www.example.com/p/1", "https://www.example.com/p/2", "https://www.example.com/p/3", "https://www.example.com/p/4",
+		"https://www.example.com/p/all", "https://www.example.com/c/shoes", "https://www.example.com/c/shirts",
+	}
+
+	tests := []struct {
+		name          string
+		regex         string
+		examples      []string
+		otherExamples []string
+		want          []string
+	}{
+		{"precision & recall against the URLs acquired", `^/p/\d+$`, []string{"/p/1", "https://www.example.com/p/2", "/p/3", "/p/99"}, []string{"/c/shoes"}, []string{
+			"# Learned from 4 example URLs, 3 found in the URLs acquired",
+			"# Recall: 100% (3 of the 3 examples found matched)",
+			"# Precision: 75% (3 of the 4 URLs matched are examples)",
+			"# Examples of the other page type matched: 0 of 1",
+			"# Coverage: 57.1% (URLs found: 4 of 7)",
+		}},
+		{"examples missed", `^/p/\d+$`, []string{"/p/1", "/p/all"}, nil, []string{
+			"# Learned from 2 example URLs, 2 found in the URLs acquired",
+			"# Recall: 50% (1 of the 2 examples found matched)",
+			"# Precision: 25% (1 of the 4 URLs matched are examples)",
+			"# Coverage: 57.1% (URLs found: 4 of 7)",
+		}},
+		{"examples not in the URLs acquired", `^/p/[^/]+$`, []string{"/p/100"}, []string{"/p/other"}, []string{
+			"# Learned from 1 example URLs, 0 found in the URLs acquired",
+			"# Precision & recall not measured, the examples are not in the URLs acquired",
+			"# Examples of the other page type matched: 1 of 1",
+			"# Coverage: 71.4% (URLs found: 5 of 7)",
+		}},
+		{"invalid regex", `^(`, []string{"/p/1"}, nil, []string{"# Invalid regex: error parsing regexp: missing closing ): `^(`"}},
+	}
+
+	for _, test := range tests {
+		got := strings.Split(strings.TrimSuffix(examplesAnalysis(test.regex, test.examples, test.otherExamples, sampleURLs), "\n"), "\n")
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s. examplesAnalysis() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitiseLabel(t *testing.T) {
+
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"Products", "Products"},
+		{"summer sale", "summer_sale"},
+		{"caf%C3%A9", "café"},
+		{"日本語", "日本語"},
+		{"a%2Fb", "a_b"},
+		{"men/shoes/", "men/shoes"},
+		{"/men//shoes", "men/shoes"},
+		{"[segment:x]\n@y", "segment_x_y"},
+		{"__a__b__", "a_b"},
+		{"%%%", "Unnamed"},
+		{"", "Unnamed"},
+		{strings.Repeat("a", 60), strings.Repeat("a", 50)},
+		{strings.Repeat("a", 49) + "/b", strings.Repeat("a", 49)},
+		{strings.Repeat("é", 60), strings.Repeat("é", 50)},
+	}
+
+	for _, test := range tests {
+		if got := sanitiseLabel(test.label); got != test.want {
+			t.Errorf("sanitiseLabel(%q) = %q, want %q", test.label, got, test.want)
+		}
+	}
+}
+
+func TestLoadLabelRules(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		rules   string
+		want    []string // regex => label, or regex => - when excluded
+		wantErr string
+	}{
+		{"rules", "^/blog => Articles\n# comment\n\n^/tmp => -\n^/a=>b => c d\n", []string{"^/blog => Articles", "^/tmp => -", "^/a=>b => c_d"}, ""},
+		{"no rules", "# comment only\n", nil, ""},
+		{"missing separator", "^/blog Articles", nil, "line 1: missing"},
+		{"missing label", "\n^/blog =>", nil, "line 2: both a regex and a label are required"},
+		{"missing regex", "=> Articles", nil, "line 1: both a regex and a label are required"},
+		{"invalid regex", "^/(blog => Articles", nil, "line 1: invalid regex"},
+	}
+
+	for _, test := range tests {
+		rules, err := loadLabelRules(strings.NewReader(test.rules))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s. loadLabelRules() = %v, want an error containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		var got []string
+		for _, rule := range rules {
+			label := rule.label
+			if rule.exclude {
+				label = labelRuleExclude
+			}
+			got = append(got, rule.pattern.String()+" => "+label)
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("%s. loadLabelRules() = %v, %v, want %v", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestGroupFolderLabels(t *testing.T) {
+
+	defer func(rules []labelRule) { labelRules = rules }(labelRules)
+	var err error
+	if labelRules, err = loadLabelRules(strings.NewReader("^/(blog|news)$ => Articles\n^/tmp => -\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	folders := []FolderCount{
+		{"https://www.example.com/shop", 35},
+		{"https://www.example.com/news", 30},
+		{"https://www.example.com/blog", 10},
+		{"https://www.example.com/tmp", 5},
+		{"https://www.example.com/summer%20sale", 4},
+		{"https://www.example.com", 100},
+	}
+	labels, excluded := groupFolderLabels(folders)
+
+	var got []string
+	for _, label := range labels {
+		got = append(got, folderLabelRegex(label))
+	}
+	want := []string{
+		"@Articles\nor (\nurl *https://www.example.com/news/*\nurl *https://www.example.com/blog/*\n)\n\n",
+		"@shop\nurl *https://www.example.com/shop/*\n\n",
+		"@summer_sale\nurl *https://www.example.com/summer%20sale/*\n\n",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("groupFolderLabels() = %q, want %q", got, want)
+	}
+	if len(excluded) != 1 || excluded[0].Text != "https://www.example.com/tmp" {
+		t.Errorf("groupFolderLabels() excluded %v, want the tmp folder", excluded)
+	}
+}
+
+// Segments used to test the exports. Wildcard, regex & "or" rules on the path, query string & URL
+const exportTestSegments = `[segment:sl folders]
+@Products
+path /products/*
+
+@Search
+or (
+path /search*
+query *q=*
+)
+
+@Men's
+path /men/*
+url rx:\.html$
+
+[segment:2nd]
+@A
+url *
+`
+
+func TestExportBigQuery(t *testing.T) {
+
+	classifier, err := segment.CompileReader(strings.NewReader(exportTestSegments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One column per segment, NULL when no label matches
+	want := `SELECT
+  url,
+  CASE
+    WHEN REGEXP_CONTAINS(path, '^/products/.*$') THEN 'Products'
+    WHEN (REGEXP_CONTAINS(path, '^/search.*$') OR REGEXP_CONTAINS(query, '^.*q=.*$')) THEN 'Search'
+    WHEN REGEXP_CONTAINS(path, '^/men/.*$') AND REGEXP_CONTAINS(url, '\\.html$') THEN 'Men\'s'
+    ELSE NULL
+  END AS sl_folders,
+  CASE
+    WHEN REGEXP_CONTAINS(url, '^.*$') THEN 'A'
+    ELSE NULL
+  END AS _2nd
+FROM urls
+`
+	query := exportBigQuery(classifier.Segments())
+	if _, selectStatement, found := strings.Cut(query, "\n)\n"); !found || selectStatement != want {
+		t.Errorf("exportBigQuery() = %s, want the SELECT statement %s", query, want)
+	}
+	if !strings.Contains(query, "IFNULL(REGEXP_EXTRACT(url, '\\\\?([^#]*)'), '') AS query") {
+		t.Errorf("exportBigQuery() = %s, want the query string extracted from the URL", query)
+	}
+}
+
+func TestExportLookerStudio(t *testing.T) {
+
+	classifier, err := segment.CompileReader(strings.NewReader(exportTestSegments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := exportLookerStudio(classifier.Segments())
+	want := []string{
+		"# ----Calculated field: sl folders----\nCASE\n" +
+			"  WHEN REGEXP_CONTAINS(REGEXP_EXTRACT(url, '^[a-zA-Z][a-zA-Z0-9+.-]*://[^/?#]*([^?#]*)'), '^/products/.*$') THEN 'Products'\n",
+		"  WHEN REGEXP_CONTAINS(REGEXP_EXTRACT(url, '^[a-zA-Z][a-zA-Z0-9+.-]*://[^/?#]*([^?#]*)'), '^/men/.*$') AND REGEXP_CONTAINS(url, '\\\\.html$') THEN 'Men\\'s'\n  ELSE NULL\nEND\n",
+		"# ----Calculated field: 2nd----\nCASE\n  WHEN REGEXP_CONTAINS(url, '^.*$') THEN 'A'\n  ELSE NULL\nEND\n",
+	}
+	for _, field := range want {
+		if !strings.Contains(fields, field) {
+			t.Errorf("exportLookerStudio() = %s, want %s", fields, field)
+		}
+	}
+}
+
+func TestExportGA4(t *testing.T) {
+
+	classifier, err := segment.CompileReader(strings.NewReader(exportTestSegments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := exportGA4(classifier.Segments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Segments []ga4Segment `json:"segments"`
+	}
+	if err := json.Unmarshal(content, &export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Segments) != 2 || len(export.Segments[0].ContentGroups) != 3 {
+		t.Fatalf("exportGA4() = %s, want 2 segments and 3 content groups in the first segment", content)
+	}
+
+	filterText := func(filter *ga4Filter) string {
+		return filter.FieldName + " " + filter.StringFilter.Value
+	}
+	groups := export.Segments[0].ContentGroups
+	if got := filterText(groups[0].Filter.Filter); got != "pagePath ^/products/.*$" {
+		t.Errorf("Products filter = %s, want the page path", got)
+	}
+	search := groups[1].Filter.OrGroup
+	if search == nil || len(search.Expressions) != 2 || filterText(search.Expressions[1].Filter) != `pageLocation \?.*q=.*$` {
+		t.Errorf("Search filter = %+v, want an or group, the query string matched in the page location", groups[1].Filter)
+	}
+	men := groups[2].Filter.AndGroup
+	if men == nil || len(men.Expressions) != 2 || filterText(men.Expressions[1].Filter) != `pageLocation \.html$` {
+		t.Errorf("Men's filter = %+v, want an and group", groups[2].Filter)
+	}
+}
+
+func TestExportNames(t *testing.T) {
+
+	columns := map[string]string{"sl_folders": "sl_folders", "sl folders-2": "sl_folders_2", "2nd": "_2nd", "": "_"}
+	for segmentName, want := range columns {
+		if got := columnName(segmentName); got != want {
+			t.Errorf("columnName(%q) = %q, want %q", segmentName, got, want)
+		}
+	}
+
+	literals := map[string]string{"Products": "'Products'", "Men's": `'Men\'s'`, `\d+`: `'\\d+'`}
+	for text, want := range literals {
+		if got := quoteSQLString(text); got != want {
+			t.Errorf("quoteSQLString(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestExportSegments(t *testing.T) {
+
+	newTestSession(t, "test-org", "test-project")
+	classifier, err := segment.CompileReader(strings.NewReader(exportTestSegments))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := exportSegments(classifier.Segments()); err != nil {
+		t.Fatalf("exportSegments() = %v, want no error", err)
+	}
+
+	for _, fileName := range []string{exportBigQueryFile, exportLookerStudioFile, exportGA4File, exportJSONFile, exportYAMLFile} {
+		content, err := os.ReadFile(filepath.Join(cacheFolder, fileName))
+		if err != nil || !strings.Contains(string(content), "Products") {
+			t.Errorf("%s. Export not written to the session folder: %v", fileName, err)
+		}
+	}
+
+	// The neutral rule set compiles back to the same segments
+	content, err := os.ReadFile(filepath.Join(cacheFolder, exportJSONFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ruleSet struct {
+		Segments []segment.Segment `json:"segments"`
+	}
+	if err := json.Unmarshal(content, &ruleSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := segment.CompileSegments(ruleSet.Segments); err != nil || fmt.Sprint(ruleSet.Segments) != fmt.Sprint(classifier.Segments()) {
+		t.Errorf("%s = %v, %v, want the exported segments", exportJSONFile, ruleSet.Segments, err)
+	}
+}
+
+func TestHealthAndMetrics(t *testing.T) {
+
+	newFakeBotify(t)
+	sessionID := newTestSession(t, "test-org", "shopify")
+
+	if err := runSegmentation(sessionID, nil); err != nil {
+		t.Fatalf("runSegmentation() = %v, want no error", err)
+	}
+
+	registerHealthHandlers.Do(healthHandlers)
+	handler := instrumentedHandler()
+	get := func(path string) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d, want %d", code, http.StatusOK)
+	}
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz = %d, want %d. %s", code, http.StatusOK, body)
+	}
+
+	envBotifyAPIToken = ""
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "token: envBotifyAPIToken not set") {
+		t.Errorf("/readyz without token = %d, want %d. %s", code, http.StatusServiceUnavailable, body)
+	}
+
+	// The cache size is measured by the cache janitor, not when the metrics are collected
+	cleanCache()
+
+	code, body := get("/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("/metrics = %d, want %d", code, http.StatusOK)
+	}
+	for _, want := range []string{
+		`segmentifylite_http_requests_total{route="GET /readyz",code="503"} `,
+		`segmentifylite_session_duration_seconds_count{status="success"} `,
+		`segmentifylite_botify_api_requests_total{endpoint="analyses",code="200"} `,
+		`segmentifylite_botify_api_requests_total{endpoint="urls",code="200"} `,
+		`segmentifylite_botify_api_request_duration_seconds_bucket{endpoint="urls",le="+Inf"} `,
+		fmt.Sprintf("segmentifylite_cache_size_bytes %d\n", folderSize(envSegmentifyLiteFolder)),
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics does not include %q", want)
+		}
+	}
+}
+
+func TestLogging(t *testing.T) {
+
+	newFakeBotify(t)
+	sessionID := newTestSession(t, "test-org", "shopify")
+
+	var output bytes.Buffer
+	previousLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(previousLogger)
+		logger = previousLogger
+	})
+	if err := logging.SetupWriter(&output, "docker", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	logging.Redact(botifyToken)
+
+	if err := runSegmentation(sessionID, nil); err != nil {
+		t.Fatalf("runSegmentation() = %v, want no error", err)
+	}
+	logger.Error("Request failed", "request", "Authorization: token "+botifyToken, "token", botifyToken)
+
+	lines := bytes.Split(bytes.TrimSpace(output.Bytes()), []byte("\n"))
+	if len(lines) < 2 {
+		t.Fatalf("%d log lines, want at least 2", len(lines))
+	}
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("invalid JSON log line %s: %v", line, err)
+		}
+		if record["sessionID"] != sessionID || record["organisation"] != "test-org" || record["project"] != "shopify" {
+			t.Errorf("log line without the session: %s", line)
+		}
+		if bytes.Contains(line, []byte(botifyToken)) {
+			t.Errorf("the token is not redacted: %s", line)
+		}
+	}
+	if !strings.Contains(output.String(), `"request":"Authorization: token [REDACTED]"`) {
+		t.Errorf("the token is not replaced in the attribute values:\n%s", output.String())
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+
+	newFakeBotify(t)
+	newTestSession(t, "", "")
+	envBotifyAPIToken = ""
+
+	var output bytes.Buffer
+	previousLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(previousLogger)
+		logger = previousLogger
+	})
+	if err := logging.SetupWriter(&output, "docker", "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("test-cookie-secret")
+	createSegments := func(mode string, setToken func(r *http.Request)) int {
+		tokenConfig = botifytoken.NewConfig(mode, "", secret)
+		request := httptest.NewRequest("POST", "/api/segments", strings.NewReader(`{"organization": "test-org", "project": "shopify"}`))
+		request.Header.Set("Content-Type", "application/json")
+		setToken(request)
+		recorder := httptest.NewRecorder()
+		apiCreateSegments(recorder, request)
+		if botifyToken != "" {
+			t.Errorf("the token of the session is not cleared")
+		}
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		setToken func(r *http.Request)
+		want     int
+	}{
+		{"user token", botifytoken.ModeUser, func(r *http.Request) { r.Header.Set("Authorization", "token "+fakeBotifyToken) }, http.StatusOK},
+		{"user without token", botifytoken.ModeUser, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"proxy header", botifytoken.ModeProxy, func(r *http.Request) { r.Header.Set(botifytoken.DefaultHeader, fakeBotifyToken) }, http.StatusOK},
+		{"proxy cookie", botifytoken.ModeProxy, func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: botifytoken.DefaultCookie, Value: botifytoken.SignCookie(fakeBotifyToken, secret)})
+		}, http.StatusOK},
+		{"proxy tampered cookie", botifytoken.ModeProxy, func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: botifytoken.DefaultCookie, Value: botifytoken.SignCookie(fakeBotifyToken, []byte("another-secret"))})
+		}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if code := createSegments(test.mode, test.setToken); code != test.want {
+			t.Errorf("%s. apiCreateSegments() = %d, want %d", test.name, code, test.want)
+		}
+	}
+
+	// The token of the users is never written to disk or to the logs
+	if bytes.Contains(output.Bytes(), []byte(fakeBotifyToken)) {
+		t.Errorf("the token is written to the logs")
+	}
+	err := filepath.WalkDir(envSegmentifyLiteLogFolder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(content, []byte(fakeBotifyToken)) {
+			t.Errorf("the token is written to %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenSession(t *testing.T) {
+
+	defer func(config botifytoken.Config) { tokenConfig = config }(tokenConfig)
+
+	tests := []struct {
+		name        string
+		mode        string
+		setToken    func(r *http.Request)
+		want        string
+		redactedEnd bool
+	}{
+		{"server token", botifytoken.ModeServer, func(r *http.Request) {}, "test-server-token", true},
+		{"user token", botifytoken.ModeUser, func(r *http.Request) { r.Header.Set("Authorization", "token test-user-token") }, "test-user-token", false},
+		{"proxy token", botifytoken.ModeProxy, func(r *http.Request) { r.Header.Set(botifytoken.DefaultHeader, "test-proxy-token") }, "test-proxy-token", false},
+	}
+
+	for _, test := range tests {
+		tokenConfig = botifytoken.NewConfig(test.mode, "test-server-token", nil)
+		logging.Redact(tokenConfig.ServerToken)
+
+		request := httptest.NewRequest("POST", "/api/segments", nil)
+		test.setToken(request)
+		if err := startTokenSession(request); err != nil || botifyToken != test.want {
+			t.Errorf("%s. startTokenSession() = %v, token %q, want %q", test.name, err, botifyToken, test.want)
+		}
+		if got := logging.RedactString("token " + test.want); got != "token [REDACTED]" {
+			t.Errorf("%s. token not redacted during the session: %s", test.name, got)
+		}
+
+		// The token of the users is forgotten when the session ends, the token of the server is always redacted
+		endTokenSession()
+		redacted := logging.RedactString(test.want) != test.want
+		if botifyToken != "" || redacted != test.redactedEnd {
+			t.Errorf("%s. endTokenSession() token %q, redacted %t, want an empty token, redacted %t", test.name, botifyToken, redacted, test.redactedEnd)
+		}
+	}
+	logging.Forget("test-server-token")
+
+	// No token in user mode
+	tokenConfig = botifytoken.NewConfig(botifytoken.ModeUser, "test-server-token", nil)
+	if err := startTokenSession(httptest.NewRequest("POST", "/api/segments", nil)); !errors.Is(err, botifytoken.ErrNoToken) || botifyToken != "" {
+		t.Errorf("startTokenSession() without token = %v, token %q, want %v", err, botifyToken, botifytoken.ErrNoToken)
+	}
+}
+
+// useAuthenticator enables the authentication for a test. Set before the handlers are wrapped with Require
+func useAuthenticator(t *testing.T, config auth.Config) {
+	t.Helper()
+
+	config.Secret = []byte("test-auth-secret")
+	testAuthenticator, err := auth.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := authenticator
+	authenticator = testAuthenticator
+	t.Cleanup(func() {
+		authenticator = previous
+	})
+}
+
+// createdSessionID returns the session ID of a POST /api/segments response
+func createdSessionID(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var response apiSegmentsResponse
+	if err := json.Unmarshal(body, &response); err != nil || response.SessionID == "" {
+		t.Fatalf("invalid response %s: %v", body, err)
+	}
+	return response.SessionID
+}
+
+func TestAccessControl(t *testing.T) {
+
+	newFakeBotify(t)
+	newTestSession(t, "", "")
+
+	// The password of both users is "secret"
+	htpasswdFile := filepath.Join(t.TempDir(), "htpasswd")
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist")
+	if err := os.WriteFile(htpasswdFile, []byte("alice:$apr1$abcdefgh$h9FWgUz3n9YxylKLlR5SQ/\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(allowlistFile, []byte("# user: organisations\nalice: test-org\nbob: other-org, test-org-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	useAuthenticator(t, auth.Config{Mode: auth.ModeHtpasswd, HtpasswdFile: htpasswdFile, AllowlistFile: allowlistFile})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/segments", authenticator.RequireFunc(apiCreateSegments))
+	mux.HandleFunc("GET /api/segments/{sessionID}", apiGetSegments)
+	mux.HandleFunc("GET /sessions/{sessionID}/{file}", sessionFileHandler)
+	mux.HandleFunc("GET /admin/runs.csv", authenticator.RequireFunc(historyCSVHandler))
+
+	serve := func(method string, path string, user string, password string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(`{"organization": "test-org", "project": "shopify"}`))
+		request.Header.Set("Content-Type", "application/json")
+		if user != "" {
+			request.SetBasicAuth(user, password)
+		}
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Login & allowlist
+	created := serve("POST", "/api/segments", "alice", "secret")
+	if created.Code != http.StatusOK {
+		t.Fatalf("POST /api/segments as alice = %d, want %d. %s", created.Code, http.StatusOK, created.Body.String())
+	}
+	sessionID := createdSessionID(t, created.Body.Bytes())
+
+	if code := serve("POST", "/api/segments", "bob", "secret").Code; code != http.StatusForbidden {
+		t.Errorf("POST /api/segments as bob = %d, want %d", code, http.StatusForbidden)
+	}
+	anonymous := serve("POST", "/api/segments", "", "")
+	if anonymous.Code != http.StatusUnauthorized || anonymous.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("POST /api/segments without login = %d, want %d and a basic authentication challenge", anonymous.Code, http.StatusUnauthorized)
+	}
+	if code := serve("POST", "/api/segments", "alice", "wrong").Code; code != http.StatusUnauthorized {
+		t.Errorf("POST /api/segments with a wrong password = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Run history. The users only see their own runs & the organisations granted to them
+	if runs := serve("GET", "/admin/runs.csv", "alice", "secret").Body.String(); !strings.Contains(runs, sessionID) {
+		t.Errorf("the run history of alice does not include the session %s", sessionID)
+	}
+	if runs := serve("GET", "/admin/runs.csv", "bob", "secret").Body.String(); strings.Contains(runs, sessionID) {
+		t.Errorf("the run history of bob includes the session %s of alice", sessionID)
+	}
+
+	// Ownership
+	resultsPage := sessionURL(sessionID, "go_seo_segmentifyLite.html")
+	tests := []struct {
+		name     string
+		path     string
+		user     string
+		password string
+		want     int
+	}{
+		{"owner", resultsPage, "alice", "secret", http.StatusOK},
+		{"owner API", "/api/segments/" + sessionID, "alice", "secret", http.StatusOK},
+		{"other user", resultsPage, "bob", "secret", http.StatusForbidden},
+		{"other user API", "/api/segments/" + sessionID, "bob", "secret", http.StatusForbidden},
+		{"owner segment file", sessionURL(sessionID, segmentFileName), "alice", "secret", http.StatusOK},
+		{"other user segment file", sessionURL(sessionID, segmentFileName), "bob", "secret", http.StatusForbidden},
+		{"not logged in", resultsPage, "", "", http.StatusUnauthorized},
+		{"invalid share key", resultsPage + "?share=invalid", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if code := serve("GET", test.path, test.user, test.password).Code; code != test.want {
+			t.Errorf("%s. GET %s = %d, want %d", test.name, test.path, code, test.want)
+		}
+	}
+
+	// Sessions without a marker have no known owner, access is refused
+	unmarkedID, err := generateSessionID(sessionIDLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(envSegmentifyLiteFolder, unmarkedID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(envSegmentifyLiteFolder, unmarkedID, "go_seo_segmentifyLite.html"), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve("GET", sessionURL(unmarkedID, "go_seo_segmentifyLite.html"), "alice", "secret").Code; code != http.StatusForbidden {
+		t.Errorf("GET a session without marker = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Share link. The results page includes the link, the cookie then gives access to the session API
+	page := serve("GET", resultsPage, "alice", "secret").Body.String()
+	if !strings.Contains(page, "fetch('"+segmentFileName+"')") {
+		t.Errorf("the results page does not fetch the segment file of the session")
+	}
+	_, shareKey, found := strings.Cut(page, "go_seo_segmentifyLite.html?share=")
+	shareKey, _, _ = strings.Cut(shareKey, "'")
+	if !found || !authenticator.ValidShareKey(sessionID, shareKey) {
+		t.Fatal("the results page does not include a valid share link")
+	}
+	link := "go_seo_segmentifyLite.html?share=" + shareKey
+	shared := serve("GET", sessionURL(sessionID, link), "", "")
+	if shared.Code != http.StatusOK {
+		t.Fatalf("GET share link = %d, want %d", shared.Code, http.StatusOK)
+	}
+	cookies := shared.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("the share link does not set the share cookie")
+	}
+	if code := serve("GET", "/api/segments/"+sessionID, "", "", cookies...).Code; code != http.StatusOK {
+		t.Errorf("GET /api/segments/%s with the share cookie = %d, want %d", sessionID, code, http.StatusOK)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+
+	newFakeBotify(t)
+	newTestSession(t, "", "")
+
+	// Local mock provider. The user is sent with login_hint
+	idp, err := mockidp.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpServer := httptest.NewServer(idp)
+	t.Cleanup(idpServer.Close)
+	idp.Issuer = idpServer.URL
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	useAuthenticator(t, auth.Config{Mode: auth.ModeOIDC, OIDC: auth.OIDCConfig{
+		Issuer:       idpServer.URL,
+		ClientID:     "segmentifyLite",
+		ClientSecret: "test-client-secret",
+		RedirectURL:  server.URL + "/auth/callback",
+	}})
+	authenticator.RegisterHandlers(mux)
+	mux.HandleFunc("GET /config", authenticator.RequireFunc(configHandler))
+	mux.HandleFunc("POST /api/segments", authenticator.RequireFunc(apiCreateSegments))
+	mux.HandleFunc("GET /sessions/{sessionID}/{file}", sessionFileHandler)
+
+	// Logs in as user. The redirects to the provider & back to the callback are followed
+	login := func(user string) *http.Client {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Jar: jar, CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if strings.HasPrefix(request.URL.String(), idpServer.URL+"/authorize") {
+				query := request.URL.Query()
+				query.Set("login_hint", user)
+				request.URL.RawQuery = query.Encode()
+			}
+			return nil
+		}}
+		res, err := client.Get(server.URL + "/config")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK || res.Request.URL.Path != "/config" {
+			t.Fatalf("login as %s ended on %s with %d, want /config with %d", user, res.Request.URL, res.StatusCode, http.StatusOK)
+		}
+		return client
+	}
+
+	alice := login("alice@example.com")
+	res, err := alice.Post(server.URL+"/api/segments", "application/json", strings.NewReader(`{"organization": "test-org", "project": "shopify"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/segments = %d, want %d. %s", res.StatusCode, http.StatusOK, body)
+	}
+	resultsPage := server.URL + sessionURL(createdSessionID(t, body), "go_seo_segmentifyLite.html")
+
+	get := func(client *http.Client, pageURL string) *http.Response {
+		res, err := client.Get(pageURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		return res
+	}
+
+	if res := get(alice, resultsPage); res.StatusCode != http.StatusOK {
+		t.Errorf("GET results page as the owner = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if res := get(login("bob@example.com"), resultsPage); res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET results page as another user = %d, want %d", res.StatusCode, http.StatusForbidden)
+	}
+
+	// Not logged in. Redirected to the login
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res = get(noRedirect, resultsPage)
+	if location, _ := url.Parse(res.Header.Get("Location")); res.StatusCode != http.StatusFound || location == nil || location.Path != "/auth/login" {
+		t.Errorf("GET results page without login = %d to %q, want %d to /auth/login", res.StatusCode, res.Header.Get("Location"), http.StatusFound)
+	}
+}
+
+func TestNumberRangeRegex(t *testing.T) {
+
+	tests := []struct {
+		first int
+		last  int
+		want  string
+	}{
+		{0, 1, "[0-1]"},
+		{2, 5, "[2-5]"},
+		{6, 20, `([6-9]|1\d|20)`},
+		{21, -1, `(2[1-9]|[3-9]\d|[1-9]\d{2,})`},
+		{0, -1, `(\d|[1-9]\d{1,})`},
+		{20, 39, `[2-3]\d`},
+		{100, 199, `1\d\d`},
+		{123, 4567, `(12[3-9]|1[3-9]\d|[2-9]\d{2}|[1-3]\d{3}|4[0-4]\d{2}|45[0-5]\d|456[0-7])`},
+	}
+
+	for _, test := range tests {
+		got := numberRangeRegex(test.first, test.last)
+		if got != test.want {
+			t.Errorf("numberRangeRegex(%d, %d) = %s, want %s", test.first, test.last, got, test.want)
+		}
+
+		// The regex matches exactly the numbers in the range
+		re := regexp.MustCompile("^" + got + "$")
+		for number := 0; number <= 10000; number++ {
+			inRange := number >= test.first && (test.last == -1 || number <= test.last)
+			if re.MatchString(strconv.Itoa(number)) != inRange {
+				t.Errorf("numberRangeRegex(%d, %d) = %s, matches %d: %t", test.first, test.last, got, number, !inRange)
+				break
+			}
+		}
+	}
+}
+
+// paginatedURLs returns a URL per page, from the first page to the last, e.g. /shop?page=%d
+func paginatedURLs(format string, first int, last int) []string {
+	var urls []string
+	for page := first; page <= last; page++ {
+		urls = append(urls, fmt.Sprintf("https://www.example.com"+format, page))
+	}
+	return urls
+}
+
+func TestDetectPagination(t *testing.T) {
+
+	tests := []struct {
+		name string
+		urls []string
+		want []paginationConvention
+	}{
+		{"page parameter", paginatedURLs("/shop?sort=asc&Page=%d", 1, 12), []paginationConvention{{Key: "Page", URLCount: 12}}},
+		{"page in the path", paginatedURLs("/blog/page/%d/", 2, 13), []paginationConvention{{Key: "/page/", InPath: true, URLCount: 12}}},
+		{"offset parameter", paginatedURLs("/search?q=shoes&start=%d0", 0, 11), []paginationConvention{{Key: "start", Step: 10, URLCount: 12}}},
+		{"too few URLs", paginatedURLs("/shop?page=%d", 1, 9), nil},
+		{"product IDs", paginatedURLs("/product?p=%d", 1000, 1011), nil},
+		{"same page", paginatedURLs("/shop?page=1&id=%d", 1, 12), nil},
+		{"offset step 1", paginatedURLs("/shop?offset=%d", 0, 11), nil},
+		{"not numeric", append(paginatedURLs("/shop?page=%d", 1, 10), paginatedURLs("/shop?page=all&id=%d", 1, 2)...), nil},
+	}
+
+	for _, test := range tests {
+		got := detectPagination(test.urls)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s. detectPagination() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPageNumber(t *testing.T) {
+
+	conventions := []paginationConvention{{Key: "/page/", InPath: true}, {Key: "start", Step: 20}, {Key: "page"}}
+
+	tests := []struct {
+		url   string
+		want  int
+		found bool
+	}{
+		{"https://www.example.com/blog/page/3/", 3, true},
+		{"https://www.example.com/blog/page/0", 1, true},
+		{"https://www.example.com/search?start=0", 1, true},
+		{"https://www.example.com/search?start=40", 3, true},
+		{"https://www.example.com/search?start=59", 3, true},
+		{"https://www.example.com/shop?sort=asc&page=7", 7, true},
+		{"https://www.example.com/shop?page=-1", 0, false},
+		{"https://www.example.com/shop?Page=2", 0, false},
+		{"https://www.example.com/page/about", 0, false},
+	}
+
+	for _, test := range tests {
+		if got, found := pageNumber(test.url, conventions); got != test.want || found != test.found {
+			t.Errorf("pageNumber(%s) = %d, %t, want %d, %t", test.url, got, found, test.want, test.found)
+		}
+	}
+}
+
+func TestPaginationRule(t *testing.T) {
+
+	tests := []struct {
+		convention paginationConvention
+		first      int
+		last       int
+		want       string
+	}{
+		{paginationConvention{Key: "page"}, 1, 1, "query rx:(^|&)page=[0-1](&|$)"},
+		{paginationConvention{Key: "page_number"}, 2, 5, "query rx:(^|&)page_number=[2-5](&|$)"},
+		{paginationConvention{Key: "/page-", InPath: true}, 6, 20, `path rx:/page-([6-9]|1\d|20)/?$`},
+		{paginationConvention{Key: "start", Step: 20}, 1, 1, `query rx:(^|&)start=(\d|1\d)(&|$)`},
+		{paginationConvention{Key: "start", Step: 20}, 21, -1, `query rx:(^|&)start=([4-9]\d{2}|[1-9]\d{3,})(&|$)`},
+	}
+
+	for _, test := range tests {
+		rule := paginationRule(test.convention, test.first, test.last)
+		if rule != test.want {
+			t.Errorf("paginationRule(%+v, %d, %d) = %s, want %s", test.convention, test.first, test.last, rule, test.want)
+		}
+		if _, err := segment.CompileReader(strings.NewReader("[segment:sl_pagination]\n@Page\n" + rule + "\n")); err != nil {
+			t.Errorf("paginationRule(%+v, %d, %d) = %s, does not compile: %v", test.convention, test.first, test.last, rule, err)
+		}
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+
+	day := func(date string, hour int) time.Time {
+		parsed, err := time.ParseInLocation(historyDateFormat, date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Add(time.Duration(hour) * time.Hour)
+	}
+	run := runRecord{Organisation: "Test-Org", Project: "Main-Project", Status: "success", Started: day("2026-03-10", 23), Owner: "alice"}
+
+	tests := []struct {
+		name   string
+		filter historyFilter
+		want   bool
+	}{
+		{"no filter", historyFilter{}, true},
+		{"partial organisation", historyFilter{Organisation: "test"}, true},
+		{"organisation case", historyFilter{Organisation: "TEST-ORG"}, true},
+		{"other organisation", historyFilter{Organisation: "other"}, false},
+		{"partial project", historyFilter{Project: "main"}, true},
+		{"other project", historyFilter{Project: "staging"}, false},
+		{"status", historyFilter{Status: "success"}, true},
+		{"other status", historyFilter{Status: "error"}, false},
+		{"status case", historyFilter{Status: "Success"}, false},
+		{"from the same day", historyFilter{From: day("2026-03-10", 0)}, true},
+		{"from the next day", historyFilter{From: day("2026-03-11", 0)}, false},
+		{"to the same day", historyFilter{To: day("2026-03-10", 0)}, true},
+		{"to the day before", historyFilter{To: day("2026-03-09", 0)}, false},
+		{"from & to", historyFilter{From: day("2026-03-01", 0), To: day("2026-03-31", 0)}, true},
+		{"all filters", historyFilter{Organisation: "org", Project: "project", Status: "success", From: day("2026-03-10", 0), To: day("2026-03-10", 0)}, true},
+		{"user ignored without authentication", historyFilter{User: "bob"}, true},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.matches(run); got != test.want {
+			t.Errorf("%s. matches(%+v) = %t, want %t", test.name, test.filter, got, test.want)
+		}
+	}
+}
+
+func TestHistoryFilterUsers(t *testing.T) {
+
+	htpasswdFile := filepath.Join(t.TempDir(), "htpasswd")
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist")
+	if err := os.WriteFile(htpasswdFile, []byte("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(allowlistFile, []byte("alice: test-org\nbob: other-org\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	useAuthenticator(t, auth.Config{Mode: auth.ModeHtpasswd, HtpasswdFile: htpasswdFile, AllowlistFile: allowlistFile})
+
+	tests := []struct {
+		name string
+		user string
+		run  runRecord
+		want bool
+	}{
+		{"own run", "alice", runRecord{Organisation: "test-org", Owner: "alice"}, true},
+		{"own run, organisation no longer listed", "bob", runRecord{Organisation: "test-org", Owner: "bob"}, true},
+		{"listed organisation", "alice", runRecord{Organisation: "test-org", Owner: "bob"}, true},
+		{"organisation not listed", "bob", runRecord{Organisation: "test-org", Owner: "alice"}, false},
+		{"run without owner", "bob", runRecord{Organisation: "test-org"}, false},
+		{"not logged in", "", runRecord{Organisation: "test-org", Owner: "alice"}, false},
+	}
+
+	for _, test := range tests {
+		if got := (historyFilter{User: test.user}).matches(test.run); got != test.want {
+			t.Errorf("%s. matches(%+v) for %s = %t, want %t", test.name, test.run, test.user, got, test.want)
+		}
+	}
+}
+
+func TestGetHistoryFilter(t *testing.T) {
+
+	tests := []struct {
+		query string
+		want  historyFilter
+	}{
+		{"", historyFilter{}},
+		{"organization=+Test-Org+&project=%20main&status=success", historyFilter{Organisation: "Test-Org", Project: "main", Status: "success"}},
+		{"from=2026-03-01&to=2026-03-31", historyFilter{
+			From: time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2026, 3, 31, 0, 0, 0, 0, time.Local),
+		}},
+		{"from=01/03/2026&to=yesterday", historyFilter{}},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/admin?"+test.query, nil)
+		got := getHistoryFilter(request)
+		if got.Organisation != test.want.Organisation || got.Project != test.want.Project || got.Status != test.want.Status ||
+			!got.From.Equal(test.want.From) || !got.To.Equal(test.want.To) {
+			t.Errorf("getHistoryFilter(%s) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+
+	newTestSession(t, "", "")
+
+	started := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	recordRun(runRecord{SessionID: "1", Organisation: "test-org", Status: "success", Started: started})
+	recordRun(runRecord{SessionID: "2", Organisation: "test-org", Status: "error", Started: started.Add(time.Hour)})
+	recordRun(runRecord{SessionID: "3", Organisation: "other-org", Status: "success", Started: started.Add(-time.Hour)})
+
+	// Invalid lines are ignored
+	file, err := os.OpenFile(filepath.Join(envSegmentifyLiteLogFolder, historyFile), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("not json\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	recordRun(runRecord{SessionID: "4", Organisation: "test-org", Status: "success", Started: started.Add(2 * time.Hour)})
+
+	tests := []struct {
+		filter historyFilter
+		want   []string
+	}{
+		{historyFilter{}, []string{"4", "2", "1", "3"}},
+		{historyFilter{Organisation: "test"}, []string{"4", "2", "1"}},
+		{historyFilter{Status: "success"}, []string{"4", "1", "3"}},
+		{historyFilter{Organisation: "missing"}, nil},
+	}
+
+	for _, test := range tests {
+		runs, err := readHistory(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, run := range runs {
+			got = append(got, run.SessionID)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("readHistory(%+v) = %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestHreflangURLRule(t *testing.T) {
+
+	tests := []struct {
+		ruleURL string
+		url     string
+		want    bool
+	}{
+		{"https://www.example.com/en/item-1", "https://www.example.com/en/item-1", true},
+		{"https://www.example.com/en/item-1", "https://www.example.com/en/item-10", false},
+		{"https://www.example.com/en/item-1", "https://www.example.com/de/https://www.example.com/en/item-1", false},
+		{"https://www.example.com/en/*", "https://www.example.com/en/*", true},
+		{"https://www.example.com/en/*", "https://www.example.com/en/item-1", false},
+		{"https://www.example.com/search?q=a+b", "https://www.example.com/search?q=a+b", true},
+		{"https://www.example.com/search?q=a+b", "https://www.example.com/search?q=aab", false},
+		{"https://www.example.com/en.html", "https://www.example.com/en-html", false},
+	}
+
+	for _, test := range tests {
+		rule := hreflangURLRule(test.ruleURL)
+		classifier, err := segment.CompileReader(strings.NewReader("[segment:sl_hreflang]\n@hreflang/partial\n" + rule + "\n"))
+		if err != nil {
+			t.Fatalf("hreflangURLRule(%s) = %s, does not compile: %v", test.ruleURL, rule, err)
+		}
+		if _, got := classifier.ClassifySegment(test.url, 0); got != test.want {
+			t.Errorf("hreflangURLRule(%s) = %s, matches %s: %t, want %t", test.ruleURL, rule, test.url, got, test.want)
+		}
+	}
+}
+
+func TestURLHygieneChecks(t *testing.T) {
+
+	defer func(lengths []int) { urlLengths = lengths }(urlLengths)
+	urlLengths = []int{45, 60}
+
+	checks, err := urlHygieneChecks()
+	if err != nil {
+		t.Fatalf("urlHygieneChecks() = %v, want no error", err)
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://www.example.com/shop", nil},
+		{"http://www.example.com/shop", []string{"HTTP"}},
+		{"https://www.example.com/shop//shoes", []string{"Double_slash"}},
+		{"https://www.example.com/shop?next=//cdn", nil},
+		{"https://www.example.com/summer%20sale", []string{"Encoded"}},
+		{"https://www.example.com/café", []string{"Non_ASCII"}},
+		{"https://www.example.com/Shop", []string{"Uppercase"}},
+		{"https://www.example.com/shop?Sort=Asc", nil},
+		{"https://www.example.com/a%2Fb", []string{"Encoded"}},
+		{"https://www.example.com/A%2fb", []string{"Encoded", "Uppercase"}},
+		{"https://www.example.com/shop/shoes/trainers/running", []string{"Longer_than_45"}},
+		{"https://www.example.com/shop/shoes/trainers/running/lightweight", []string{"Longer_than_60", "Longer_than_45"}},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, check := range checks {
+			if check.re.MatchString(check.value(test.url)) {
+				got = append(got, check.Label)
+			}
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s. Issues found %v, want %v", test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// segmentifyLite. Static assets & session outputs served by the web server. Organisation & project name validation
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Folder containing the static assets (index.html, batch.html). Can be changed in segmentifyLite.ini (staticFolder)
+var staticFolder = "static"
+
+// No. of random bytes in the session ID. Session outputs are only reachable using the session ID
+var sessionIDLength = 16
+
+// Organisation & project names (Botify slugs)
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// validateName checks an organisation or project name. The name is used in the API URLs
+func validateName(nameType string, name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid %s name: %q. Only letters, digits, '.', '_' and '-' can be used", nameType, name)
+	}
+	return nil
+}
+
+// sessionURL returns the URL of a file generated in a session cache folder
+func sessionURL(sessionID string, fileName string) string {
+	return "/sessions/" + sessionID + "/" + fileName
+}
+
+// sessionFileHandler handles GET /sessions/{sessionID}/{file}. Serves the files generated in a session cache folder
+// Sub folders, hidden files and directory listings are not served
+func sessionFileHandler(w http.ResponseWriter, r *http.Request) {
+
+	fileName := r.PathValue("file")
+	if fileName == "" || fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	folder, err := sessionFolder(r.PathValue("sessionID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The owner of the session, or anyone holding the share link
+	if !authorizeSession(w, r, r.PathValue("sessionID"), folder) {
+		return
+	}
+
+	file, err := os.Open(filepath.Join(folder, fileName))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("sessionFileHandler. Closing", "error", err)
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, fileName, info.ModTime(), file)
+}
+
+// staticHandler serves the static assets. The folder is listed in segmentifyLite.ini, directory listings are not served
+func staticHandler() http.Handler {
+	fileServer := http.FileServer(http.Dir(staticFolder))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// sessionFolder returns the cache folder of a session
+func sessionFolder(sessionID string) (string, error) {
+
+	if !validSessionID.MatchString(sessionID) {
+		return "", errors.New("invalid session ID")
+	}
+
+	folder := filepath.Join(envSegmentifyLiteFolder, sessionID)
+	if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+		return "", errors.New("session not found")
+	}
+
+	return folder, nil
+}
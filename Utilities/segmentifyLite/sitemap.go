@@ -0,0 +1,506 @@
+// segmentifyLite. Sitemap coverage. Compares the URLs listed in the XML sitemaps with the crawled URLs, for each segment label
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"goquery/segment"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name of the sitemap coverage report
+var sitemapCoverageFile = "go_seo_sitemapCoverage.html"
+
+// Local mirror of the sitemaps. The sitemap URLs are fetched from the mirror, never from the live site
+// e.g. http://localhost:8090 serves https://www.example.com/sitemap.xml from http://localhost:8090/sitemap.xml
+// Can be set in segmentifyLite.ini (sitemapMirrorURL). When empty only the uploaded sitemaps are used
+var sitemapMirrorURL = ""
+
+// HTTP client used to fetch the sitemaps from the mirror
+var sitemapClient = &http.Client{Timeout: 30 * time.Second}
+
+// Limits. The sitemaps protocol allows 50,000 URLs and 50MB (uncompressed) per file
+var maxSitemapFiles = 500
+var maxSitemapSize int64 = 50 << 20
+var maxSitemapURLs = 2000000
+
+// Labels with a lower share of their crawled URLs in the sitemaps are flagged as under-represented
+var sitemapCoverageWarning = 50.0
+
+// No. of example URLs listed in the report
+var maxSitemapExamples = 10
+
+// Sitemaps supplied for the session. Either uploaded (Content) or fetched from the mirror (URL)
+var sitemapSources []sitemapSource
+
+// sitemapSource is a sitemap file, or sitemap index
+type sitemapSource struct {
+	Name    string
+	URL     string
+	Content []byte
+}
+
+// sitemapLoad summarises the sitemaps read
+type sitemapLoad struct {
+	Files       int
+	Indexes     int
+	NotFollowed []string // Child sitemaps listed in an uploaded index which cannot be fetched (no mirror)
+	Errors      []string
+}
+
+// labelCoverage is the sitemap coverage of a segment label
+type labelCoverage struct {
+	Label      string
+	Crawled    int
+	InSitemaps int
+	NotCrawled int
+}
+
+// segmentCoverage is the sitemap coverage of each label of a segment
+type segmentCoverage struct {
+	Name   string
+	Labels []labelCoverage
+}
+
+// getSitemaps reads the sitemaps uploaded in the sitemapFiles form field, and the sitemap URLs entered in the sitemapURLs field (one per line)
+func getSitemaps(r *http.Request) ([]sitemapSource, error) {
+
+	var sources []sitemapSource
+
+	if r.MultipartForm != nil {
+		for _, header := range r.MultipartForm.File["sitemapFiles"] {
+			file, err := header.Open()
+			if err != nil {
+				return nil, fmt.Errorf("cannot read the sitemap %s: %w", header.Filename, err)
+			}
+			content, err := io.ReadAll(io.LimitReader(file, maxSitemapSize))
+			if err := file.Close(); err != nil {
+				logger.Error("getSitemaps. Closing", "error", err)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot read the sitemap %s: %w", header.Filename, err)
+			}
+			sources = append(sources, sitemapSource{Name: header.Filename, Content: content})
+		}
+	}
+
+	urlSources, err := sitemapURLSources(strings.Split(r.Form.Get("sitemapURLs"), "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sources, urlSources...), nil
+}
+
+// sitemapURLSources validates the sitemap URLs. The URLs are fetched from the mirror, which must be configured
+func sitemapURLSources(sitemapURLs []string) ([]sitemapSource, error) {
+
+	var sources []sitemapSource
+	for _, sitemapURL := range sitemapURLs {
+		sitemapURL = strings.TrimSpace(sitemapURL)
+		if sitemapURL == "" {
+			continue
+		}
+		if sitemapMirrorURL == "" {
+			return nil, errors.New("sitemap URLs can only be used when sitemapMirrorURL is set in segmentifyLite.ini. Upload the sitemap files instead")
+		}
+		if _, err := mirrorURL(sitemapURL); err != nil {
+			return nil, err
+		}
+		sources = append(sources, sitemapSource{Name: sitemapURL, URL: sitemapURL})
+	}
+
+	return sources, nil
+}
+
+// mirrorURL returns the location of a sitemap in the local mirror. The scheme and host name are replaced by the mirror URL
+func mirrorURL(sitemapURL string) (string, error) {
+
+	parsedURL, err := url.Parse(sitemapURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return "", fmt.Errorf("invalid sitemap URL: %q", sitemapURL)
+	}
+
+	mirrored := strings.TrimSuffix(sitemapMirrorURL, "/") + parsedURL.EscapedPath()
+	if parsedURL.RawQuery != "" {
+		mirrored += "?" + parsedURL.RawQuery
+	}
+
+	return mirrored, nil
+}
+
+// fetchSitemap reads a sitemap from the mirror
+func fetchSitemap(sitemapURL string) ([]byte, error) {
+
+	location, err := mirrorURL(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sitemapClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("fetchSitemap. Closing", "error", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", res.Status, location)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, maxSitemapSize))
+}
+
+// loadSitemaps returns the URLs listed in the sitemaps. The sitemap indexes are followed using the mirror
+// A sitemap which cannot be read is listed in the errors, the other sitemaps are still used
+func loadSitemaps(sources []sitemapSource) (map[string]bool, sitemapLoad) {
+
+	sitemapURLs := make(map[string]bool)
+	var load sitemapLoad
+
+	visited := make(map[string]bool)
+	queue := append([]sitemapSource{}, sources...)
+	for len(queue) > 0 && load.Files < maxSitemapFiles {
+		source := queue[0]
+		queue = queue[1:]
+
+		if source.URL != "" {
+			if visited[source.URL] {
+				continue
+			}
+			visited[source.URL] = true
+		}
+
+		content := source.Content
+		if content == nil {
+			var err error
+			if content, err = fetchSitemap(source.URL); err != nil {
+				load.Errors = append(load.Errors, fmt.Sprintf("%s: %v", source.Name, err))
+				continue
+			}
+		}
+
+		urls, children, err := parseSitemap(content)
+		if err != nil {
+			load.Errors = append(load.Errors, fmt.Sprintf("%s: %v", source.Name, err))
+			continue
+		}
+
+		load.Files++
+		if len(children) > 0 {
+			load.Indexes++
+		}
+		for _, sitemapURL := range urls {
+			if len(sitemapURLs) >= maxSitemapURLs {
+				break
+			}
+			sitemapURLs[sitemapURL] = true
+		}
+		for _, child := range children {
+			if sitemapMirrorURL == "" {
+				load.NotFollowed = append(load.NotFollowed, child)
+				continue
+			}
+			queue = append(queue, sitemapSource{Name: child, URL: child})
+		}
+	}
+
+	if len(queue) > 0 {
+		load.Errors = append(load.Errors, fmt.Sprintf("%d sitemaps not read, the limit of %d files has been reached", len(queue), maxSitemapFiles))
+	}
+
+	return sitemapURLs, load
+}
+
+// parseSitemap returns the URLs listed in a sitemap, and the child sitemaps listed in a sitemap index
+// XML sitemaps, sitemap indexes and text sitemaps (one URL per line) are supported. The files can be gzipped
+func parseSitemap(content []byte) (urls []string, children []string, err error) {
+
+	// Gzip magic number
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip file: %w", err)
+		}
+		content, err = io.ReadAll(io.LimitReader(reader, maxSitemapSize))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip file: %w", err)
+		}
+	}
+
+	// Text sitemap
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("<")) {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				urls = append(urls, line)
+			}
+		}
+		return urls, nil, scanner.Err()
+	}
+
+	// <urlset><url><loc> or <sitemapindex><sitemap><loc>. Namespaces are ignored
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	parent := ""
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch element.Name.Local {
+		case "url", "sitemap":
+			parent = element.Name.Local
+		case "loc":
+			var loc string
+			if err := decoder.DecodeElement(&loc, &element); err != nil {
+				return nil, nil, fmt.Errorf("invalid XML: %w", err)
+			}
+			loc = strings.TrimSpace(loc)
+			if loc == "" {
+				continue
+			}
+			if parent == "sitemap" {
+				children = append(children, loc)
+			} else if parent == "url" {
+				urls = append(urls, loc)
+			}
+		}
+	}
+
+	return urls, children, nil
+}
+
+// Generate the sitemap coverage report. Only generated when sitemaps are supplied
+// The sitemaps listed in the robots.txt are used when the mirror is configured
+func sitemapCoverageReport() error {
+
+	sources := sitemapSources
+	if existingRobots != nil && sitemapMirrorURL != "" {
+		for _, sitemapURL := range existingRobots.Sitemaps {
+			if _, err := mirrorURL(sitemapURL); err == nil {
+				sources = append(sources, sitemapSource{Name: sitemapURL, URL: sitemapURL})
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	crawledURLs, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("sitemapCoverageReport. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	sitemapURLs, load := loadSitemaps(sources)
+	coverage, missingExamples, notCrawledExamples := sitemapCoverage(sessionSegments, crawledURLs, sitemapURLs)
+
+	return generateSitemapCoverageHTML(coverage, load, len(crawledURLs), len(sitemapURLs), missingExamples, notCrawledExamples)
+}
+
+// sitemapCoverage counts, for each segment label, the crawled URLs found in the sitemaps and the sitemap URLs not crawled
+// The URLs not crawled are classified using the same segments. URLs without a label are counted as "(no label)"
+func sitemapCoverage(classifier *segment.Classifier, crawledURLs []string, sitemapURLs map[string]bool) (coverage []segmentCoverage, missingExamples []string, notCrawledExamples []string) {
+
+	segments := classifier.Segments()
+	counts := make([]map[string]*labelCoverage, len(segments))
+	for i, seg := range segments {
+		counts[i] = make(map[string]*labelCoverage)
+		for _, label := range seg.Labels {
+			counts[i][label.Name] = &labelCoverage{Label: label.Name}
+		}
+		counts[i][""] = &labelCoverage{Label: "(no label)"}
+	}
+
+	// The crawl extract can list a URL more than once
+	crawled := make(map[string]bool, len(crawledURLs))
+	for _, crawledURL := range crawledURLs {
+		if crawled[crawledURL] {
+			continue
+		}
+		crawled[crawledURL] = true
+
+		inSitemaps := sitemapURLs[crawledURL]
+		if !inSitemaps && len(missingExamples) < maxSitemapExamples {
+			missingExamples = append(missingExamples, crawledURL)
+		}
+		for i := range segments {
+			label, _ := classifier.ClassifySegment(crawledURL, i)
+			count := counts[i][label]
+			count.Crawled++
+			if inSitemaps {
+				count.InSitemaps++
+			}
+		}
+	}
+
+	// Sitemap URLs never crawled. Sorted so the examples are always the same
+	var notCrawledURLs []string
+	for sitemapURL := range sitemapURLs {
+		if !crawled[sitemapURL] {
+			notCrawledURLs = append(notCrawledURLs, sitemapURL)
+		}
+	}
+	sort.Strings(notCrawledURLs)
+	for _, sitemapURL := range notCrawledURLs {
+		if len(notCrawledExamples) < maxSitemapExamples {
+			notCrawledExamples = append(notCrawledExamples, sitemapURL)
+		}
+		for i := range segments {
+			label, _ := classifier.ClassifySegment(sitemapURL, i)
+			counts[i][label].NotCrawled++
+		}
+	}
+
+	// Labels in the segment order, the URLs without a label last
+	for i, seg := range segments {
+		segmentCounts := segmentCoverage{Name: seg.Name}
+		for _, label := range seg.Labels {
+			segmentCounts.Labels = append(segmentCounts.Labels, *counts[i][label.Name])
+		}
+		if noLabel := counts[i][""]; noLabel.Crawled > 0 || noLabel.NotCrawled > 0 {
+			segmentCounts.Labels = append(segmentCounts.Labels, *noLabel)
+		}
+		coverage = append(coverage, segmentCounts)
+	}
+
+	return coverage, missingExamples, notCrawledExamples
+}
+
+// Generate the sitemap coverage report page
+func generateSitemapCoverageHTML(coverage []segmentCoverage, load sitemapLoad, crawledCount int, sitemapCount int, missingExamples []string, notCrawledExamples []string) error {
+
+	var content strings.Builder
+
+	totalInSitemaps := 0
+	totalNotCrawled := 0
+	totalCrawled := 0
+	if len(coverage) > 0 {
+		for _, label := range coverage[0].Labels {
+			totalCrawled += label.Crawled
+			totalInSitemaps += label.InSitemaps
+			totalNotCrawled += label.NotCrawled
+		}
+	}
+
+	content.WriteString(fmt.Sprintf("<p>%d sitemap files read (%d sitemap indexes). %d URLs found in the sitemaps.</p>\n", load.Files, load.Indexes, sitemapCount))
+	content.WriteString(fmt.Sprintf("<p>Crawled URLs in the sitemaps: %d of %d (%.1f%%). Crawled URLs missing from the sitemaps: %d. Sitemap URLs not crawled: %d.</p>\n",
+		totalInSitemaps, totalCrawled, percentage(totalInSitemaps, totalCrawled), totalCrawled-totalInSitemaps, totalNotCrawled))
+	content.WriteString(fmt.Sprintf("<p>Labels with less than %.0f%% of their crawled URLs in the sitemaps are <span style='color: red;'>under-represented</span>.</p>\n", sitemapCoverageWarning))
+
+	if len(load.Errors) > 0 || len(load.NotFollowed) > 0 {
+		content.WriteString("<h2>Sitemaps not read</h2>\n<ul>\n")
+		for _, loadError := range load.Errors {
+			content.WriteString("<li>" + html.EscapeString(loadError) + "</li>\n")
+		}
+		for _, child := range load.NotFollowed {
+			content.WriteString("<li>" + html.EscapeString(child) + ": listed in a sitemap index. Upload the file, or set sitemapMirrorURL in segmentifyLite.ini</li>\n")
+		}
+		content.WriteString("</ul>\n")
+	}
+
+	for _, segmentCounts := range coverage {
+		content.WriteString(fmt.Sprintf("<h2>%s</h2>\n", html.EscapeString(segmentCounts.Name)))
+		content.WriteString("<table>\n<tr><th>Label</th><th>Crawled URLs</th><th>In sitemaps</th><th>Missing from sitemaps</th><th>Sitemap URLs not crawled</th></tr>\n")
+		for _, label := range segmentCounts.Labels {
+			if label.Crawled == 0 && label.NotCrawled == 0 {
+				continue
+			}
+			coverageStyle := ""
+			if label.Crawled > 0 && percentage(label.InSitemaps, label.Crawled) < sitemapCoverageWarning {
+				coverageStyle = " style='color: red;'"
+			}
+			content.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%d</td><td%s>%d (%.1f%%)</td><td>%d</td><td>%d</td></tr>\n",
+				html.EscapeString(label.Label), label.Crawled, coverageStyle, label.InSitemaps, percentage(label.InSitemaps, label.Crawled), label.Crawled-label.InSitemaps, label.NotCrawled))
+		}
+		content.WriteString("</table>\n")
+	}
+
+	content.WriteString("<h2>Examples</h2>\n")
+	content.WriteString("<table>\n<tr><th>Crawled URLs missing from the sitemaps</th><th>Sitemap URLs not crawled</th></tr>\n")
+	content.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>\n</table>\n", examplesHTML(missingExamples), examplesHTML(notCrawledExamples)))
+
+	htmlContent := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>segmentifyLite</title>
+    <style>
+        body {
+            margin: 0;
+            font-family: Arial, sans-serif;
+            background-color: Cornsilk;
+        }
+        .banner {
+            background-color: DeepSkyBlue;
+            color: white;
+            text-align: center;
+            padding: 15px 0;
+            font-size: 24px;
+        }
+        .report {
+            margin: 30px auto;
+            width: 90%%;
+            color: DimGray;
+        }
+        h2 {
+            color: DeepSkyBlue;
+        }
+        table {
+            width: 100%%;
+            border-collapse: collapse;
+            background-color: white;
+            font-size: 14px;
+        }
+        th, td {
+            padding: 8px;
+            border-bottom: 1px solid #ddd;
+            text-align: left;
+            vertical-align: top;
+            word-break: break-all;
+        }
+        th {
+            background-color: DeepSkyBlue;
+            color: white;
+        }
+    </style>
+</head>
+<body>
+<header class="banner">
+    <span>Go_Seo</span><br>
+    <span style="font-size: 20px;">segmentifyLite. Sitemap coverage</span>
+</header>
+<div class="report">
+    <p>Organisation: %s, Project: %s. Based on a sample of %d URLs.</p>
+%s</div>
+</body>
+</html>`, html.EscapeString(organisation), html.EscapeString(project), crawledCount, content.String())
+
+	return saveHTML(htmlContent, "/"+sitemapCoverageFile)
+}
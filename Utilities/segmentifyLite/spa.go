@@ -0,0 +1,258 @@
+// segmentifyLite. Single page applications. Detect the fragment routes (#!, /#/, _escaped_fragment_) & the framework build artefacts
+// Generates the sl_spa_routes & sl_build_artefacts segments
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Minimum number of URLs using fragment routes for the sl_spa_routes segment to be generated. Also the minimum size of a route label
+var minSPARouteURLs = 10
+
+// Maximum number of route labels. The smaller routes are included in Route/Other
+var maxSPARouteLabels = 30
+
+// spaConvention is a way of specifying the route in the URL
+type spaConvention struct {
+	Name        string
+	Description string
+	ruleFormat  string // %s is replaced by the route folder
+	rootRule    string // Matches the root route
+	anyRule     string // Matches all the routes using the convention
+}
+
+// Evaluated in this order. A URL is assigned to the first convention found
+var spaConventions = []spaConvention{
+	{"hashbang", "Hashbang routes (#!/route)", `url rx:#!/?%s([/?]|$)`, `url rx:#!/?(\?|$)`, `url rx:#!`},
+	{"hash", "Hash routes (/#/route)", `url rx:#/%s([/?]|$)`, `url rx:#/(\?|$)`, `url rx:#/`},
+	{"escapedFragment", "Escaped fragment routes (?_escaped_fragment_=/route)", `query rx:(^|&)_escaped_fragment_=(/|%%2F)?%s(/|%%2F|&|$)`, `query rx:(^|&)_escaped_fragment_=(/|%2F)?(&|$)`, `query rx:(^|&)_escaped_fragment_=`},
+}
+
+// buildArtefact identifies the files generated by a JavaScript framework or bundler. The regex is matched against the path
+type buildArtefact struct {
+	Label string
+	Regex *regexp.Regexp
+}
+
+// Evaluated in this order. A URL is assigned to the first artefact found
+var buildArtefacts = []buildArtefact{
+	{"Next.js", regexp.MustCompile(`^/_next/`)},
+	{"Nuxt", regexp.MustCompile(`^/_nuxt/`)},
+	{"Gatsby", regexp.MustCompile(`^/page-data/`)},
+	{"SvelteKit", regexp.MustCompile(`^/_app/immutable/`)},
+	{"Create_React_App", regexp.MustCompile(`^/static/(js|css|media)/`)},
+	{"Angular", regexp.MustCompile(`/(main|polyfills|runtime|vendor|styles|scripts)(-es20\d\d)?\.[0-9a-f]{16,20}\.(js|css)$`)},
+	{"Webpack_chunks", regexp.MustCompile(`\.chunk\.(js|css)$`)},
+	{"Source_maps", regexp.MustCompile(`\.(js|css)\.map$`)},
+	{"Hashed_bundles", regexp.MustCompile(`[.-][0-9a-f]{8,}\.(js|mjs|css)$`)},
+}
+
+// Generate the sl_spa_routes segment. The fragment routes are normalised to paths, each route folder with enough URLs is a label
+func spaRoutesSegment() error {
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("spaRoutesSegment. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	conventionCounts := make(map[string]int)
+	routeCounts := make(map[string]int)
+	rootCount := 0
+	routeURLs := 0
+	for _, url := range urls {
+		route, convention, found := spaRoute(url)
+		if !found {
+			continue
+		}
+		routeURLs++
+		conventionCounts[convention.Name]++
+		folder := routeFolder(route)
+		if folder == "" {
+			rootCount++
+			continue
+		}
+		routeCounts[folder]++
+	}
+
+	if routeURLs < minSPARouteURLs {
+		if err := insertStaticRegex("\n\n# No SPA routes found, segment sl_spa_routes not generated\n"); err != nil {
+			logger.Error("spaRoutesSegment. Cannot write to the output file", "error", err)
+			return err
+		}
+		return nil
+	}
+
+	// Conventions used in the URLs
+	var conventions []spaConvention
+	for _, convention := range spaConventions {
+		if conventionCounts[convention.Name] > 0 {
+			conventions = append(conventions, convention)
+		}
+	}
+
+	// Largest routes first
+	var routes []FolderCount
+	for folder, count := range routeCounts {
+		if count >= minSPARouteURLs {
+			routes = append(routes, FolderCount{folder, count})
+		}
+	}
+	sort.Sort(ByCount(routes))
+	if len(routes) > maxSPARouteLabels {
+		routes = routes[:maxSPARouteLabels]
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\n\n[segment:sl_spa_routes]\n")
+	if rootCount > 0 {
+		builder.WriteString("@Route/Root\nor (\n")
+		for _, convention := range conventions {
+			builder.WriteString(convention.rootRule + "\n")
+		}
+		builder.WriteString(")\n\n")
+	}
+	for _, route := range routes {
+		builder.WriteString("@Route/" + sanitiseLabel(route.Text) + "\nor (\n")
+		for _, convention := range conventions {
+			builder.WriteString(fmt.Sprintf(convention.ruleFormat, regexp.QuoteMeta(route.Text)) + "\n")
+		}
+		builder.WriteString(")\n\n")
+	}
+	builder.WriteString("@Route/Other\nor (\n")
+	for _, convention := range conventions {
+		builder.WriteString(convention.anyRule + "\n")
+	}
+	builder.WriteString(")\n\n@~Server_routes\npath /*\n\n# ----End of sl_spa_routes----\n")
+
+	builder.WriteString("# ----SPA routes analysis----\n")
+	for _, convention := range conventions {
+		builder.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", convention.Description, conventionCounts[convention.Name]))
+	}
+	builder.WriteString(fmt.Sprintf("# --Root route (URLs found: %d)\n", rootCount))
+	for _, route := range routes {
+		builder.WriteString(fmt.Sprintf("# --/%s (URLs found: %d)\n", route.Text, route.Count))
+	}
+	builder.WriteString(fmt.Sprintf("# --Routes not listed: %d\n", len(routeCounts)-len(routes)))
+
+	if err := insertStaticRegex(builder.String()); err != nil {
+		logger.Error("spaRoutesSegment. Cannot write to the output file", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Generate the sl_build_artefacts segment. Separates the files generated by the frameworks & bundlers from the content
+func buildArtefactsSegment() error {
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("buildArtefactsSegment. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	artefactCounts := make([]int, len(buildArtefacts))
+	artefactURLs := 0
+	for _, url := range urls {
+		if index, found := buildArtefactIndex(url); found {
+			artefactCounts[index]++
+			artefactURLs++
+		}
+	}
+
+	if artefactURLs == 0 {
+		if err := insertStaticRegex("\n\n# No build artefacts found, segment sl_build_artefacts not generated\n"); err != nil {
+			logger.Error("buildArtefactsSegment. Cannot write to the output file", "error", err)
+			return err
+		}
+		return nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\n\n[segment:sl_build_artefacts]\n")
+	for i, artefact := range buildArtefacts {
+		if artefactCounts[i] > 0 {
+			builder.WriteString(fmt.Sprintf("@Artefact/%s\npath rx:%s\n\n", artefact.Label, artefact.Regex.String()))
+		}
+	}
+	builder.WriteString("@~Content\npath /*\n\n# ----End of sl_build_artefacts----\n")
+
+	builder.WriteString("# ----Build artefacts analysis----\n")
+	for i, artefact := range buildArtefacts {
+		if artefactCounts[i] > 0 {
+			builder.WriteString(fmt.Sprintf("# --%s (URLs found: %d)\n", artefact.Label, artefactCounts[i]))
+		}
+	}
+	builder.WriteString(fmt.Sprintf("# --Content (URLs found: %d)\n", len(urls)-artefactURLs))
+
+	if err := insertStaticRegex(builder.String()); err != nil {
+		logger.Error("buildArtefactsSegment. Cannot write to the output file", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// spaRoute returns the route of a URL using a fragment route, normalised to a path (e.g. /products/123 for https://www.site.com/#!/products/123)
+func spaRoute(rawURL string) (string, spaConvention, bool) {
+
+	if _, fragment, found := strings.Cut(rawURL, "#"); found {
+		if route, found := strings.CutPrefix(fragment, "!"); found {
+			return normaliseRoute(route), spaConventions[0], true
+		}
+		if strings.HasPrefix(fragment, "/") {
+			return normaliseRoute(fragment), spaConventions[1], true
+		}
+	}
+
+	_, query, _ := strings.Cut(robotsPath(rawURL), "?")
+	for _, parameter := range strings.Split(query, "&") {
+		if value, found := strings.CutPrefix(parameter, "_escaped_fragment_="); found {
+			if decoded, err := url.QueryUnescape(value); err == nil {
+				value = decoded
+			}
+			return normaliseRoute(value), spaConventions[2], true
+		}
+	}
+
+	return "", spaConvention{}, false
+}
+
+// normaliseRoute removes the query string from a route and adds the leading slash
+func normaliseRoute(route string) string {
+	route, _, _ = strings.Cut(route, "?")
+	if !strings.HasPrefix(route, "/") {
+		route = "/" + route
+	}
+	return route
+}
+
+// routeFolder returns the first folder of a route, empty for the root route
+func routeFolder(route string) string {
+	folder, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	return folder
+}
+
+// buildArtefactIndex returns the index of the build artefact matching a URL
+func buildArtefactIndex(rawURL string) (int, bool) {
+	path, _, _ := strings.Cut(robotsPath(rawURL), "?")
+	for i, artefact := range buildArtefacts {
+		if artefact.Regex.MatchString(path) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// withoutFragment removes the fragment from a URL. Fragment routes are analysed in the sl_spa_routes segment
+func withoutFragment(rawURL string) string {
+	rawURL, _, _ = strings.Cut(rawURL, "#")
+	return rawURL
+}
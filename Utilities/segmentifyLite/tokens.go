@@ -0,0 +1,74 @@
+// segmentifyLite. Botify token of the session. The token of the server (envBotifyAPIToken) or the token of the user (see botifytoken)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"goquery/botifytoken"
+	"goquery/logging"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Where the token comes from. Set with envSegmentifyLiteTokenMode (server, user or proxy)
+// In proxy mode the secret used to sign the cookie is set with envSegmentifyLiteCookieSecret
+var tokenConfig = botifytoken.NewConfig(botifytoken.ModeServer, "", nil)
+
+// Token used for the Botify API calls of the current session. Never written to disk or to the logs
+var botifyToken string
+
+// getTokenConfig reads the token mode from the environment. Called before getEnvVariables, the server token is not required in user & proxy modes
+func getTokenConfig() {
+
+	mode, err := botifytoken.ParseMode(os.Getenv("envSegmentifyLiteTokenMode"))
+	if err != nil {
+		slog.Error("getTokenConfig. Invalid token mode. Cannot start segmentifyLite server", "error", err)
+		os.Exit(0)
+	}
+
+	tokenConfig = botifytoken.NewConfig(mode, "", []byte(os.Getenv("envSegmentifyLiteCookieSecret")))
+	slog.Info("Botify token mode", "mode", mode)
+	if mode == botifytoken.ModeProxy && len(tokenConfig.CookieSecret) == 0 {
+		slog.Warn("envSegmentifyLiteCookieSecret not set, the token is only read from the " + tokenConfig.Header + " header")
+	}
+}
+
+// startTokenSession sets the token of the session from the request. The token is redacted from the logs until endTokenSession is called
+func startTokenSession(r *http.Request) error {
+	token, err := requestToken(r)
+	if err != nil {
+		return err
+	}
+	botifyToken = token
+	return nil
+}
+
+// endTokenSession forgets the token of the user when the session is complete
+func endTokenSession() {
+	forgetToken(botifyToken)
+	botifyToken = ""
+}
+
+// requestToken returns the token of a request. The token is redacted from the logs until forgetToken is called
+// Used directly in batch mode, the token is not kept in the session globals during the downloads
+func requestToken(r *http.Request) (string, error) {
+	token, err := tokenConfig.FromRequest(r)
+	if err != nil {
+		return "", err
+	}
+	logging.Redact(token)
+	return token, nil
+}
+
+// forgetToken stops redacting the token of a user. The token of the server is always redacted
+func forgetToken(token string) {
+	if tokenConfig.PerUser() {
+		logging.Forget(token)
+	}
+}
+
+// configHandler handles GET /config. The launch screen displays the token field when the users provide their own token
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"tokenMode": tokenConfig.Mode})
+}
@@ -0,0 +1,167 @@
+// segmentifyLite. URL hygiene. Generate the sl_url_hygiene segment (protocol, host, uppercase, encoded characters, length)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Percent-encoded characters. Removed from the path by the checks ignoring them (see urlHygieneCheck.IgnoreEncoded)
+var percentEncodedRegex = regexp.MustCompile(`%[0-9A-Fa-f]{2}`)
+
+// URL lengths (No. of characters) flagged in the segment. Can be changed in segmentifyLite.ini (urlLengths)
+var urlLengths = []int{115, 200}
+
+// Longest URL length accepted in urlLengths. The length rules are regex repeat counts, limited to 1000
+var maxURLLength = 999
+
+// urlHygieneCheck is an issue flagged in the sl_url_hygiene segment
+type urlHygieneCheck struct {
+	Label         string
+	Rule          string
+	IgnoreEncoded bool // The percent-encoded characters are removed before counting the issues, e.g. %2F is not uppercase
+	re            *regexp.Regexp
+}
+
+// Generate the sl_url_hygiene segment
+// Each URL is assigned to the first issue found. As a URL can have several issues, the analysis comments count each issue separately
+func urlHygieneSegment() error {
+
+	urls, err := readURLFile(urlExtractFile)
+	if err != nil {
+		logger.Error("urlHygieneSegment. Cannot read the URLs", "error", err)
+		return err
+	}
+
+	checks, err := urlHygieneChecks()
+	if err != nil {
+		logger.Error("urlHygieneSegment. Invalid rule", "error", err)
+		return err
+	}
+
+	// Count the URLs for each issue, and the www & apex hosts
+	issueCounts := make([]int, len(checks))
+	cleanCount := 0
+	wwwCount := 0
+	apexCount := 0
+	for _, url := range urls {
+		clean := true
+		for i, check := range checks {
+			if check.re.MatchString(check.value(url)) {
+				issueCounts[i]++
+				clean = false
+			}
+		}
+		if clean {
+			cleanCount++
+		}
+		if isWWW(url) {
+			wwwCount++
+		} else {
+			apexCount++
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\n\n[segment:sl_url_hygiene]\n")
+	for _, check := range checks {
+		builder.WriteString(fmt.Sprintf("@%s\n%s\n\n", check.Label, check.Rule))
+	}
+
+	// URLs without issues are split by host
+	builder.WriteString("@Clean/WWW\nurl rx:^https?://www\\.\n\n")
+	builder.WriteString("@Clean/Apex\npath /*\n\n# ----End of sl_url_hygiene----\n")
+
+	builder.WriteString("# ----URL hygiene analysis. A URL is counted once for each issue found----\n")
+	for i, check := range checks {
+		builder.WriteString(fmt.Sprintf("# --%s (URLs found: %d, %.1f%%)\n", check.Label, issueCounts[i], percentage(issueCounts[i], len(urls))))
+	}
+	builder.WriteString(fmt.Sprintf("# --No issue found (URLs found: %d, %.1f%%)\n", cleanCount, percentage(cleanCount, len(urls))))
+	builder.WriteString(fmt.Sprintf("# --www host (URLs found: %d)\n", wwwCount))
+	builder.WriteString(fmt.Sprintf("# --Apex host (URLs found: %d)\n", apexCount))
+	if wwwCount > 0 && apexCount > 0 {
+		builder.WriteString("# --Both www and apex hosts found\n")
+	}
+
+	if err := insertStaticRegex(builder.String()); err != nil {
+		logger.Error("urlHygieneSegment. Cannot write to the output file", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// urlHygieneChecks returns the issues in the order they are evaluated in the segment
+func urlHygieneChecks() ([]urlHygieneCheck, error) {
+
+	checks := []urlHygieneCheck{
+		{Label: "HTTP", Rule: `url rx:^http://`},
+		{Label: "Double_slash", Rule: `path rx://`},
+		{Label: "Encoded", Rule: `path rx:%[0-9A-Fa-f]{2}`},
+		{Label: "Non_ASCII", Rule: `url rx:[^\x00-\x7F]`},
+		{Label: "Uppercase", Rule: `path rx:[A-Z]`, IgnoreEncoded: true},
+	}
+
+	// Longest first, so each URL is assigned to the longest length it exceeds
+	lengths := append([]int{}, urlLengths...)
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	for _, length := range lengths {
+		checks = append(checks, urlHygieneCheck{
+			Label: fmt.Sprintf("Longer_than_%d", length),
+			Rule:  fmt.Sprintf("url rx:^.{%d,}", length+1),
+		})
+	}
+
+	for i := range checks {
+		_, pattern, _ := strings.Cut(checks[i].Rule, " rx:")
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", checks[i].Label, err)
+		}
+		checks[i].re = re
+	}
+
+	return checks, nil
+}
+
+// value returns the part of the URL the check is evaluated against (url or path)
+func (check urlHygieneCheck) value(url string) string {
+	if strings.HasPrefix(check.Rule, "path ") {
+		path, _, _ := strings.Cut(robotsPath(url), "?")
+		if check.IgnoreEncoded {
+			return percentEncodedRegex.ReplaceAllString(path, "")
+		}
+		return path
+	}
+	return url
+}
+
+// isWWW reports whether the host of a URL starts with www.
+func isWWW(url string) bool {
+	if _, host, found := strings.Cut(url, "://"); found {
+		return strings.HasPrefix(strings.ToLower(host), "www.")
+	}
+	return false
+}
+
+// parseURLLengths parses a comma separated list of URL lengths, e.g. 115,200. From 1 to maxURLLength
+func parseURLLengths(lengthList string) ([]int, error) {
+	var lengths []int
+	for _, value := range strings.Split(lengthList, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 || length > maxURLLength {
+			return nil, fmt.Errorf("invalid URL length: %q", value)
+		}
+		lengths = append(lengths, length)
+	}
+	return lengths, nil
+}
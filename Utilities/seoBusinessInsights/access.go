@@ -0,0 +1,155 @@
+// seoBusinessInsights: Authentication & access control. The users log in with an htpasswd file or OIDC (see goquery/auth)
+// The broadsheets can only be viewed by the user who generated them, or by anyone holding the share link
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"fmt"
+	"goquery/auth"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Authenticates the users. Set with envInsightsAuthMode (none, htpasswd or oidc). No authentication by default
+var authenticator = &auth.Authenticator{}
+
+// User of the current broadsheet. Saved in the owner file of the broadsheet folder
+var sessionOwner string
+
+// Contains the user who generated the broadsheet. Hidden files are not served
+var ownerFile = ".owner"
+
+// Cookie set when a share link is opened. Limited to the files of the shared broadsheet
+var shareCookie = "seobusinessinsights_share"
+
+// Organisation & project names. Letters, digits, '.', '_' and '-'
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// getAuthConfig reads the authentication configuration from the environment (envInsightsAuthMode, envInsightsHtpasswd ...)
+func getAuthConfig() {
+
+	config := auth.ConfigFromEnv("envInsights")
+	config.Realm = "seoBusinessInsights"
+	config.CookieName = "seobusinessinsights_login"
+
+	var err error
+	authenticator, err = auth.New(config)
+	if err != nil {
+		slog.Error("getAuthConfig. Invalid authentication configuration. Cannot start seoBusinessInsights server", "error", err)
+		os.Exit(0)
+	}
+	slog.Info("Authentication mode", "mode", authenticator.Mode())
+}
+
+// insightsFileHandler serves the launch screen (index.html) to the users logged in, and the broadsheets (envInsightsFolder)
+// to their owner or to anyone holding the share link. Any other file (configuration, logs ...) is not found
+func insightsFileHandler() http.Handler {
+
+	cachePath := path.Clean("/" + filepath.ToSlash(envInsightsFolder))
+	fileServer := http.StripPrefix(cachePath, http.FileServer(http.Dir(envInsightsFolder)))
+	launchScreen := authenticator.RequireFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "index.html")
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path == "/" || r.URL.Path == "/index.html" {
+			launchScreen(w, r)
+			return
+		}
+
+		broadsheet, found := broadsheetFolder(r.URL.Path)
+		if !found || strings.HasPrefix(path.Base(r.URL.Path), ".") {
+			http.NotFound(w, r)
+			return
+		}
+		if !authorizeBroadsheet(w, r, broadsheet) {
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// broadsheetFolder returns the name of the broadsheet folder requested (the session ID & organisation)
+func broadsheetFolder(urlPath string) (string, bool) {
+
+	cachePath := path.Clean("/" + filepath.ToSlash(envInsightsFolder))
+	urlPath = path.Clean("/" + urlPath)
+	if !strings.HasPrefix(urlPath, cachePath+"/") {
+		return "", false
+	}
+
+	broadsheet, _, _ := strings.Cut(strings.TrimPrefix(urlPath, cachePath+"/"), "/")
+	return broadsheet, broadsheet != ""
+}
+
+// authorizeBroadsheet checks that the user can view a broadsheet. The owner of the broadsheet, or anyone holding the share link
+// Opening a share link sets the share cookie, the charts of the broadsheet are then accessible
+func authorizeBroadsheet(w http.ResponseWriter, r *http.Request, broadsheet string) bool {
+
+	if !authenticator.Enabled() {
+		return true
+	}
+
+	shareKey := r.URL.Query().Get("share")
+	if shareKey == "" {
+		if cookie, err := r.Cookie(shareCookie); err == nil {
+			shareKey = cookie.Value
+		}
+	}
+	if authenticator.ValidShareKey(broadsheet, shareKey) {
+		if r.URL.Query().Get("share") != "" {
+			cookiePath := path.Clean("/"+filepath.ToSlash(envInsightsFolder)) + "/" + broadsheet + "/"
+			http.SetCookie(w, &http.Cookie{Name: shareCookie, Value: shareKey, Path: cookiePath, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode})
+		}
+		return true
+	}
+
+	user := authenticator.User(r)
+	if user == "" {
+		authenticator.Challenge(w, r)
+		return false
+	}
+
+	// The owner is unknown when the owner file is missing. Access is refused
+	owner, err := os.ReadFile(filepath.Join(envInsightsFolder, broadsheet, ownerFile))
+	if err != nil || !authenticator.CanView(user, strings.TrimSpace(string(owner))) {
+		slog.Warn("authorizeBroadsheet. Access refused", "broadsheet", broadsheet, "user", user, "error", err)
+		http.Error(w, "The broadsheet was generated by another user", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// validateName checks an organisation or project name. The names are used in the broadsheet folder & the API URLs
+func validateName(nameType string, name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid %s name: %q. Only letters, digits, '.', '_' and '-' can be used", nameType, name)
+	}
+	return nil
+}
+
+// writeOwner saves the user who generated the broadsheet in the broadsheet folder
+func writeOwner(cacheFolder string) {
+	if sessionOwner == "" {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cacheFolder, ownerFile), []byte(sessionOwner), 0644); err != nil {
+		logger.Error("writeOwner. Cannot save the owner of the broadsheet", "error", err)
+	}
+}
+
+// shareLink returns the link giving access to the broadsheet to anyone holding it. Empty when the users are not authenticated
+func shareLink(permaLink string) string {
+	if !authenticator.Enabled() {
+		return ""
+	}
+	return permaLink + "?share=" + authenticator.ShareKey(filepath.Base(insightsCacheFolder))
+}
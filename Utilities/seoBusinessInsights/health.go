@@ -0,0 +1,93 @@
+// seoBusinessInsights: Health & metrics endpoints. /healthz, /readyz & /metrics (Prometheus)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"errors"
+	"goquery/metrics"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Requests served, by route & status code
+var httpRequests = metrics.NewCounter("seobusinessinsights_http_requests_total", "Requests served by route and status code.", "route", "code")
+var httpRequestDuration = metrics.NewHistogram("seobusinessinsights_http_request_duration_seconds", "Duration of the requests by route.", metrics.RequestBuckets, "route")
+
+// Broadsheet sessions, by status (the status returned by getBusinessInsights)
+var sessionDuration = metrics.NewHistogram("seobusinessinsights_session_duration_seconds", "Duration of the broadsheet sessions by status.", metrics.SessionBuckets, "status")
+
+// Botify API calls, by endpoint
+var botifyAPIRequests = metrics.NewCounter("seobusinessinsights_botify_api_requests_total", "Botify API calls by endpoint and status code.", "endpoint", "code")
+var botifyAPIDuration = metrics.NewHistogram("seobusinessinsights_botify_api_request_duration_seconds", "Latency of the Botify API calls by endpoint.", metrics.APIBuckets, "endpoint")
+var botifyAPIErrors = metrics.NewCounter("seobusinessinsights_botify_api_errors_total", "Botify API calls failed or answered with an error status by endpoint.", "endpoint")
+
+// Used by the HTTP clients calling the Botify API
+var botifyTransport = &metrics.Transport{
+	Endpoint: botifyEndpoint,
+	Requests: botifyAPIRequests,
+	Duration: botifyAPIDuration,
+	Errors:   botifyAPIErrors,
+}
+
+// Size of the insights cache folder. Measured at startup & after each broadsheet, the cache is not walked when the metrics are collected
+var cacheSizeBytes = metrics.NewGauge("seobusinessinsights_cache_size_bytes", "Size of the insights cache folder, measured at startup and after each broadsheet.")
+
+// Register the health & metrics endpoints. They do not use the mutex and respond while a broadsheet is generated
+func healthHandlers() {
+	http.HandleFunc("GET /healthz", metrics.Healthz)
+	http.HandleFunc("GET /readyz", metrics.Readyz(
+		metrics.Check{Name: "cache folder", Check: func() error { return metrics.FolderWritable(envInsightsFolder) }},
+		metrics.Check{Name: "token", Check: tokenPresent},
+	))
+	http.Handle("GET /metrics", metrics.Handler())
+}
+
+// instrumentedHandler counts the requests served by the default mux
+func instrumentedHandler() http.Handler {
+	return metrics.Instrument(http.DefaultServeMux, httpRequests, httpRequestDuration)
+}
+
+// The users provide their own token in user & proxy modes
+func tokenPresent() error {
+	if envBotifyAPIToken == "" && !tokenConfig.PerUser() {
+		return errors.New("envBotifyAPIToken not set")
+	}
+	return nil
+}
+
+// botifyEndpoint returns the name of the Botify API endpoint called. The organisation & project are not included
+func botifyEndpoint(req *http.Request) string {
+	path := req.URL.Path
+	switch {
+	case strings.HasSuffix(path, "/query"):
+		return "query"
+	case strings.HasSuffix(path, "/collections"):
+		return "collections"
+	case strings.HasPrefix(path, "/v1/analyses/"):
+		return "analyses"
+	}
+	return "other"
+}
+
+// measureCacheSize updates the cache size metric
+func measureCacheSize() {
+	cacheSizeBytes.Set(float64(folderSize(envInsightsFolder)))
+}
+
+// folderSize returns the total size of the files in a folder
+func folderSize(folder string) int64 {
+	size := int64(0)
+	_ = filepath.WalkDir(folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
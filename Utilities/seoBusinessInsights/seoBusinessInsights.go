@@ -14,7 +14,10 @@ import (
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	"gopkg.in/ini.v1"
+	"goquery/logging"
+	"html"
 	"io"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
@@ -70,7 +73,8 @@ const bold = "\033[1m"
 const reset = "\033[0m"
 const clearScreen = "\033[H\033[2J"
 
-var lineSeparator = "█" + strings.Repeat("█", 130)
+// Logger of the current session, every line carries the session ID, organisation & project (see logging.Session)
+var logger = slog.Default()
 
 // Constants used to store KPI Specific colours
 const kpiColourRevenue = "Coral"
@@ -342,20 +346,29 @@ func main() {
 
 	// Web server
 	// Serve static files from the current folder
-	fs := http.FileServer(http.Dir("."))
-	http.Handle("/", fs)
+	// The broadsheets are only served to their owner, or with the share link
+	http.Handle("/", insightsFileHandler())
+
+	// Token mode used by the launch screen
+	http.HandleFunc("GET /config", authenticator.RequireFunc(configHandler))
+
+	// Login & logout (OIDC)
+	authenticator.RegisterHandlers(http.DefaultServeMux)
 
 	// Define a handler function for form submission
-	http.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/submit", authenticator.RequireFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// Lock the function until it's complete to prevent race conditions
 		mutex.Lock()
 		defer mutex.Unlock()
 
+		// The user logged in owns the broadsheet
+		sessionOwner = authenticator.User(r)
+
 		// Retrieve the form data from the request (org and username)
 		err := r.ParseForm()
 		if err != nil {
-			fmt.Println(red+"Error. Cannot parse form:"+reset, err)
+			slog.Error("Cannot parse form", "error", err)
 			return
 		}
 		organization = r.Form.Get("organization")
@@ -364,12 +377,58 @@ func main() {
 		// Generate a session ID used for grouping log entries
 		sessionID, err = generateSessionID(8)
 		if err != nil {
-			fmt.Println(red+"Error. writeLog. Failed generating a session ID: %s"+reset, err)
+			slog.Error("Failed generating a session ID", "error", err)
 			os.Exit(0)
 		}
 
+		// Every log line of the session carries the session ID, organisation & project
+		logger = logging.Session(sessionID, organization, project)
+
+		// The organisation name is used in the broadsheet folder, the project name in the API URLs
+		err = validateName("organisation", organization)
+		if err == nil {
+			err = validateName("project", project)
+		}
+		if err != nil {
+			logger.Warn("Invalid name", "error", err)
+			writeLog(sessionID, "-", "-", "-", "Invalid organisation or project name")
+			insightsCacheFolder = envInsightsFolder + "/" + sessionID
+			createInsightsCacheFolder(insightsCacheFolder)
+			generateErrorPage(html.EscapeString(err.Error()))
+			http.Redirect(w, r, insightsCacheFolder+"/"+"go_seo_BusinessInsights_error.html", http.StatusFound)
+			return
+		}
+
+		// Organisations the user can query
+		if !authenticator.Allowed(sessionOwner, organization) {
+			logger.Warn("Organisation not allowed", "user", sessionOwner)
+			writeLog(sessionID, organization, project, "-", "Organisation not allowed")
+			insightsCacheFolder = envInsightsFolder + "/" + sessionID + organization
+			createInsightsCacheFolder(insightsCacheFolder)
+			generateErrorPage("You are not allowed to query this organisation. (" + html.EscapeString(organization) + ")")
+			http.Redirect(w, r, insightsCacheFolder+"/"+"go_seo_BusinessInsights_error.html", http.StatusFound)
+			return
+		}
+
+		// Botify token of the session. Forgotten when the broadsheet is generated
+		if err := startTokenSession(r); err != nil {
+			logger.Error("No Botify token", "error", err)
+			writeLog(sessionID, organization, project, "-", "No Botify token")
+			insightsCacheFolder = envInsightsFolder + "/" + sessionID + organization
+			createInsightsCacheFolder(insightsCacheFolder)
+			generateErrorPage("A Botify token is required. " + err.Error())
+			http.Redirect(w, r, insightsCacheFolder+"/"+"go_seo_BusinessInsights_error.html", http.StatusFound)
+			return
+		}
+		defer endTokenSession()
+
 		// Acquire the business insights
+		started := time.Now()
 		dataStatus := getBusinessInsights(sessionID)
+		defer func() {
+			sessionDuration.Observe(time.Since(started).Seconds(), dataStatus)
+			measureCacheSize()
+		}()
 
 		// Evaluate the results of getBusinessInsights before generating the broadsheet
 
@@ -417,12 +476,16 @@ func main() {
 			http.Redirect(w, r, insightsCacheFolder+"/"+"go_seo_BusinessInsights_error.html", http.StatusFound)
 			return
 		}
-	})
+	}))
+
+	// Health & metrics
+	measureCacheSize()
+	healthHandlers()
 
 	// Start the HTTP server
-	err := http.ListenAndServe(port, nil)
+	err := http.ListenAndServe(port, instrumentedHandler())
 	if err != nil {
-		fmt.Printf(red+"Error. Main. Failed to start HTTP server: %v\n"+reset, err)
+		slog.Error("Main. Failed to start HTTP server", "error", err)
 	}
 }
 
@@ -513,18 +576,8 @@ func businessInsightsBroadsheet(sessionID string) {
 	// Generate the container to present the previously generated components
 	generateBroadsheetContainerHTML(company)
 
-	fmt.Println()
-	fmt.Println(lineSeparator)
-
 	// We're done
-	now := time.Now()
-	formattedTime := now.Format("15:04 02/01/2006")
-	fmt.Println("\nSession ID: " + yellow + sessionID + reset)
-	fmt.Println("\nseoBusinessInsights: Done at " + formattedTime)
-	fmt.Printf("\nOrganization: %s, Project: %s\n"+reset, organization, project)
-
-	fmt.Println()
-	fmt.Println(lineSeparator)
+	logger.Info("seoBusinessInsights: Done")
 
 	// Waiting for the next request
 	return
@@ -533,10 +586,7 @@ func businessInsightsBroadsheet(sessionID string) {
 // Function used to acquire all the business insights for the broadsheet
 func getBusinessInsights(sessionID string) string {
 
-	fmt.Println()
-	fmt.Println(yellow + sessionID + purple + " Getting SEO insights" + reset)
-	fmt.Printf("\n%s%s%s Organization: %s, Project: %s\n", yellow, sessionID, reset, organization, project)
-	fmt.Println()
+	logger.Info("Getting SEO insights")
 
 	// Create the seoBusinessInsights folder for the generated HTML if it does not exist
 	insightsCacheFolder = envInsightsFolder + "/" + sessionID + organization
@@ -545,27 +595,24 @@ func getBusinessInsights(sessionID string) string {
 	// Get the currency used
 	getCurrencyStatus := getCurrencyCompany()
 	if getCurrencyStatus == "errorNoProjectFound" {
-		fmt.Println(red+"Error. getBusinessInsights. No project found for", organization+"/"+project+reset)
+		logger.Error("getBusinessInsights. No project found")
 		return getCurrencyStatus
 	}
 
 	// Identify the analytics tool in use
 	analyticsID, analyticsDateStart := getAnalyticsID()
-	fmt.Printf("%s%s%s Analytics identified: %s\n", yellow, sessionID, reset, analyticsID)
-	fmt.Printf("%s%s%s Data available from: %s\n", yellow, sessionID, reset, analyticsDateStart)
-
-	fmt.Println()
+	logger.Info("Analytics identified", "analyticsID", analyticsID, "dataAvailableFrom", analyticsDateStart)
 
 	// Error checking
 	// Exit if no project has been found
 	if analyticsID == "errorNoProjectFound" {
-		fmt.Println(red+"Error. getBusinessInsights. No project found for", organization+"/"+project+reset)
+		logger.Error("getBusinessInsights. No project found")
 		return analyticsID
 	}
 
 	// Exit if no analytics tool has been detected
 	if analyticsID == "errorNoAnalyticsIntegrated" {
-		fmt.Println(red+"Error. getBusinessInsights. No analytics tool integrated for", organization+"/"+project+reset)
+		logger.Error("getBusinessInsights. No analytics tool integrated")
 		return analyticsID
 	}
 
@@ -656,8 +703,7 @@ func getBusinessInsights(sessionID string) string {
 	// Calculate the forecast
 	forecastDataCompute()
 
-	println()
-	println(green+"No. of months: "+reset, noOfMonths)
+	logger.Info("Insights acquired", "months", noOfMonths)
 
 	return "success"
 }
@@ -816,23 +862,24 @@ func getRevenueAndSearchConsoleData(analyticsID string, startMonthDates []string
 
 		formatInteger := message.NewPrinter(language.English)
 
-		// Display the KPIs
-		fmt.Println()
-		fmt.Printf(yellow+sessionID+white+" Date Start: %s End: %s\n"+reset, startMonthDates[i], endMonthDates[i])
+		// Log the KPIs
 		formattedOrders := formatInteger.Sprintf("%d", metricsOrders)
 		formattedRevenue := formatInteger.Sprintf("%d", metricsRevenue)
 		formattedVisits := formatInteger.Sprintf("%d", metricsVisits)
-		fmt.Println("No. orders:", formattedOrders)
-		fmt.Println("Total revenue:", formattedRevenue)
-		fmt.Println("Average order value:", avgOrderValue)
-		fmt.Println("No. of visits:", formattedVisits)
-		fmt.Println("Average visit value:", avgVisitValue)
-		fmt.Println("Average visits per order:", visitsPerOrderDisplay)
-		fmt.Println("Average conversion rate:", avgConversionRate)
-		fmt.Println("Non-brand impressions:", scImpressions)
-		fmt.Println("Non-brand clicks:", scClicks)
-		fmt.Println("Non-brand CTR:", scCTR)
-		fmt.Println("Non-brand average position:", scAvgPosition)
+		logger.Debug("Monthly KPIs",
+			"dateStart", startMonthDates[i],
+			"dateEnd", endMonthDates[i],
+			"orders", formattedOrders,
+			"revenue", formattedRevenue,
+			"averageOrderValue", avgOrderValue,
+			"visits", formattedVisits,
+			"averageVisitValue", avgVisitValue,
+			"averageVisitsPerOrder", visitsPerOrderDisplay,
+			"averageConversionRate", avgConversionRate,
+			"nonBrandImpressions", scImpressions,
+			"nonBrandClicks", scClicks,
+			"nonBrandCTR", scCTR,
+			"nonBrandAveragePosition", scAvgPosition)
 	}
 
 	// Calculate the average visits per order
@@ -942,21 +989,21 @@ func getRevenueAndSearchConsoleData(analyticsID string, startMonthDates []string
 	organicPerformanceValues = append(organicPerformanceValues, int(metricsOrdersOrganicPC))
 	organicPerformanceValues = append(organicPerformanceValues, int(metricsVisitsOrganicPC))
 
-	fmt.Println("\n" + yellow + sessionID + reset + " Totals" + reset)
-	fmt.Println("Total visits:", metricsVisitsOrganic)
-	fmt.Println("Total revenue:", metricsRevenueOrganic)
-	fmt.Println("Total orders:", metricsOrdersOrganic)
-	fmt.Println("Total average order value:", totalAverageOrderValueOrganic)
-	fmt.Println("Total average visits per order:", totalAverageVisitsPerOrder)
-	fmt.Println("Total average visit value:", totalAverageVisitValue)
-	fmt.Println("Total non-brand impressions:", scImpressionsTotal)
-	fmt.Println("Total non-brand clicks:", scClicksTotal)
-	fmt.Println("Total (average) non-brand CTR:", scCTRTotal)
-	fmt.Println("Total (average) non-brand average position:", scAvgPositionTotal)
-	fmt.Println("Total branded impressions:", scImpressionsTotalBranded)
-	fmt.Println("Total branded clicks:", scClicksTotalBranded)
-	fmt.Println("Total (average) branded CTR:", scCTRTotalBranded)
-	fmt.Println("Total (average) branded average position:", scAvgPositionTotalBranded)
+	logger.Debug("Total KPIs",
+		"visits", metricsVisitsOrganic,
+		"revenue", metricsRevenueOrganic,
+		"orders", metricsOrdersOrganic,
+		"averageOrderValue", totalAverageOrderValueOrganic,
+		"averageVisitsPerOrder", totalAverageVisitsPerOrder,
+		"averageVisitValue", totalAverageVisitValue,
+		"nonBrandImpressions", scImpressionsTotal,
+		"nonBrandClicks", scClicksTotal,
+		"nonBrandCTR", scCTRTotal,
+		"nonBrandAveragePosition", scAvgPositionTotal,
+		"brandedImpressions", scImpressionsTotalBranded,
+		"brandedClicks", scClicksTotalBranded,
+		"brandedCTR", scCTRTotalBranded,
+		"brandedAveragePosition", scAvgPositionTotalBranded)
 
 	return "success"
 }
@@ -1032,7 +1079,7 @@ func generateKeywordsCloudBQL(startDate string, endDate string, brandedFlag stri
 
 	err := json.Unmarshal(responseGetKeywords, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateKeywordsCloudBQL. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateKeywordsCloudBQL. Cannot unmarshal the JSON", "error", err)
 	}
 
 	noKeywordsFound := len(response.Results)
@@ -1129,7 +1176,7 @@ func generateRevenueBQLOrganic(analyticsID string, startDate string, endDate str
 	var response Response
 	err := json.Unmarshal(revenueData, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateRevenueBQLOrganic. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateRevenueBQLOrganic. Cannot unmarshal the JSON", "error", err)
 	}
 
 	var metricsOrders = 0
@@ -1143,7 +1190,7 @@ func generateRevenueBQLOrganic(analyticsID string, startDate string, endDate str
 	responseCount := len(response.Results)
 
 	if responseCount == 0 {
-		fmt.Println(red+"Error. generateRevenueBQLOrganic. Engagement analytics with visits, revenue & transactions (orders) has not been configured for the specified project ", organization+"/"+project+reset)
+		logger.Error("generateRevenueBQLOrganic. Engagement analytics with visits, revenue & transactions (orders) has not been configured for the specified project")
 		getRevenueAndSearchConsoleDataStatus := "errorNoEAFound"
 		return 0, 0, 0, 0, 0.0, 0.0, getRevenueAndSearchConsoleDataStatus
 	} else {
@@ -1232,7 +1279,7 @@ func generateRevenueBQLNonOrganic(analyticsID string, firstStartDatePeriod strin
 	var response Response
 	err := json.Unmarshal(revenueData, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateRevenueBQLNonOrganic. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateRevenueBQLNonOrganic. Cannot unmarshal the JSON", "error", err)
 	}
 
 	// Get the metrics from the JSON
@@ -1326,12 +1373,12 @@ func generateNonOrganicRevenueMediums(analyticsID string) {
 	// Get the non-organic revenue
 	revenueData := executeBQL(0, bqlNonOrganicRevMediums)
 
-	fmt.Println(bqlNonOrganicRevMediums)
+	logger.Debug("generateNonOrganicRevenueMediums. BQL executed", "bql", bqlNonOrganicRevMediums)
 	// Unmarshal the JSON data into the struct
 	var response Response
 	err := json.Unmarshal(revenueData, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateNonOrganicRevenueMediums. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateNonOrganicRevenueMediums. Cannot unmarshal the JSON", "error", err)
 	}
 
 	// Get the number of elements in the slice (aka the number of mediums)
@@ -1419,16 +1466,14 @@ func generateSearchConsoleBQLNonBranded(startDate string, endDate string) (int,
 	var response searchConsoleData
 	err := json.Unmarshal(responseRevenueData, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateSearchConsoleBQL. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateSearchConsoleBQL. Cannot unmarshal the JSON", "error", err)
 	}
 
 	// Check if any data has been returned from the API. Count the number of elements in the response.Results slice
 	responseCount := len(response.Results)
 
 	if responseCount == 0 {
-		fmt.Println(red+"Error. generateSearchConsoleBQL. Analytics integration has not been configured for the specified project ", organization+"/"+project+reset)
-		fmt.Println(startDate)
-		fmt.Println(endDate)
+		logger.Error("generateSearchConsoleBQL. Analytics integration has not been configured for the specified project", "startDate", startDate, "endDate", endDate)
 
 		getSearchDataStatus := "errorNoGAFound"
 		return 0, 0, 0, 0, getSearchDataStatus
@@ -1477,16 +1522,14 @@ func generateSearchConsoleBQLBranded(startDate string, endDate string) (int, int
 	var response searchConsoleData
 	err := json.Unmarshal(responseBrandedData, &response)
 	if err != nil {
-		fmt.Printf(red+"Error. generateSearchConsoleBQLBranded. Cannot unmarshal the JSON: %v"+reset, err)
+		logger.Error("generateSearchConsoleBQLBranded. Cannot unmarshal the JSON", "error", err)
 	}
 
 	// Check if any data has been returned from the API. Count the number of elements in the response.Results slice
 	responseCount := len(response.Results)
 
 	if responseCount == 0 {
-		fmt.Println(red+"Error. generateSearchConsoleBQLBranded. Analytics integration has not been configured for the specified project ", organization+"/"+project+reset)
-		fmt.Println(startDate)
-		fmt.Println(endDate)
+		logger.Error("generateSearchConsoleBQLBranded. Analytics integration has not been configured for the specified project", "startDate", startDate, "endDate", endDate)
 
 		getSearchDataStatus := "errorNoGAFound"
 		return 0, 0, 0, 0, getSearchDataStatus
@@ -1993,7 +2036,7 @@ func barRevenueVisits() {
 	// Assign 'f' here
 	f, err = os.Create(insightsCacheFolder + "/go_seo_RevenueVisitsBar.html")
 	if err != nil {
-		fmt.Printf(red+"Error. barRevenueVisits. Cannot create go_seo_RevenueVisitsBar.html: %v\n"+reset, err)
+		logger.Error("barRevenueVisits. Cannot create go_seo_RevenueVisitsBar.html", "error", err)
 		return
 	}
 
@@ -2433,7 +2476,7 @@ func riverRevenueVisits() {
 	for i, date := range startMonthDates {
 		parsedDate, err := time.Parse("20060102", date)
 		if err != nil {
-			fmt.Printf(red+"Error. riverRevenueVisits. Error parsing date: %v\n"+reset, err)
+			logger.Error("riverRevenueVisits. Error parsing date", "error", err)
 			break
 		}
 		formattedDate := parsedDate.Format("2006/01/02")
@@ -2449,7 +2492,7 @@ func riverRevenueVisits() {
 	for i, date := range startMonthDates {
 		parsedDate, err := time.Parse("20060102", date)
 		if err != nil {
-			fmt.Printf(red+"Error. riverRevenueVisits. Error parsing date: %v\n"+reset, err)
+			logger.Error("riverRevenueVisits. Error parsing date", "error", err)
 			break
 		}
 		formattedDate := parsedDate.Format("2006/01/02")
@@ -2566,10 +2609,8 @@ func textWinningKeywords(brandedMode bool, sessionID string) {
 		htmlSecondPlaceKW = kwKeywords[1]
 		htmlCTR = kwMetricsCTR[0]
 		htmlAvgPosition = kwMetricsAvgPosition[0]
-		fmt.Println("\n" + yellow + sessionID + reset + " Branded keywords\n")
 		for i := 0; i < len(kwKeywords); i++ {
-			fmt.Printf(green+"Keyword:"+reset+bold+" %s"+reset+","+green+" Clicks:"+reset+" %d,"+green+" CTR:"+reset+" %.2f,"+green+" Avg. Position:"+reset+" %.2f\n",
-				kwKeywords[i], kwCountClicks[i], kwMetricsCTR[i], kwMetricsAvgPosition[i])
+			logger.Debug("Branded keyword", "keyword", kwKeywords[i], "clicks", kwCountClicks[i], "CTR", kwMetricsCTR[i], "averagePosition", kwMetricsAvgPosition[i])
 		}
 	}
 
@@ -2581,10 +2622,8 @@ func textWinningKeywords(brandedMode bool, sessionID string) {
 		htmlSecondPlaceKW = kwKeywordsNonBranded[1]
 		htmlCTR = kwCTRNonBranded[0]
 		htmlAvgPosition = kwAvgPositionNonBranded[0]
-		fmt.Println("\n" + yellow + sessionID + reset + " Non branded keywords\n")
 		for i := 0; i < len(kwKeywords); i++ {
-			fmt.Printf(green+"Keyword:"+reset+bold+" %s"+reset+","+green+" Clicks:"+reset+" %d,"+green+" CTR:"+reset+" %.2f,"+green+" Avg. Position:"+reset+" %.2f\n",
-				kwKeywordsNonBranded[i], kwCountClicksNonBranded[i], kwCTRNonBranded[i], kwAvgPositionNonBranded[i])
+			logger.Debug("Non branded keyword", "keyword", kwKeywordsNonBranded[i], "clicks", kwCountClicksNonBranded[i], "CTR", kwCTRNonBranded[i], "averagePosition", kwAvgPositionNonBranded[i])
 		}
 	}
 
@@ -3224,6 +3263,9 @@ func footerNotes() {
 		"Compound Growth (CMGR) refers to the Compound Monthly Growth Rate of the KPI. CMGR is a financial term used to measure the growth rate of a metric over a monthly basis taking into account the compounding effect. CMGR provides a clear and standardised method to measure growth over time.",
 		"The permalink for this broadsheet is <a href=\"" + broadsheetPermaLink + "\" target=\"_blank\">" + broadsheetPermaLink + "</a>",
 	}
+	if link := shareLink(broadsheetPermaLink); link != "" {
+		footerNotesStrings = append(footerNotesStrings, "Anyone holding the <a href=\""+link+"\" target=\"_blank\">share link</a> can view this broadsheet.")
+	}
 
 	// Generate HTML content
 	htmlContent := `
@@ -3258,7 +3300,7 @@ func formatDate(dateStr string) string {
 
 	date, err := time.Parse("20060102", dateStr)
 	if err != nil {
-		fmt.Println(red+"Error. formatDate. Cannot parse date:"+reset, err)
+		logger.Error("formatDate. Cannot parse date", "error", err)
 		return dateStr
 	}
 	return date.Format("January 2006")
@@ -3269,22 +3311,20 @@ func saveHTML(genHTML string, genFilename string) {
 
 	file, err := os.Create(insightsCacheFolder + genFilename)
 	if err != nil {
-		fmt.Println(red+"Error. saveHTML. Cannot create:"+reset, insightsCacheFolder, genFilename, err)
+		logger.Error("saveHTML. Cannot create the file", "folder", insightsCacheFolder, "file", genFilename, "error", err)
 		return
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Println(red+"Error. saveHTML. Failed to close file: %v\n"+reset, err)
+			logger.Error("saveHTML. Failed to close file", "error", err)
 			return
 		}
 	}()
 
 	_, err = file.WriteString(genHTML)
 	if err != nil {
-		fullFolder := insightsCacheFolder + genFilename
-		fmt.Printf(red+"Error. saveHTML. Cannot write HTML file: %s"+reset, fullFolder)
-		fmt.Printf(red+"Error. saveHTML. Error %s:"+reset, err)
+		logger.Error("saveHTML. Cannot write HTML file", "file", insightsCacheFolder+genFilename, "error", err)
 		return
 	}
 }
@@ -3655,34 +3695,35 @@ func executeBQL(returnSize int, bqlToExecute string) []byte {
 	// Create the POST request
 	req, errorCheck := http.NewRequest("POST", url, bytes.NewBuffer(httpBody))
 	if errorCheck != nil {
-		fmt.Println(red+"Error. executeBQL. Cannot create request. Perhaps the provided credentials are invalid: "+reset, errorCheck)
+		logger.Error("executeBQL. Cannot create request. Perhaps the provided credentials are invalid", "error", errorCheck)
 	}
 
 	// Define the headers
 	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", "token "+envBotifyAPIToken)
+	req.Header.Add("Authorization", "token "+botifyToken)
 	req.Header.Add("Content-Type", "application/json")
 
 	// Create HTTP client and execute the request
 	client := &http.Client{
-		Timeout: 60 * time.Second,
+		Timeout:   60 * time.Second,
+		Transport: botifyTransport,
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println(red+"Error. executeBQL.  Cannot create the HTTP client:", errorCheck)
+		logger.Error("executeBQL. Cannot execute the request", "error", err)
 	}
 
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			fmt.Println(red+"Error. executeBQL. Failed to close response body: %v\n"+reset, err)
+			logger.Error("executeBQL. Failed to close response body", "error", err)
 		}
 	}()
 
 	// Read the response body
 	responseData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println(red+"Error. executeBQL. Cannot read response body:", err)
+		logger.Error("executeBQL. Cannot read response body", "error", err)
 	}
 
 	// Return the response body as a byte slice
@@ -3729,12 +3770,7 @@ func calculateCMGR(sessionID string) {
 	}
 	cmgrOrderValueValue := computeCMGR(seoOrdersValueFloat, "Order value")
 
-	fmt.Printf("\n" + yellow + sessionID + reset + " Compound Monthly Growth Rate\n" + reset)
-	fmt.Printf("Revenue: %.2f\n", cmgrRevenue)
-	fmt.Printf("Visits: %.2f\n", cmgrVisits)
-	fmt.Printf("Visit value: %.2f\n", cmgrVisitValue)
-	fmt.Printf("Order volume: %.2f\n", cmgrOrderValue)
-	fmt.Printf("Order value: %.2f\n", cmgrOrderValueValue)
+	logger.Debug("Compound Monthly Growth Rate", "revenue", cmgrRevenue, "visits", cmgrVisits, "visitValue", cmgrVisitValue, "orderVolume", cmgrOrderValue, "orderValue", cmgrOrderValueValue)
 }
 
 func computeCMGR(values []float64, calculatedKPIName string) float64 {
@@ -3752,12 +3788,7 @@ func computeCMGR(values []float64, calculatedKPIName string) float64 {
 	// CMGR formula: (finalValue / initialValue) ^ (1 / numberOfPeriods) - 1
 	cmgr := math.Pow(finalValue/initialValue, 1/numberOfPeriods) - 1
 
-	println()
-	println(yellow + sessionID + green + " CMGR Inputs" + reset)
-	println(yellow + calculatedKPIName + reset)
-	fmt.Printf("initialValue: %f\n", initialValue)
-	fmt.Printf("finalValue: %f\n", finalValue)
-	fmt.Printf("numberOfPeriods: %f\n", numberOfPeriods)
+	logger.Debug("CMGR inputs", "kpi", calculatedKPIName, "initialValue", initialValue, "finalValue", finalValue, "numberOfPeriods", numberOfPeriods)
 
 	return cmgr
 }
@@ -3771,25 +3802,26 @@ func getAnalyticsID() (string, string) {
 
 	// Define the headers
 	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", "token "+envBotifyAPIToken)
+	req.Header.Add("Authorization", "token "+botifyToken)
 	req.Header.Add("Content-Type", "application/json")
 
 	if errorCheck != nil {
-		fmt.Println(red+"\nError. getAnalyticsID. Cannot create request:"+reset, errorCheck)
+		logger.Error("getAnalyticsID. Cannot create request", "error", errorCheck)
 	}
 	// Create HTTP client and execute the request
 	client := &http.Client{
-		Timeout: 60 * time.Second,
+		Timeout:   60 * time.Second,
+		Transport: botifyTransport,
 	}
 	resp, errorCheck := client.Do(req)
 	if errorCheck != nil {
-		fmt.Println(red+"Error. getAnalyticsID. Error: "+reset, errorCheck)
+		logger.Error("getAnalyticsID. Error", "error", errorCheck)
 	}
 
 	//defer resp.Body.Close()
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			fmt.Println(red+"Error. getAnalysisID. Failed to close response body: %v\n"+reset, err)
+			logger.Error("getAnalysisID. Failed to close response body", "error", err)
 			return
 		}
 	}()
@@ -3797,13 +3829,13 @@ func getAnalyticsID() (string, string) {
 	// Read the response body
 	responseAnalyticsID, errorCheck := io.ReadAll(resp.Body)
 	if errorCheck != nil {
-		fmt.Println(red+"Error. getAnalyticsID. Cannot read response body:"+reset, errorCheck)
+		logger.Error("getAnalyticsID. Cannot read response body", "error", errorCheck)
 	}
 
 	// Unmarshal the JSON data into the struct
 	var analyticsIDs []analyticsIDData
 	if err := json.Unmarshal(responseAnalyticsID, &analyticsIDs); err != nil {
-		fmt.Println(red+"Error. getAnalyticsID. The organisation and/or project name are probably incorrect. Cannot unmarshall the JSON:"+reset, err)
+		logger.Error("getAnalyticsID. The organisation and/or project name are probably incorrect. Cannot unmarshall the JSON", "error", err)
 		return "errorNoProjectFound", ""
 	}
 
@@ -3823,7 +3855,7 @@ func calculateDateRanges(analyticsStartDate string) DateRanges {
 
 	startTime, err := time.Parse("2006-01-02", analyticsStartDate)
 	if err != nil {
-		fmt.Println("Error parsing start date:", err)
+		logger.Error("calculateDateRanges. Cannot parse the start date", "error", err)
 		return DateRanges{}
 	}
 
@@ -3857,10 +3889,7 @@ func calculateDateRanges(analyticsStartDate string) DateRanges {
 			}
 
 			dateRanges = append(dateRanges, [2]time.Time{startDate, endDate})
-			fmt.Println("start end")
-			fmt.Println(startDate)
-			fmt.Println(endDate)
-			fmt.Println("_______________")
+			logger.Debug("Date range", "startDate", startDate, "endDate", endDate)
 			currentTime = startDate.AddDate(0, 0, 0)
 		}
 		// Less than a full year data available
@@ -4043,6 +4072,9 @@ func generateBarChart(
 
 func writeLog(sessionID, organization, project, analyticsID, statusDescription string) {
 
+	// The status is also logged. The CSV log file is kept for the existing reports
+	logging.Session(sessionID, organization, project).Info(statusDescription, "analyticsID", analyticsID)
+
 	// Define log file name
 	fileName := envInsightsLogFolder + "/_seoBusinessInsights.log"
 
@@ -4055,12 +4087,12 @@ func writeLog(sessionID, organization, project, analyticsID, statusDescription s
 	// Open or create the log file
 	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		fmt.Printf(red+"Error. writeLog. Cannot open log file: %s"+reset, err)
+		slog.Error("writeLog. Cannot open log file", "error", err)
 	}
 
 	defer func() {
 		if err := file.Close(); err != nil {
-			fmt.Printf(red+"Error. writeLog. Failed to close log file: %v\n"+reset, err)
+			slog.Error("writeLog. Failed to close log file", "error", err)
 		}
 	}()
 
@@ -4075,12 +4107,12 @@ func writeLog(sessionID, organization, project, analyticsID, statusDescription s
 	if !fileExists {
 		header := "SessionID,Date,Organisation,Project,AnalyticsID,Status\n"
 		if _, err := file.WriteString(header); err != nil {
-			fmt.Printf(red+"Error. writeLog. Failed to write log header: %s"+reset, err)
+			slog.Error("writeLog. Failed to write log header", "error", err)
 		}
 	}
 
 	if _, err := file.WriteString(logRecord); err != nil {
-		fmt.Printf(red+"Error. writeLog. Cannot write to log file: %s"+reset, err)
+		slog.Error("writeLog. Cannot write to log file", "error", err)
 	}
 }
 
@@ -4109,21 +4141,22 @@ func getCurrencyCompany() string {
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Println(red+"\nError. getCurrencyCompany. Cannot create request:"+reset, err)
+		logger.Error("getCurrencyCompany. Cannot create request", "error", err)
 	}
 	// Define the headers
 	req.Header.Add("accept", "application/json")
-	req.Header.Add("Authorization", "token "+envBotifyAPIToken)
+	req.Header.Add("Authorization", "token "+botifyToken)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	client := &http.Client{Transport: botifyTransport}
+	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println(red+"\nError. getCurrencyCompany. Cannot sent request:"+reset, err)
+		logger.Error("getCurrencyCompany. Cannot sent request", "error", err)
 	}
 
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			fmt.Println(red+"Error. getCurrencyCompany. Failed to close response body: %v\n"+reset, err)
+			logger.Error("getCurrencyCompany. Failed to close response body", "error", err)
 			return
 		}
 	}()
@@ -4131,19 +4164,19 @@ func getCurrencyCompany() string {
 	responseGetCurrency, err := io.ReadAll(resp.Body)
 
 	if err != nil {
-		fmt.Println(red+"\nError. getCurrencyCompany. Cannot read response body:"+reset, err)
+		logger.Error("getCurrencyCompany. Cannot read response body", "error", err)
 	}
 
 	var responseObject botifyResponseData
 	err = json.Unmarshal(responseGetCurrency, &responseObject)
 
 	if err != nil {
-		fmt.Println(red+"\nError. getCurrencyCompany. Cannot unmarshall JSON:"+reset, err)
+		logger.Error("getCurrencyCompany. Cannot unmarshall JSON", "error", err)
 	}
 
 	// Display an error if no crawls found
 	if responseObject.Count == 0 {
-		fmt.Println(red + "\nError. getCurrencyCompany. Invalid crawl or no crawls found in the project" + reset)
+		logger.Error("getCurrencyCompany. Invalid crawl or no crawls found in the project")
 		return "errorNoProjectFound"
 	}
 
@@ -4203,10 +4236,12 @@ func createInsightsCacheFolder(cacheFolder string) {
 		// Create the folder and any necessary parents
 		err := os.MkdirAll(insightsDir, 0755)
 		if err != nil {
-			fmt.Printf(red+"Error. Failed to create the insights cache folder: %v"+insightsDir+reset, err)
-			fmt.Println()
+			logger.Error("createInsightsCacheFolder. Failed to create the insights cache folder", "folder", insightsDir, "error", err)
 		}
 	}
+
+	// Only the owner can view the broadsheet
+	writeOwner(insightsDir)
 }
 
 func getHostnamePort() {
@@ -4214,12 +4249,12 @@ func getHostnamePort() {
 	// Load the INI file
 	cfg, err := ini.Load("seoBusinessInsights.ini")
 	if err != nil {
-		fmt.Printf(red+"Error. getHostnamePort. Failed to read seoBusinessInsights.ini file: %v"+reset, err)
+		slog.Error("getHostnamePort. Failed to read seoBusinessInsights.ini file", "error", err)
 	}
 
 	// Get values from the .ini file
 	if !cfg.Section("").HasKey("protocol") {
-		fmt.Println(yellow + "Warning: 'protocol' not found in configuration file. Will default to HTTPS." + reset)
+		slog.Warn("'protocol' not found in configuration file. Will default to HTTPS")
 		// Default when no protocol key is found in the .ini file
 		protocol = "https"
 	} else {
@@ -4227,13 +4262,13 @@ func getHostnamePort() {
 	}
 
 	if !cfg.Section("").HasKey("hostname") {
-		fmt.Println(yellow + "Warning: 'hostname' not found in configuration file. Will default to localhost." + reset)
+		slog.Warn("'hostname' not found in configuration file. Will default to localhost")
 	} else {
 		hostname = cfg.Section("").Key("hostname").String()
 	}
 
 	if !cfg.Section("").HasKey("port") {
-		fmt.Println(yellow + "Warning: 'port' not found in configuration file. By default no port number will be used." + reset)
+		slog.Warn("'port' not found in configuration file. By default no port number will be used")
 		port = ""
 	} else {
 		port = cfg.Section("").Key("port").String()
@@ -4251,8 +4286,7 @@ func getHostnamePort() {
 	serverHostname = hostname
 	serverPort = port
 
-	fmt.Printf(green+"\nHostname: %s\n"+reset, serverHostname)
-	fmt.Printf(green+"Port: %s\n"+reset, serverPort)
+	slog.Info("Server address", "hostname", serverHostname, "port", serverPort)
 }
 
 // Function used to inverse the dates in the date slice. Used to ensure the latest data is display to the right side of the chart
@@ -4266,42 +4300,38 @@ func invertStringSlice(s []string) {
 func getEnvVariables() (envBotifyAPIToken string, envInsightsLogFolder string, envInsightsFolder string, envInsightsHostingMode string) {
 
 	// Botify API token from the env. variable getbotifyAPIToken
+	// Not required in user & proxy modes, the token is provided with each request
 	envBotifyAPIToken = os.Getenv("envBotifyAPIToken")
-	if envBotifyAPIToken == "" {
-		fmt.Println(red + "Error. getEnvVariables. envBotifyAPIToken environment variable not set." + reset)
-		fmt.Println(red + "Cannot start seoBusinessInsights server." + reset)
+	if envBotifyAPIToken == "" && !tokenConfig.PerUser() {
+		slog.Error("getEnvVariables. envBotifyAPIToken environment variable not set. Cannot start seoBusinessInsights server")
 		os.Exit(0)
 	}
 
 	// Storage folder for the log file
 	envInsightsLogFolder = os.Getenv("envInsightsLogFolder")
 	if envInsightsLogFolder == "" {
-		fmt.Println(red + "Error. getEnvVariables. envInsightsLogFolder environment variable not set." + reset)
-		fmt.Println(red + "Cannot start seoBusinessInsights server." + reset)
+		slog.Error("getEnvVariables. envInsightsLogFolder environment variable not set. Cannot start seoBusinessInsights server")
 		os.Exit(0)
 	} else {
-		fmt.Println()
-		fmt.Println(green + "Log folder: " + envInsightsLogFolder + reset)
+		slog.Info("Log folder", "folder", envInsightsLogFolder)
 	}
 
 	// Storage folder for the cached insights
 	envInsightsFolder = os.Getenv("envInsightsFolder")
 	if envInsightsFolder == "" {
-		fmt.Println(red + "Error. getEnvVariables. envInsightsFolder environment variable not set." + reset)
-		fmt.Println(red + "Cannot start seoBusinessInsights server." + reset)
+		slog.Error("getEnvVariables. envInsightsFolder environment variable not set. Cannot start seoBusinessInsights server")
 		os.Exit(0)
 	} else {
-		fmt.Println(green + "seoBusinessInsights cache folder: " + envInsightsFolder + reset)
+		slog.Info("seoBusinessInsights cache folder", "folder", envInsightsFolder)
 	}
 
 	// Hosting mode. This will be either "local" or "docker"
 	envInsightsHostingMode = os.Getenv("envInsightsHostingMode")
 	if envInsightsHostingMode == "" {
-		fmt.Println(red + "Error. getEnvVariables. envInsightsHostingMode environment variable not set." + reset)
-		fmt.Println(red + "Cannot start seoBusinessInsights server." + reset)
+		slog.Error("getEnvVariables. envInsightsHostingMode environment variable not set. Cannot start seoBusinessInsights server")
 		os.Exit(0)
 	} else {
-		fmt.Println(green + "seoBusinessInsights hosting mode: " + envInsightsHostingMode + reset)
+		slog.Info("seoBusinessInsights hosting mode", "mode", envInsightsHostingMode)
 	}
 
 	return envBotifyAPIToken, envInsightsLogFolder, envInsightsFolder, envInsightsHostingMode
@@ -4310,10 +4340,18 @@ func getEnvVariables() (envBotifyAPIToken string, envInsightsLogFolder string, e
 // Display the welcome banner, get the hostname and environment variables
 func startup() {
 
-	// Clear the screen
-	fmt.Print(clearScreen)
+	// Structured logs. JSON in a container, colour output when running locally. The level is set with envInsightsLogLevel
+	if err := logging.Setup(os.Getenv("envInsightsHostingMode"), os.Getenv("envInsightsLogLevel")); err != nil {
+		slog.Warn("Invalid log level, info is used", "error", err)
+	}
+	logger = slog.Default()
+
+	// The banner is only displayed when running locally
+	if os.Getenv("envInsightsHostingMode") == "local" {
+		// Clear the screen
+		fmt.Print(clearScreen)
 
-	fmt.Print(green + `
+		fmt.Print(green + `
  ██████╗  ██████╗         ███████╗███████╗ ██████╗ 
 ██╔════╝ ██╔═══██╗        ██╔════╝██╔════╝██╔═══██╗
 ██║  ███╗██║   ██║        ███████╗█████╗  ██║   ██║
@@ -4321,7 +4359,7 @@ func startup() {
 ╚██████╔╝╚██████╔╝███████╗███████║███████╗╚██████╔╝
  ╚═════╝  ╚═════╝ ╚══════╝╚══════╝╚══════╝ ╚═════╝`)
 
-	fmt.Print(purple + `
+		fmt.Print(purple + `
 ██████╗ ██╗   ██╗███████╗██╗███╗   ██╗███████╗███████╗███████╗██╗███╗   ██╗███████╗██╗ ██████╗ ██╗  ██╗████████╗███████╗
 ██╔══██╗██║   ██║██╔════╝██║████╗  ██║██╔════╝██╔════╝██╔════╝██║████╗  ██║██╔════╝██║██╔════╝ ██║  ██║╚══██╔══╝██╔════╝
 ██████╔╝██║   ██║███████╗██║██╔██╗ ██║█████╗  ███████╗███████╗██║██╔██╗ ██║███████╗██║██║  ███╗███████║   ██║   ███████╗
@@ -4329,22 +4367,33 @@ func startup() {
 ██████╔╝╚██████╔╝███████║██║██║ ╚████║███████╗███████║███████║██║██║ ╚████║███████║██║╚██████╔╝██║  ██║   ██║   ███████║
 ╚═════╝  ╚═════╝ ╚══════╝╚═╝╚═╝  ╚═══╝╚══════╝╚══════╝╚══════╝╚═╝╚═╝  ╚═══╝╚══════╝╚═╝ ╚═════╝ ╚═╝  ╚═╝   ╚═╝   ╚══════╝ 
 `)
+		fmt.Println()
+	}
 
-	fmt.Println()
-	fmt.Println(purple+"Version:"+reset, version)
-	fmt.Println(green + "\nseoBusinessInsights server is ON\n" + reset)
+	slog.Info("seoBusinessInsights server is ON", "version", version)
 
-	now := time.Now()
-	formattedTime := now.Format("15:04 02/01/2006")
-	fmt.Println(green + "Server started at " + formattedTime + reset)
+	// Where the Botify token comes from. The server token is not required when the users provide their own
+	getTokenConfig()
+
+	// How the users are authenticated
+	getAuthConfig()
 
 	// Get the environment variables for token, log folder & cache folder
 	envBotifyAPIToken, envInsightsLogFolder, envInsightsFolder, envInsightsHostingMode = getEnvVariables()
 
+	// The token never appears in the logs
+	tokenConfig.ServerToken = envBotifyAPIToken
+	logging.Redact(envBotifyAPIToken)
+
+	// The cache folder is created at startup, the readiness check does not create it
+	if err := os.MkdirAll(envInsightsFolder, 0755); err != nil {
+		slog.Error("startup. Cannot create the cache folder", "folder", envInsightsFolder, "error", err)
+	}
+
 	// Get the hostname and port
 	getHostnamePort()
 
-	fmt.Println(green + "\n... waiting for requests\n" + reset)
+	slog.Info("Waiting for requests")
 }
 
 // cleanInsights is used to remove all slices where there are zero values in the revenue and visits data
@@ -0,0 +1,63 @@
+// seoBusinessInsights: Botify token of the session. The token of the server (envBotifyAPIToken) or the token of the user (see botifytoken)
+// Written by Jason Vicinanza
+
+package main
+
+import (
+	"encoding/json"
+	"goquery/botifytoken"
+	"goquery/logging"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Where the token comes from. Set with envInsightsTokenMode (server, user or proxy)
+// In proxy mode the secret used to sign the cookie is set with envInsightsCookieSecret
+var tokenConfig = botifytoken.NewConfig(botifytoken.ModeServer, "", nil)
+
+// Token used for the Botify API calls of the current broadsheet. Never written to disk or to the logs
+var botifyToken string
+
+// getTokenConfig reads the token mode from the environment. Called before getEnvVariables, the server token is not required in user & proxy modes
+func getTokenConfig() {
+
+	mode, err := botifytoken.ParseMode(os.Getenv("envInsightsTokenMode"))
+	if err != nil {
+		slog.Error("getTokenConfig. Invalid token mode. Cannot start seoBusinessInsights server", "error", err)
+		os.Exit(0)
+	}
+
+	tokenConfig = botifytoken.NewConfig(mode, "", []byte(os.Getenv("envInsightsCookieSecret")))
+	slog.Info("Botify token mode", "mode", mode)
+	if mode == botifytoken.ModeProxy && len(tokenConfig.CookieSecret) == 0 {
+		slog.Warn("envInsightsCookieSecret not set, the token is only read from the " + tokenConfig.Header + " header")
+	}
+}
+
+// startTokenSession sets the token of the session from the request. The token is redacted from the logs until endTokenSession is called
+func startTokenSession(r *http.Request) error {
+	token, err := tokenConfig.FromRequest(r)
+	if err != nil {
+		return err
+	}
+	botifyToken = token
+	logging.Redact(token)
+	return nil
+}
+
+// endTokenSession forgets the token of the user when the broadsheet is generated
+func endTokenSession() {
+	if tokenConfig.PerUser() {
+		logging.Forget(botifyToken)
+	}
+	botifyToken = ""
+}
+
+// configHandler handles GET /config. The launch screen displays the token field when the users provide their own token
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"tokenMode": tokenConfig.Mode}); err != nil {
+		slog.Error("configHandler. Cannot write the response", "error", err)
+	}
+}